@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// nodeAllocation holds the summed effective requests of all scheduled,
+// non-terminated pods on a node. Values are immutable once published so they
+// can be read without locking.
+type nodeAllocation struct {
+	allocated         map[corev1.ResourceName]float64
+	daemonsetOverhead map[corev1.ResourceName]float64
+	podKeys           []string // namespace/name of the pods counted
+}
+
+// allocatedFor returns the allocated amount of a resource; nil-safe for nodes without pods.
+func (a *nodeAllocation) allocatedFor(res corev1.ResourceName) float64 {
+	if a == nil {
+		return 0
+	}
+	return a.allocated[res]
+}
+
+// daemonsetOverheadFor returns the DaemonSet overhead of a resource; nil-safe for nodes without pods.
+func (a *nodeAllocation) daemonsetOverheadFor(res corev1.ResourceName) float64 {
+	if a == nil {
+		return 0
+	}
+	return a.daemonsetOverhead[res]
+}
+
+// usageFor sums the usage of a resource over the node's pods from a usage snapshot.
+func (a *nodeAllocation) usageFor(usage map[string]corev1.ResourceList, res corev1.ResourceName) float64 {
+	if a == nil {
+		return 0
+	}
+	var used float64
+	for _, key := range a.podKeys {
+		used += podUsageValue(usage, key, res)
+	}
+	return used
+}
+
+// podAllocation is a single pod's contribution to its node's allocation.
+type podAllocation struct {
+	nodeName  string
+	requests  map[corev1.ResourceName]float64
+	daemonSet bool
+}
+
+// podFilterStats counts pods seen by an allocation pass: those counted
+// towards node allocation and those skipped, by reason.
+type podFilterStats struct {
+	counted     int
+	unscheduled int
+	terminated  int
+}
+
+// Skip reasons reported by podSkipReason.
+const (
+	skipReasonUnscheduled = "unscheduled"
+	skipReasonTerminated  = "terminated"
+)
+
+func (s *podFilterStats) add(reason string) {
+	switch reason {
+	case "":
+		s.counted++
+	case skipReasonUnscheduled:
+		s.unscheduled++
+	case skipReasonTerminated:
+		s.terminated++
+	}
+}
+
+func podKey(pod *corev1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// podSkipReason returns why a pod does not reserve node resources, or "" if
+// it does: it must be scheduled and not terminated.
+func podSkipReason(pod *corev1.Pod) string {
+	if pod.Spec.NodeName == "" {
+		return skipReasonUnscheduled
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return skipReasonTerminated
+	}
+	return ""
+}
+
+// podRequests returns the effective request of every resource requested by
+// any of the pod's containers, as computed by calculatePodRequest. Computing
+// all resources (not only tracked ones) keeps precomputed totals valid when
+// the tracked resources change.
+func podRequests(pod *corev1.Pod, logger *slog.Logger) map[corev1.ResourceName]float64 {
+	requests := make(map[corev1.ResourceName]float64)
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for _, container := range containers {
+			for res := range container.Resources.Requests {
+				if _, done := requests[res]; done {
+					continue
+				}
+				podRequest, details := calculatePodRequest(pod, res)
+				requests[res] = podRequest
+
+				if logger != nil && logger.Enabled(context.TODO(), slog.LevelDebug) && podRequest > 0 {
+					if details.usedInit {
+						logger.Debug("pod resource request (init container dominates)",
+							"pod", podKey(pod),
+							"resource", string(res),
+							"effective", details.effective,
+							"init_max", details.initMax,
+							"init_container", details.initMaxContainer,
+							"regular_sum", details.regularSum)
+					} else {
+						logger.Debug("pod resource request",
+							"pod", podKey(pod),
+							"resource", string(res),
+							"effective", details.effective,
+							"containers", details.containerCount,
+							"init_containers", details.initContainerCount)
+					}
+				}
+			}
+		}
+	}
+	return requests
+}
+
+func newPodAllocation(pod *corev1.Pod, logger *slog.Logger) podAllocation {
+	return podAllocation{
+		nodeName:  pod.Spec.NodeName,
+		requests:  podRequests(pod, logger),
+		daemonSet: isDaemonSetPod(pod),
+	}
+}
+
+// sumNodeAllocation builds a node's totals from its pods' contributions.
+func sumNodeAllocation(pods map[string]podAllocation) *nodeAllocation {
+	alloc := &nodeAllocation{
+		allocated:         make(map[corev1.ResourceName]float64),
+		daemonsetOverhead: make(map[corev1.ResourceName]float64),
+		podKeys:           make([]string, 0, len(pods)),
+	}
+	for key, pod := range pods {
+		alloc.podKeys = append(alloc.podKeys, key)
+		for res, val := range pod.requests {
+			alloc.allocated[res] += val
+			if pod.daemonSet {
+				alloc.daemonsetOverhead[res] += val
+			}
+		}
+	}
+	return alloc
+}
+
+// computeNodeAllocations performs a full recompute of per-node allocations
+// from a pod list, skipping unscheduled and terminated pods.
+func computeNodeAllocations(pods []*corev1.Pod, logger *slog.Logger) (map[string]*nodeAllocation, podFilterStats) {
+	var stats podFilterStats
+	podsByNode := make(map[string]map[string]podAllocation)
+	for _, pod := range pods {
+		reason := podSkipReason(pod)
+		stats.add(reason)
+		if reason != "" {
+			logger.Debug("skipping pod", "pod", podKey(pod), "reason", reason, "phase", pod.Status.Phase)
+			continue
+		}
+		if podsByNode[pod.Spec.NodeName] == nil {
+			podsByNode[pod.Spec.NodeName] = make(map[string]podAllocation)
+		}
+		podsByNode[pod.Spec.NodeName][podKey(pod)] = newPodAllocation(pod, logger)
+	}
+
+	allocations := make(map[string]*nodeAllocation, len(podsByNode))
+	for nodeName, nodePods := range podsByNode {
+		allocations[nodeName] = sumNodeAllocation(nodePods)
+	}
+	return allocations, stats
+}
+
+// allocationSource provides precomputed per-node allocations: an
+// AllocationIndex, or a PodSource serving the index of its current informer.
+type allocationSource interface {
+	Allocations() (map[string]*nodeAllocation, podFilterStats)
+}
+
+// AllocationIndex maintains per-node request totals incrementally from pod
+// informer events, so a scrape reads precomputed state in O(nodes) instead
+// of recomputing every pod's requests. It implements
+// cache.ResourceEventHandler.
+type AllocationIndex struct {
+	logger *slog.Logger
+	owns   func(nodeName string) bool // nil = every node; pods on other nodes are ignored
+
+	mu         sync.RWMutex
+	pods       map[string]podAllocation            // podKey -> contribution
+	skipped    map[string]string                   // podKey -> skip reason
+	podsByNode map[string]map[string]podAllocation // node -> podKey -> contribution
+	nodes      map[string]*nodeAllocation          // node -> published totals
+}
+
+// NewAllocationIndex creates an empty index.
+func NewAllocationIndex(logger *slog.Logger) *AllocationIndex {
+	return &AllocationIndex{
+		logger:     logger,
+		pods:       make(map[string]podAllocation),
+		skipped:    make(map[string]string),
+		podsByNode: make(map[string]map[string]podAllocation),
+		nodes:      make(map[string]*nodeAllocation),
+	}
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (i *AllocationIndex) OnAdd(obj interface{}, _ bool) {
+	if pod, ok := obj.(*corev1.Pod); ok {
+		i.upsert(pod)
+	}
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (i *AllocationIndex) OnUpdate(_, newObj interface{}) {
+	if pod, ok := newObj.(*corev1.Pod); ok {
+		i.upsert(pod)
+	}
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (i *AllocationIndex) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		i.removeLocked(podKey(pod))
+	}
+}
+
+func (i *AllocationIndex) upsert(pod *corev1.Pod) {
+	key := podKey(pod)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.removeLocked(key)
+	if i.owns != nil && pod.Spec.NodeName != "" && !i.owns(pod.Spec.NodeName) {
+		return
+	}
+	if reason := podSkipReason(pod); reason != "" {
+		i.skipped[key] = reason
+		return
+	}
+
+	alloc := newPodAllocation(pod, i.logger)
+	i.pods[key] = alloc
+	if i.podsByNode[alloc.nodeName] == nil {
+		i.podsByNode[alloc.nodeName] = make(map[string]podAllocation)
+	}
+	i.podsByNode[alloc.nodeName][key] = alloc
+	i.nodes[alloc.nodeName] = sumNodeAllocation(i.podsByNode[alloc.nodeName])
+}
+
+// removeLocked drops a pod's contribution and republishes its node's totals.
+// Totals are re-summed from the remaining pods rather than decremented, so
+// floating-point error cannot accumulate over many updates.
+func (i *AllocationIndex) removeLocked(key string) {
+	delete(i.skipped, key)
+	prev, ok := i.pods[key]
+	if !ok {
+		return
+	}
+	delete(i.pods, key)
+	nodePods := i.podsByNode[prev.nodeName]
+	delete(nodePods, key)
+	if len(nodePods) == 0 {
+		delete(i.podsByNode, prev.nodeName)
+		delete(i.nodes, prev.nodeName)
+		return
+	}
+	i.nodes[prev.nodeName] = sumNodeAllocation(nodePods)
+}
+
+// Allocations returns the current per-node totals and pod counts. The
+// returned map is a copy; its values are immutable and shared.
+func (i *AllocationIndex) Allocations() (map[string]*nodeAllocation, podFilterStats) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	out := make(map[string]*nodeAllocation, len(i.nodes))
+	for name, alloc := range i.nodes {
+		out[name] = alloc
+	}
+	stats := podFilterStats{counted: len(i.pods)}
+	for _, reason := range i.skipped {
+		stats.add(reason)
+	}
+	return out, stats
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// renderMetrics returns every emitted metric as a sorted "desc labels value"
+// line, so two collectors can be compared for identical output.
+func renderMetrics(t *testing.T, c prometheus.Collector) []string {
+	t.Helper()
+	var lines []string
+	for _, m := range collectMetrics(c) {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatalf("writing metric: %v", err)
+		}
+		labels := make([]string, 0, len(pb.GetLabel()))
+		for _, lp := range pb.GetLabel() {
+			labels = append(labels, lp.GetName()+"="+lp.GetValue())
+		}
+		lines = append(lines, fmt.Sprintf("%s %v %.9g", m.Desc().String(), labels, pb.GetGauge().GetValue()))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// TestAllocationIndex_MatchesFullRecompute applies a sequence of informer
+// events to an AllocationIndex and verifies after each one that the
+// index-backed collector emits exactly what a full recompute over the same
+// pods emits.
+func TestAllocationIndex_MatchesFullRecompute(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	resources := []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+	labelGroups := []LabelGroup{newLabelGroup("zone")}
+
+	nodes := []*corev1.Node{
+		makeNode("node-1", "4", "8Gi"),
+		makeNode("node-2", "8", "16Gi"),
+		makeNode("node-3", "4", "8Gi"),
+	}
+	nodes[0].Labels = map[string]string{"zone": "a"}
+	nodes[1].Labels = map[string]string{"zone": "a"}
+	nodes[2].Labels = map[string]string{"zone": "b"}
+
+	app := func(name, node, cpu, memory string) *corev1.Pod {
+		return makePodWithResources("default", name, node, corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", cpu, memory)}, nil)
+	}
+	withPhase := func(pod *corev1.Pod, phase corev1.PodPhase) *corev1.Pod {
+		pod = pod.DeepCopy()
+		pod.Status.Phase = phase
+		return pod
+	}
+	withInit := makePodWithResources("default", "init", "node-2", corev1.PodRunning,
+		[]corev1.Container{makeContainer("app", "1", "1Gi")},
+		[]corev1.Container{makeContainer("migrate", "3", "512Mi")})
+
+	type event struct {
+		name  string
+		apply func(index *AllocationIndex, store map[string]*corev1.Pod)
+	}
+	add := func(pod *corev1.Pod) func(*AllocationIndex, map[string]*corev1.Pod) {
+		return func(index *AllocationIndex, store map[string]*corev1.Pod) {
+			store[podKey(pod)] = pod
+			index.OnAdd(pod, false)
+		}
+	}
+	update := func(pod *corev1.Pod) func(*AllocationIndex, map[string]*corev1.Pod) {
+		return func(index *AllocationIndex, store map[string]*corev1.Pod) {
+			old := store[podKey(pod)]
+			store[podKey(pod)] = pod
+			index.OnUpdate(old, pod)
+		}
+	}
+	del := func(pod *corev1.Pod, tombstone bool) func(*AllocationIndex, map[string]*corev1.Pod) {
+		return func(index *AllocationIndex, store map[string]*corev1.Pod) {
+			delete(store, podKey(pod))
+			if tombstone {
+				index.OnDelete(cache.DeletedFinalStateUnknown{Key: podKey(pod), Obj: pod})
+				return
+			}
+			index.OnDelete(pod)
+		}
+	}
+
+	events := []event{
+		{name: "add pending pod", apply: add(app("web", "", "1", "1Gi"))},
+		{name: "schedule pending pod", apply: update(app("web", "node-1", "1", "1Gi"))},
+		{name: "add pods across nodes", apply: add(app("api", "node-2", "2", "4Gi"))},
+		{name: "add daemonset pod", apply: add(makeDaemonSetPod("kube-system", "ds-1", "node-1", "100m", "128Mi"))},
+		{name: "add pod with init container", apply: add(withInit)},
+		{name: "resize requests", apply: update(app("api", "node-2", "3", "6Gi"))},
+		{name: "pod succeeds", apply: update(withPhase(app("web", "node-1", "1", "1Gi"), corev1.PodSucceeded))},
+		{name: "add pod on other zone", apply: add(app("batch", "node-3", "2", "2Gi"))},
+		{name: "pod fails", apply: update(withPhase(app("batch", "node-3", "2", "2Gi"), corev1.PodFailed))},
+		{name: "delete terminated pod", apply: del(app("web", "node-1", "1", "1Gi"), false)},
+		{name: "delete via tombstone", apply: del(app("api", "node-2", "3", "6Gi"), true)},
+		{name: "resync with unchanged pod", apply: update(withInit)},
+		{name: "delete unknown pod", apply: del(app("ghost", "node-1", "1", "1Gi"), false)},
+	}
+
+	index := NewAllocationIndex(logger)
+	store := make(map[string]*corev1.Pod)
+	for _, ev := range events {
+		ev.apply(index, store)
+
+		pods := make([]*corev1.Pod, 0, len(store))
+		for _, pod := range store {
+			pods = append(pods, pod)
+		}
+		podLister := &fakePodLister{pods: pods}
+		nodeLister := &fakeNodeLister{nodes: nodes}
+
+		full := NewBinpackingCollector(nodeLister, podLister, logger, resources, labelGroups, true, nil, nil)
+		indexed := NewBinpackingCollector(nodeLister, &fakePodLister{err: fmt.Errorf("index-backed collector must not list pods")},
+			logger, resources, labelGroups, true, nil, nil, WithAllocationIndex(index))
+
+		want := renderMetrics(t, full)
+		got := renderMetrics(t, indexed)
+		if len(got) != len(want) {
+			t.Fatalf("after %q: indexed emitted %d metrics, full recompute %d", ev.name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("after %q:\n  indexed: %s\n  full:    %s", ev.name, got[i], want[i])
+			}
+		}
+	}
+}
+
+// TestAllocationIndex_Allocations verifies per-node totals and that nodes are
+// dropped once their last pod is removed.
+func TestAllocationIndex_Allocations(t *testing.T) {
+	index := NewAllocationIndex(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	app := makePodWithResources("default", "app", "node-1", corev1.PodRunning,
+		[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil)
+	ds := makeDaemonSetPod("kube-system", "ds", "node-1", "500m", "256Mi")
+	index.OnAdd(app, true)
+	index.OnAdd(ds, true)
+
+	allocations, stats := index.Allocations()
+	alloc := allocations["node-1"]
+	if got := alloc.allocatedFor(corev1.ResourceCPU); !floatEquals(got, 1.5) {
+		t.Errorf("allocated cpu = %v, want 1.5", got)
+	}
+	if got := alloc.daemonsetOverheadFor(corev1.ResourceCPU); !floatEquals(got, 0.5) {
+		t.Errorf("daemonset overhead cpu = %v, want 0.5", got)
+	}
+	if len(alloc.podKeys) != 2 {
+		t.Errorf("podKeys = %v, want 2 entries", alloc.podKeys)
+	}
+
+	if stats.counted != 2 {
+		t.Errorf("counted pods = %d, want 2", stats.counted)
+	}
+
+	// Pending and terminated pods are tracked as skipped.
+	index.OnAdd(makePodWithResources("default", "pending", "", corev1.PodPending,
+		[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil), false)
+	done := app.DeepCopy()
+	done.Status.Phase = corev1.PodSucceeded
+	index.OnUpdate(app, done)
+	if _, stats := index.Allocations(); stats.counted != 1 || stats.unscheduled != 1 || stats.terminated != 1 {
+		t.Errorf("stats = %+v, want 1 counted, 1 unscheduled, 1 terminated", stats)
+	}
+
+	index.OnDelete(done)
+	index.OnDelete(ds)
+	allocations, stats = index.Allocations()
+	if _, ok := allocations["node-1"]; ok {
+		t.Error("node should be dropped after its last pod is deleted")
+	}
+	if stats.terminated != 0 {
+		t.Errorf("terminated = %d after delete, want 0", stats.terminated)
+	}
+	// A published snapshot is not affected by later events.
+	if got := alloc.allocatedFor(corev1.ResourceCPU); !floatEquals(got, 1.5) {
+		t.Errorf("previously returned allocation changed to %v", got)
+	}
+}
+
+// TestAllocationIndex_Owns verifies a sharded index ignores pods on nodes it
+// does not own, while unscheduled pods are still tracked as skipped.
+func TestAllocationIndex_Owns(t *testing.T) {
+	index := NewAllocationIndex(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+	index.owns = func(node string) bool { return node == "node-1" }
+
+	index.OnAdd(makePodWithResources("default", "mine", "node-1", corev1.PodRunning,
+		[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil), true)
+	index.OnAdd(makePodWithResources("default", "other", "node-2", corev1.PodRunning,
+		[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil), true)
+	index.OnAdd(makePodWithResources("default", "pending", "", corev1.PodPending,
+		[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil), true)
+
+	allocations, stats := index.Allocations()
+	if _, ok := allocations["node-2"]; ok || allocations["node-1"] == nil {
+		t.Errorf("allocations = %v, want only node-1", allocations)
+	}
+	if stats.counted != 1 || stats.unscheduled != 1 {
+		t.Errorf("stats = %+v, want 1 counted and 1 unscheduled", stats)
+	}
+}
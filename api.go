@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// apiResource is one resource's binpacking values. Optional values are
+// omitted when the corresponding metric is not emitted (DaemonSet overhead
+// disabled for a label group, usage metrics disabled or unavailable).
+type apiResource struct {
+	Allocated              float64  `json:"allocated"`
+	Allocatable            float64  `json:"allocatable"`
+	UtilizationRatio       float64  `json:"utilization_ratio"`
+	DaemonsetOverhead      *float64 `json:"daemonset_overhead,omitempty"`
+	DaemonsetOverheadRatio *float64 `json:"daemonset_overhead_ratio,omitempty"`
+	Usage                  *float64 `json:"usage,omitempty"`
+	EfficiencyRatio        *float64 `json:"efficiency_ratio,omitempty"`
+}
+
+type apiCluster struct {
+	ComputedAt time.Time `json:"computed_at"`
+	// Partial is set with --sharding: cluster, node list and group values
+	// only cover this replica's nodes and must be summed across replicas.
+	Partial   bool                    `json:"partial,omitempty"`
+	NodeCount int                     `json:"node_count"`
+	Resources map[string]*apiResource `json:"resources"`
+}
+
+type apiNode struct {
+	ComputedAt time.Time               `json:"computed_at,omitzero"`
+	Name       string                  `json:"name"`
+	Resources  map[string]*apiResource `json:"resources"`
+}
+
+type apiNodeList struct {
+	ComputedAt time.Time  `json:"computed_at"`
+	Partial    bool       `json:"partial,omitempty"`
+	Nodes      []*apiNode `json:"nodes"`
+}
+
+// apiGroup is a label group, with one entry per composite label value, or a
+// selector group, with a single entry without a value.
+type apiGroup struct {
+	ComputedAt time.Time        `json:"computed_at"`
+	Partial    bool             `json:"partial,omitempty"`
+	Name       string           `json:"name"`
+	Kind       string           `json:"kind"` // "label" or "selector"
+	Values     []*apiGroupValue `json:"values"`
+}
+
+type apiGroupValue struct {
+	Value     string                  `json:"value,omitempty"`
+	NodeCount int                     `json:"node_count"`
+	Resources map[string]*apiResource `json:"resources"`
+}
+
+// binpackingView is a binpacking result as per-node, cluster and group API
+// values. It is built from the same result /metrics is rendered from.
+type binpackingView struct {
+	cluster        *apiCluster
+	nodes          map[string]*apiNode
+	labelGroups    map[string]*apiGroup
+	selectorGroups map[string]*apiGroup
+	// partial is true when the values only cover this replica's shard.
+	partial bool
+}
+
+// errBinpackingUnavailable is returned while there is no result to serve.
+var errBinpackingUnavailable = errors.New("binpacking data not available")
+
+// errNotLeader is returned on standby replicas, which compute no binpacking
+// data.
+var errNotLeader = errors.New("not the leader: binpacking data is only served by the leader replica (enable --standby-proxy to forward requests to it)")
+
+// currentView returns the current binpacking values: the latest snapshot
+// in snapshot mode, computed on request otherwise. Like Collect, it returns
+// an error on standby replicas, and instead of stale data when
+// --stale-metrics=drop.
+func (c *BinpackingCollector) currentView() (*binpackingView, error) {
+	if c.isLeader != nil && !c.isLeader.Load() {
+		return nil, errNotLeader
+	}
+	if c.staleThreshold > 0 && c.syncInfo != nil && c.dropWhenStale && c.syncInfo.IsStale(c.staleThreshold, time.Now()) {
+		return nil, errors.New("informer cache is stale")
+	}
+	snap := c.currentBinpacking()
+	if snap == nil {
+		return nil, errBinpackingUnavailable
+	}
+	return newBinpackingView(snap), nil
+}
+
+// newBinpackingView builds the API values of a snapshot's result. Label
+// groups configured in its settings are present even without nodes.
+func newBinpackingView(snap *binpackingSnapshot) *binpackingView {
+	r := snap.result
+	s := r.settings
+	view := &binpackingView{
+		cluster: &apiCluster{
+			ComputedAt: snap.computedAt,
+			Partial:    r.sharded,
+			NodeCount:  r.cluster.nodeCount,
+			Resources:  r.apiResources(s.Resources, r.cluster.byResource, true),
+		},
+		nodes:          make(map[string]*apiNode, len(r.nodes)),
+		labelGroups:    make(map[string]*apiGroup, len(s.LabelGroups)),
+		selectorGroups: make(map[string]*apiGroup, len(r.selectorGroups)),
+		partial:        r.sharded,
+	}
+	for _, node := range r.nodes {
+		view.nodes[node.name] = &apiNode{Name: node.name, Resources: r.apiResources(s.Resources, node.byResource, true)}
+	}
+
+	for _, g := range s.LabelGroups {
+		view.labelGroups[g.Name] = &apiGroup{ComputedAt: snap.computedAt, Partial: r.sharded, Name: g.Name, Kind: "label", Values: []*apiGroupValue{}}
+	}
+	// Label group values are sorted by value in the result.
+	for i := range r.labelGroups {
+		g := &r.labelGroups[i]
+		group := view.labelGroups[g.labelGroup]
+		group.Values = append(group.Values, &apiGroupValue{
+			Value:     g.labelGroupValue,
+			NodeCount: g.nodeCount,
+			Resources: r.apiResources(g.resources, g.byResource, g.daemonsetOverhead),
+		})
+	}
+	for i := range r.selectorGroups {
+		g := &r.selectorGroups[i]
+		view.selectorGroups[g.group] = &apiGroup{
+			ComputedAt: snap.computedAt,
+			Partial:    r.sharded,
+			Name:       g.group,
+			Kind:       "selector",
+			Values: []*apiGroupValue{{
+				NodeCount: g.nodeCount,
+				Resources: r.apiResources(g.resources, g.byResource, g.daemonsetOverhead),
+			}},
+		}
+	}
+	return view
+}
+
+// apiResources returns the API values of totals for each of resources, with
+// the same optional values the corresponding metrics have.
+func (r *binpackingResult) apiResources(resources []corev1.ResourceName, totals map[corev1.ResourceName]resourceTotals, daemonsetOverhead bool) map[string]*apiResource {
+	out := make(map[string]*apiResource, len(resources))
+	for _, res := range resources {
+		v := totals[res]
+		a := &apiResource{
+			Allocated:        v.allocated,
+			Allocatable:      v.allocatable,
+			UtilizationRatio: safeRatio(v.allocated, v.allocatable),
+		}
+		if daemonsetOverhead {
+			ratio := safeRatio(v.daemonsetOverhead, v.allocatable)
+			a.DaemonsetOverhead = &v.daemonsetOverhead
+			a.DaemonsetOverheadRatio = &ratio
+		}
+		if r.usage && usageResources[res] {
+			efficiency := safeRatio(v.usage, v.allocated)
+			a.Usage = &v.usage
+			a.EfficiencyRatio = &efficiency
+		}
+		out[string(res)] = a
+	}
+	return out
+}
+
+// apiError is an error with the HTTP status the API responds with.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+// binpackingSource returns the collector an API request reads from. In
+// multi-cluster mode it is chosen by the cluster query parameter.
+type binpackingSource func(r *http.Request) (*BinpackingCollector, error)
+
+// singleCollectorSource serves every request from collector.
+func singleCollectorSource(collector *BinpackingCollector) binpackingSource {
+	return func(*http.Request) (*BinpackingCollector, error) { return collector, nil }
+}
+
+// clusterSetSource serves each request from the collector of the cluster
+// named by its cluster query parameter.
+func clusterSetSource(set *ClusterSet) binpackingSource {
+	return func(r *http.Request) (*BinpackingCollector, error) {
+		name := r.URL.Query().Get("cluster")
+		if name == "" {
+			return nil, &apiError{http.StatusBadRequest, "cluster query parameter is required, one of " + strings.Join(set.Names(), ", ")}
+		}
+		for _, c := range set.clusters {
+			if c.config.Name != name {
+				continue
+			}
+			conn := c.connection()
+			if conn == nil {
+				return nil, &apiError{http.StatusServiceUnavailable, "cluster " + name + " is not connected"}
+			}
+			return conn.collector, nil
+		}
+		return nil, &apiError{http.StatusNotFound, "unknown cluster " + name}
+	}
+}
+
+// apiHandler serves the versioned JSON API under /api/v1/:
+//
+//	GET /api/v1/cluster         cluster totals
+//	GET /api/v1/nodes           every node (requires per-node metrics)
+//	GET /api/v1/nodes/{name}    one node
+//	GET /api/v1/groups/{group}  a label group or selector group by name
+//
+// Values come from the same binpacking result the collector serves on
+// /metrics. With --sharding, responses other than single nodes are marked
+// partial. A label group takes precedence over a selector group of the same
+// name.
+func apiHandler(source binpackingSource) http.Handler {
+	mux := http.NewServeMux()
+	view := func(w http.ResponseWriter, r *http.Request) *binpackingView {
+		collector, err := source(r)
+		if err == nil {
+			var v *binpackingView
+			if v, err = collector.currentView(); err == nil {
+				return v
+			}
+			err = &apiError{http.StatusServiceUnavailable, err.Error()}
+		}
+		writeAPIError(w, err)
+		return nil
+	}
+	nodeMetricsEnabled := func(w http.ResponseWriter, r *http.Request) bool {
+		collector, err := source(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return false
+		}
+		if !collector.Settings().EnableNodeMetrics {
+			writeAPIError(w, &apiError{http.StatusNotFound, "per-node metrics are disabled (--disable-node-metrics)"})
+			return false
+		}
+		return true
+	}
+
+	mux.HandleFunc("GET /api/v1/cluster", func(w http.ResponseWriter, r *http.Request) {
+		if v := view(w, r); v != nil {
+			writeAPIJSON(w, v.cluster)
+		}
+	})
+	mux.HandleFunc("GET /api/v1/nodes", func(w http.ResponseWriter, r *http.Request) {
+		if !nodeMetricsEnabled(w, r) {
+			return
+		}
+		v := view(w, r)
+		if v == nil {
+			return
+		}
+		list := apiNodeList{ComputedAt: v.cluster.ComputedAt, Partial: v.partial, Nodes: []*apiNode{}}
+		for _, node := range v.nodes {
+			list.Nodes = append(list.Nodes, node)
+		}
+		slices.SortFunc(list.Nodes, func(a, b *apiNode) int { return strings.Compare(a.Name, b.Name) })
+		writeAPIJSON(w, list)
+	})
+	mux.HandleFunc("GET /api/v1/nodes/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if !nodeMetricsEnabled(w, r) {
+			return
+		}
+		v := view(w, r)
+		if v == nil {
+			return
+		}
+		node, ok := v.nodes[r.PathValue("name")]
+		if !ok {
+			msg := "unknown node " + r.PathValue("name")
+			if v.partial {
+				msg += " (not found among this replica's shard)"
+			}
+			writeAPIError(w, &apiError{http.StatusNotFound, msg})
+			return
+		}
+		node.ComputedAt = v.cluster.ComputedAt
+		writeAPIJSON(w, node)
+	})
+	// Label group names may contain slashes (topology.kubernetes.io/zone).
+	mux.HandleFunc("GET /api/v1/groups/{group...}", func(w http.ResponseWriter, r *http.Request) {
+		v := view(w, r)
+		if v == nil {
+			return
+		}
+		name := r.PathValue("group")
+		group, ok := v.labelGroups[name]
+		if !ok {
+			group, ok = v.selectorGroups[name]
+		}
+		if !ok {
+			writeAPIError(w, &apiError{http.StatusNotFound, "unknown group " + name})
+			return
+		}
+		writeAPIJSON(w, group)
+	})
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, &apiError{http.StatusNotFound, "unknown endpoint " + r.URL.Path})
+	})
+	return mux
+}
+
+func writeAPIJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// writeAPIError responds with {"error": "..."} and the error's status, 500
+// for errors other than apiError.
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		status = apiErr.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// getAPI serves a GET for path and decodes the JSON response into out.
+func getAPI(t *testing.T, handler http.Handler, path string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("GET %s Content-Type = %q, want application/json", path, ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("GET %s: decoding %q: %v", path, rec.Body.String(), err)
+	}
+	return rec.Code
+}
+
+// newAPITestCollector returns a collector over two nodes in different zones,
+// grouped by zone and by a selector group, with 1 CPU requested on node-a.
+func newAPITestCollector(opts ...CollectorOption) *BinpackingCollector {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	nodeA := makeNode("node-a", "4", "8Gi")
+	nodeA.Labels = map[string]string{"topology.kubernetes.io/zone": "a"}
+	nodeB := makeNode("node-b", "8", "16Gi")
+	nodeB.Labels = map[string]string{"topology.kubernetes.io/zone": "b"}
+	pods := []*corev1.Pod{
+		makePodWithResources("default", "app", "node-a", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil),
+	}
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: []*corev1.Node{nodeA, nodeB}}, &fakePodLister{pods: pods}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, []LabelGroup{newLabelGroup("topology.kubernetes.io/zone")}, true, nil, nil, opts...)
+	zoneA, _ := labels.Parse("topology.kubernetes.io/zone=a")
+	s := collector.Settings()
+	s.SelectorGroups = []SelectorGroup{{Name: "zone-a", Selector: zoneA}}
+	collector.Reconfigure(s)
+	return collector
+}
+
+// TestAPIHandler verifies the API serves the same values as the collected
+// metrics for the cluster, nodes, label groups and selector groups.
+func TestAPIHandler(t *testing.T) {
+	collector := newAPITestCollector()
+	handler := apiHandler(singleCollectorSource(collector))
+	metrics := collectMetrics(collector)
+
+	var cluster apiCluster
+	if code := getAPI(t, handler, "/api/v1/cluster", &cluster); code != http.StatusOK {
+		t.Fatalf("GET /api/v1/cluster status = %d", code)
+	}
+	cpu := cluster.Resources["cpu"]
+	if cluster.NodeCount != 2 || cpu == nil || cpu.Allocated != 1 || cpu.Allocatable != 12 {
+		t.Fatalf("cluster = %+v, cpu = %+v, want 2 nodes, 1 of 12 CPU allocated", cluster, cpu)
+	}
+	if want, _ := findMetricValue(t, metrics, "kube_binpacking_cluster_utilization_ratio", map[string]string{"resource": "cpu"}); cpu.UtilizationRatio != want {
+		t.Errorf("cluster utilization_ratio = %v, want %v", cpu.UtilizationRatio, want)
+	}
+	if cpu.DaemonsetOverhead == nil || *cpu.DaemonsetOverhead != 0 || cpu.Usage != nil {
+		t.Errorf("cluster cpu = %+v, want daemonset_overhead 0 and no usage", cpu)
+	}
+	if cluster.ComputedAt.IsZero() {
+		t.Error("computed_at should be set")
+	}
+
+	var list apiNodeList
+	if code := getAPI(t, handler, "/api/v1/nodes", &list); code != http.StatusOK || len(list.Nodes) != 2 {
+		t.Fatalf("GET /api/v1/nodes = %d, %d nodes, want 200 and 2 nodes", code, len(list.Nodes))
+	}
+	if list.Nodes[0].Name != "node-a" || list.Nodes[1].Name != "node-b" {
+		t.Errorf("nodes = %s, %s, want sorted by name", list.Nodes[0].Name, list.Nodes[1].Name)
+	}
+
+	var node apiNode
+	if code := getAPI(t, handler, "/api/v1/nodes/node-a", &node); code != http.StatusOK {
+		t.Fatalf("GET /api/v1/nodes/node-a status = %d", code)
+	}
+	if r := node.Resources["cpu"]; r == nil || r.Allocated != 1 || r.Allocatable != 4 || r.UtilizationRatio != 0.25 {
+		t.Errorf("node-a cpu = %+v, want 1 of 4 allocated", r)
+	}
+
+	var group apiGroup
+	if code := getAPI(t, handler, "/api/v1/groups/topology.kubernetes.io/zone", &group); code != http.StatusOK {
+		t.Fatalf("GET label group status = %d", code)
+	}
+	if group.Kind != "label" || len(group.Values) != 2 || group.Values[0].Value != "a" || group.Values[1].Value != "b" {
+		t.Fatalf("label group = %+v, want values a and b", group)
+	}
+	if v := group.Values[1]; v.NodeCount != 1 || v.Resources["cpu"].Allocatable != 8 {
+		t.Errorf("zone b = %+v, want 1 node with 8 CPU", v)
+	}
+
+	if code := getAPI(t, handler, "/api/v1/groups/zone-a", &group); code != http.StatusOK {
+		t.Fatalf("GET selector group status = %d", code)
+	}
+	if group.Kind != "selector" || len(group.Values) != 1 || group.Values[0].NodeCount != 1 || group.Values[0].Resources["cpu"].Allocated != 1 {
+		t.Errorf("selector group = %+v, want one value with node-a", group)
+	}
+
+	for _, path := range []string{"/api/v1/nodes/missing", "/api/v1/groups/missing", "/api/v1/unknown"} {
+		var apiErr map[string]string
+		if code := getAPI(t, handler, path, &apiErr); code != http.StatusNotFound || apiErr["error"] == "" {
+			t.Errorf("GET %s = %d, %v, want 404 with an error", path, code, apiErr)
+		}
+	}
+
+	t.Run("node metrics disabled", func(t *testing.T) {
+		s := collector.Settings()
+		s.EnableNodeMetrics = false
+		collector.Reconfigure(s)
+		defer func() {
+			s.EnableNodeMetrics = true
+			collector.Reconfigure(s)
+		}()
+		var apiErr map[string]string
+		if code := getAPI(t, handler, "/api/v1/nodes", &apiErr); code != http.StatusNotFound {
+			t.Errorf("GET /api/v1/nodes = %d, want 404", code)
+		}
+		if code := getAPI(t, handler, "/api/v1/cluster", &cluster); code != http.StatusOK {
+			t.Errorf("GET /api/v1/cluster = %d, want 200", code)
+		}
+	})
+}
+
+// TestAPIHandler_SnapshotMode verifies the API serves the latest snapshot,
+// and 503 before the first one.
+func TestAPIHandler_SnapshotMode(t *testing.T) {
+	collector := newAPITestCollector(WithSnapshotInterval(time.Minute))
+	handler := apiHandler(singleCollectorSource(collector))
+	collector.snapshot.Store(nil) // Reconfigure computed one
+
+	var apiErr map[string]string
+	if code := getAPI(t, handler, "/api/v1/cluster", &apiErr); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /api/v1/cluster before the first snapshot = %d, want 503", code)
+	}
+
+	collector.refreshSnapshot()
+	var cluster apiCluster
+	if code := getAPI(t, handler, "/api/v1/cluster", &cluster); code != http.StatusOK {
+		t.Fatalf("GET /api/v1/cluster status = %d", code)
+	}
+	if !cluster.ComputedAt.Equal(collector.snapshot.Load().computedAt) {
+		t.Errorf("computed_at = %v, want the snapshot's %v", cluster.ComputedAt, collector.snapshot.Load().computedAt)
+	}
+}
+
+// TestAPIHandler_Standby verifies standby replicas answer 503 "not the
+// leader", in both snapshot and per-request mode.
+func TestAPIHandler_Standby(t *testing.T) {
+	for _, opts := range [][]CollectorOption{nil, {WithSnapshotInterval(time.Minute)}} {
+		collector := newAPITestCollector(opts...)
+		collector.isLeader = new(atomic.Bool)
+		handler := apiHandler(singleCollectorSource(collector))
+
+		var apiErr map[string]string
+		if code := getAPI(t, handler, "/api/v1/cluster", &apiErr); code != http.StatusServiceUnavailable || !strings.Contains(apiErr["error"], "not the leader") {
+			t.Errorf("GET /api/v1/cluster on a standby = %d, %v, want 503 not the leader", code, apiErr)
+		}
+
+		collector.isLeader.Store(true)
+		collector.refreshIfLeader()
+		var cluster apiCluster
+		if code := getAPI(t, handler, "/api/v1/cluster", &cluster); code != http.StatusOK {
+			t.Errorf("GET /api/v1/cluster on the leader = %d, want 200", code)
+		}
+	}
+}
+
+// TestAPIHandler_CollectMetrics verifies API requests computed on demand are
+// not recorded in the collect self-metrics, which track scrapes only.
+func TestAPIHandler_CollectMetrics(t *testing.T) {
+	m := NewExporterMetrics(prometheus.NewRegistry(), false)
+	collector := newAPITestCollector(WithExporterMetrics(m))
+	handler := apiHandler(singleCollectorSource(collector))
+
+	var cluster apiCluster
+	if code := getAPI(t, handler, "/api/v1/cluster", &cluster); code != http.StatusOK {
+		t.Fatalf("GET /api/v1/cluster status = %d", code)
+	}
+	if got := testutil.ToFloat64(m.nodesProcessed); got != 0 {
+		t.Errorf("nodes_processed after an API request = %v, want 0", got)
+	}
+
+	collectMetrics(collector)
+	if got := testutil.ToFloat64(m.nodesProcessed); got != 2 {
+		t.Errorf("nodes_processed after a scrape = %v, want 2", got)
+	}
+}
+
+// TestAPIHandler_Sharded verifies responses covering more than one node are
+// marked partial with --sharding.
+func TestAPIHandler_Sharded(t *testing.T) {
+	shard := newTestShard(t, fake.NewClientset(), "replica-a")
+	if err := shard.heartbeat(context.Background()); err != nil {
+		t.Fatalf("heartbeat() error = %v", err)
+	}
+	handler := apiHandler(singleCollectorSource(newAPITestCollector(WithShard(shard, nil))))
+
+	var cluster apiCluster
+	if code := getAPI(t, handler, "/api/v1/cluster", &cluster); code != http.StatusOK || !cluster.Partial {
+		t.Errorf("GET /api/v1/cluster = %d, partial %v, want 200 and partial", code, cluster.Partial)
+	}
+	var list apiNodeList
+	if code := getAPI(t, handler, "/api/v1/nodes", &list); code != http.StatusOK || !list.Partial {
+		t.Errorf("GET /api/v1/nodes = %d, partial %v, want 200 and partial", code, list.Partial)
+	}
+	for _, path := range []string{"/api/v1/groups/topology.kubernetes.io/zone", "/api/v1/groups/zone-a"} {
+		var group apiGroup
+		if code := getAPI(t, handler, path, &group); code != http.StatusOK || !group.Partial {
+			t.Errorf("GET %s = %d, partial %v, want 200 and partial", path, code, group.Partial)
+		}
+	}
+
+	unsharded := apiHandler(singleCollectorSource(newAPITestCollector()))
+	var full apiCluster
+	if getAPI(t, unsharded, "/api/v1/cluster", &full); full.Partial {
+		t.Error("unsharded cluster should not be partial")
+	}
+}
+
+// TestClusterSetSource verifies cluster selection in multi-cluster mode.
+func TestClusterSetSource(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	set := NewClusterSet([]ClusterConfig{{Name: "up"}, {Name: "down"}}, nil, prometheus.NewRegistry(), "", CollectorSettings{}, logger)
+	set.clusters[0].conn = &clusterConn{collector: newAPITestCollector()}
+	handler := apiHandler(clusterSetSource(set))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/api/v1/cluster?cluster=up", want: http.StatusOK},
+		{path: "/api/v1/cluster", want: http.StatusBadRequest},
+		{path: "/api/v1/cluster?cluster=down", want: http.StatusServiceUnavailable},
+		{path: "/api/v1/cluster?cluster=other", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		var body map[string]any
+		if code := getAPI(t, handler, tt.path, &body); code != tt.want {
+			t.Errorf("GET %s = %d, want %d (%v)", tt.path, code, tt.want, body)
+		}
+	}
+}
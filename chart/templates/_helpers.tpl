@@ -52,10 +52,20 @@ Create the name of the service account to use.
 {{/*
 Whether leader election should be active.
 Auto-enabled when replicaCount > 1 (to prevent duplicate metrics),
-or explicitly via leaderElection.enabled.
+or explicitly via leaderElection.enabled. Never active with sharding,
+which prevents duplicates by splitting nodes instead.
 */}}
 {{- define "kube-binpacking-exporter.leaderElectionEnabled" -}}
-{{- if or .Values.leaderElection.enabled (gt (int .Values.replicaCount) 1) -}}
+{{- if and (not .Values.sharding.enabled) (or .Values.leaderElection.enabled (gt (int .Values.replicaCount) 1)) -}}
+true
+{{- end -}}
+{{- end }}
+
+{{/*
+Whether the exporter needs access to Lease objects (leader election or sharding).
+*/}}
+{{- define "kube-binpacking-exporter.leasesEnabled" -}}
+{{- if or (include "kube-binpacking-exporter.leaderElectionEnabled" .) .Values.sharding.enabled -}}
 true
 {{- end -}}
 {{- end }}
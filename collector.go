@@ -1,9 +1,12 @@
 package main
 
 import (
-	"context"
 	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,114 +16,383 @@ import (
 	listerscorev1 "k8s.io/client-go/listers/core/v1"
 )
 
-var (
-	nodeAllocated = prometheus.NewDesc(
-		"kube_binpacking_node_allocated",
-		"Total resource requested by pods on this node",
-		[]string{"node", "resource"}, nil,
-	)
-	nodeAllocatable = prometheus.NewDesc(
-		"kube_binpacking_node_allocatable",
-		"Total allocatable resource on this node",
-		[]string{"node", "resource"}, nil,
-	)
-	nodeUtilization = prometheus.NewDesc(
-		"kube_binpacking_node_utilization_ratio",
-		"Ratio of allocated to allocatable (0.0-1.0+)",
-		[]string{"node", "resource"}, nil,
-	)
-	clusterAllocated = prometheus.NewDesc(
-		"kube_binpacking_cluster_allocated",
-		"Cluster-wide total resource requested",
-		[]string{"resource"}, nil,
-	)
-	clusterAllocatable = prometheus.NewDesc(
-		"kube_binpacking_cluster_allocatable",
-		"Cluster-wide total allocatable resource",
-		[]string{"resource"}, nil,
-	)
-	clusterUtilization = prometheus.NewDesc(
-		"kube_binpacking_cluster_utilization_ratio",
-		"Cluster-wide allocation ratio",
-		[]string{"resource"}, nil,
-	)
-	groupAllocated = prometheus.NewDesc(
-		"kube_binpacking_group_allocated",
-		"Total resource requested by pods on nodes in this label group",
-		[]string{"label_group", "label_group_value", "resource"}, nil,
-	)
-	groupAllocatable = prometheus.NewDesc(
-		"kube_binpacking_group_allocatable",
-		"Total allocatable resource on nodes in this label group",
-		[]string{"label_group", "label_group_value", "resource"}, nil,
-	)
-	groupUtilization = prometheus.NewDesc(
-		"kube_binpacking_group_utilization_ratio",
-		"Ratio of allocated to allocatable for nodes in this label group (0.0-1.0+)",
-		[]string{"label_group", "label_group_value", "resource"}, nil,
-	)
-	groupNodeCount = prometheus.NewDesc(
-		"kube_binpacking_group_node_count",
-		"Number of nodes in this label group",
-		[]string{"label_group", "label_group_value"}, nil,
-	)
-	nodeDaemonsetOverhead = prometheus.NewDesc(
-		"kube_binpacking_node_daemonset_overhead",
-		"Total resource requested by DaemonSet pods on this node",
-		[]string{"node", "resource"}, nil,
-	)
-	nodeDaemonsetOverheadRatio = prometheus.NewDesc(
-		"kube_binpacking_node_daemonset_overhead_ratio",
-		"Ratio of DaemonSet overhead to allocatable (0.0-1.0+)",
-		[]string{"node", "resource"}, nil,
-	)
-	clusterDaemonsetOverhead = prometheus.NewDesc(
-		"kube_binpacking_cluster_daemonset_overhead",
-		"Cluster-wide total resource requested by DaemonSet pods",
-		[]string{"resource"}, nil,
-	)
-	clusterDaemonsetOverheadRatio = prometheus.NewDesc(
-		"kube_binpacking_cluster_daemonset_overhead_ratio",
-		"Cluster-wide DaemonSet overhead ratio",
-		[]string{"resource"}, nil,
-	)
-	groupDaemonsetOverhead = prometheus.NewDesc(
-		"kube_binpacking_group_daemonset_overhead",
-		"Total resource requested by DaemonSet pods on nodes in this label group",
-		[]string{"label_group", "label_group_value", "resource"}, nil,
-	)
-	groupDaemonsetOverheadRatio = prometheus.NewDesc(
-		"kube_binpacking_group_daemonset_overhead_ratio",
-		"Ratio of DaemonSet overhead to allocatable for nodes in this label group (0.0-1.0+)",
-		[]string{"label_group", "label_group_value", "resource"}, nil,
-	)
-	clusterNodeCount = prometheus.NewDesc(
-		"kube_binpacking_cluster_node_count",
-		"Total number of nodes in the cluster",
-		nil, nil,
-	)
-	cacheAge = prometheus.NewDesc(
-		"kube_binpacking_cache_age_seconds",
-		"Time since last informer cache sync",
-		nil, nil,
-	)
-	leaderStatus = prometheus.NewDesc(
-		"kube_binpacking_leader_status",
-		"Whether this instance is the leader (1) or standby (0). Only present when leader election is enabled",
-		nil, nil,
-	)
-)
+// defaultMetricNamespace prefixes every binpacking metric name unless
+// overridden with --metric-namespace.
+const defaultMetricNamespace = "kube_binpacking"
+
+// descriptors are the binpacking metric descriptors. They are built per
+// collector, so the metric namespace and constant labels are configurable.
+type descriptors struct {
+	// variableLabels are the label names used by any descriptor, which
+	// constant labels must not reuse.
+	variableLabels map[string]bool
+
+	nodeAllocated                 *prometheus.Desc
+	nodeAllocatable               *prometheus.Desc
+	nodeUtilization               *prometheus.Desc
+	clusterAllocated              *prometheus.Desc
+	clusterAllocatable            *prometheus.Desc
+	clusterUtilization            *prometheus.Desc
+	groupAllocated                *prometheus.Desc
+	groupAllocatable              *prometheus.Desc
+	groupUtilization              *prometheus.Desc
+	groupNodeCount                *prometheus.Desc
+	nodeDaemonsetOverhead         *prometheus.Desc
+	nodeDaemonsetOverheadRatio    *prometheus.Desc
+	clusterDaemonsetOverhead      *prometheus.Desc
+	clusterDaemonsetOverheadRatio *prometheus.Desc
+	groupDaemonsetOverhead        *prometheus.Desc
+	groupDaemonsetOverheadRatio   *prometheus.Desc
+	clusterNodeCount              *prometheus.Desc
+	cacheAge                      *prometheus.Desc
+	informerLastEvent             *prometheus.Desc
+	informerLastResync            *prometheus.Desc
+	cacheStale                    *prometheus.Desc
+	informerWatchReconnects       *prometheus.Desc
+	shardMembers                  *prometheus.Desc
+	shardOwnedNodes               *prometheus.Desc
+	leaderStatus                  *prometheus.Desc
+	nodeUsage                     *prometheus.Desc
+	nodeEfficiency                *prometheus.Desc
+	clusterUsage                  *prometheus.Desc
+	clusterEfficiency             *prometheus.Desc
+	groupUsage                    *prometheus.Desc
+	groupEfficiency               *prometheus.Desc
+	usageAvailable                *prometheus.Desc
+	clusterHourlyCost             *prometheus.Desc
+	clusterUnallocatedCost        *prometheus.Desc
+	clusterDaemonsetOverheadCost  *prometheus.Desc
+	clusterUnpricedNodeCount      *prometheus.Desc
+	groupHourlyCost               *prometheus.Desc
+	groupUnallocatedCost          *prometheus.Desc
+	groupDaemonsetOverheadCost    *prometheus.Desc
+	groupHeadroomSurplus          *prometheus.Desc
+	groupHeadroomTargetMet        *prometheus.Desc
+	snapshotAge                   *prometheus.Desc
+	snapshotComputeDuration       *prometheus.Desc
+}
+
+// newDescriptors builds the descriptors with namespace as the metric name
+// prefix and constLabels added to every metric.
+func newDescriptors(namespace string, constLabels prometheus.Labels) *descriptors {
+	used := make(map[string]bool)
+	desc := func(name, help string, variableLabels ...string) *prometheus.Desc {
+		for _, l := range variableLabels {
+			used[l] = true
+		}
+		return prometheus.NewDesc(namespace+"_"+name, help, variableLabels, constLabels)
+	}
+	return &descriptors{
+		variableLabels: used,
+		nodeAllocated: desc("node_allocated",
+			"Total resource requested by pods on this node",
+			"node", "resource"),
+		nodeAllocatable: desc("node_allocatable",
+			"Total allocatable resource on this node",
+			"node", "resource"),
+		nodeUtilization: desc("node_utilization_ratio",
+			"Ratio of allocated to allocatable (0.0-1.0+)",
+			"node", "resource"),
+		clusterAllocated: desc("cluster_allocated",
+			"Cluster-wide total resource requested",
+			"resource"),
+		clusterAllocatable: desc("cluster_allocatable",
+			"Cluster-wide total allocatable resource",
+			"resource"),
+		clusterUtilization: desc("cluster_utilization_ratio",
+			"Cluster-wide allocation ratio",
+			"resource"),
+		groupAllocated: desc("group_allocated",
+			"Total resource requested by pods on nodes in this label group",
+			"label_group", "label_group_value", "group", "resource"),
+		groupAllocatable: desc("group_allocatable",
+			"Total allocatable resource on nodes in this label group",
+			"label_group", "label_group_value", "group", "resource"),
+		groupUtilization: desc("group_utilization_ratio",
+			"Ratio of allocated to allocatable for nodes in this label group (0.0-1.0+)",
+			"label_group", "label_group_value", "group", "resource"),
+		groupNodeCount: desc("group_node_count",
+			"Number of nodes in this label group",
+			"label_group", "label_group_value", "group"),
+		nodeDaemonsetOverhead: desc("node_daemonset_overhead",
+			"Total resource requested by DaemonSet pods on this node",
+			"node", "resource"),
+		nodeDaemonsetOverheadRatio: desc("node_daemonset_overhead_ratio",
+			"Ratio of DaemonSet overhead to allocatable (0.0-1.0+)",
+			"node", "resource"),
+		clusterDaemonsetOverhead: desc("cluster_daemonset_overhead",
+			"Cluster-wide total resource requested by DaemonSet pods",
+			"resource"),
+		clusterDaemonsetOverheadRatio: desc("cluster_daemonset_overhead_ratio",
+			"Cluster-wide DaemonSet overhead ratio",
+			"resource"),
+		groupDaemonsetOverhead: desc("group_daemonset_overhead",
+			"Total resource requested by DaemonSet pods on nodes in this label group",
+			"label_group", "label_group_value", "group", "resource"),
+		groupDaemonsetOverheadRatio: desc("group_daemonset_overhead_ratio",
+			"Ratio of DaemonSet overhead to allocatable for nodes in this label group (0.0-1.0+)",
+			"label_group", "label_group_value", "group", "resource"),
+		clusterNodeCount: desc("cluster_node_count",
+			"Total number of nodes in the cluster"),
+		cacheAge: desc("cache_age_seconds",
+			"Time since the least recently active informer last received a watch event or resync"),
+		informerLastEvent: desc("informer_last_event_timestamp_seconds",
+			"Unix time of the last watch event received by the informer (0 if none yet)",
+			"kind"),
+		informerLastResync: desc("informer_last_resync_timestamp_seconds",
+			"Unix time of the last resync observed by the informer (0 if none yet)",
+			"kind"),
+		cacheStale: desc("cache_stale",
+			"Whether the cache age exceeds the stale threshold (1) or not (0). Only present when --stale-threshold is set"),
+		informerWatchReconnects: desc("informer_watch_reconnects_total",
+			"Number of times the informer re-established its watch",
+			"kind"),
+		shardMembers: desc("shard_members",
+			"Number of live replicas sharing nodes with this one. Only present when sharding is enabled"),
+		shardOwnedNodes: desc("shard_owned_nodes",
+			"Number of nodes assigned to this replica. Only present when sharding is enabled"),
+		leaderStatus: desc("leader_status",
+			"Whether this instance is the leader (1) or standby (0). Only present when leader election is enabled"),
+		nodeUsage: desc("node_usage",
+			"Total resource usage of pods on this node, from the metrics.k8s.io API",
+			"node", "resource"),
+		nodeEfficiency: desc("node_efficiency_ratio",
+			"Ratio of usage to allocated (requests) for pods on this node",
+			"node", "resource"),
+		clusterUsage: desc("cluster_usage",
+			"Cluster-wide total resource usage of pods, from the metrics.k8s.io API",
+			"resource"),
+		clusterEfficiency: desc("cluster_efficiency_ratio",
+			"Cluster-wide ratio of usage to allocated (requests)",
+			"resource"),
+		groupUsage: desc("group_usage",
+			"Total resource usage of pods on nodes in this label group, from the metrics.k8s.io API",
+			"label_group", "label_group_value", "group", "resource"),
+		groupEfficiency: desc("group_efficiency_ratio",
+			"Ratio of usage to allocated (requests) for nodes in this label group",
+			"label_group", "label_group_value", "group", "resource"),
+		usageAvailable: desc("usage_metrics_available",
+			"Whether usage data from the metrics.k8s.io API is available (1) or not (0). Only present when usage metrics are enabled"),
+		clusterHourlyCost: desc("cluster_hourly_cost",
+			"Cluster-wide total hourly cost of nodes, from the pricing table"),
+		clusterUnallocatedCost: desc("cluster_unallocated_hourly_cost",
+			"Cluster-wide hourly cost of unallocated capacity, attributing each node's full price to each resource",
+			"resource"),
+		clusterDaemonsetOverheadCost: desc("cluster_daemonset_overhead_hourly_cost",
+			"Cluster-wide hourly cost attributable to DaemonSet overhead, attributing each node's full price to each resource",
+			"resource"),
+		clusterUnpricedNodeCount: desc("cluster_unpriced_node_count",
+			"Number of nodes without a matching entry in the pricing table (counted as zero cost)"),
+		groupHourlyCost: desc("group_hourly_cost",
+			"Total hourly cost of nodes in this label group, from the pricing table",
+			"label_group", "label_group_value", "group"),
+		groupUnallocatedCost: desc("group_unallocated_hourly_cost",
+			"Hourly cost of unallocated capacity on nodes in this label group",
+			"label_group", "label_group_value", "group", "resource"),
+		groupDaemonsetOverheadCost: desc("group_daemonset_overhead_hourly_cost",
+			"Hourly cost attributable to DaemonSet overhead on nodes in this label group",
+			"label_group", "label_group_value", "group", "resource"),
+		groupHeadroomSurplus: desc("group_headroom_surplus",
+			"Free capacity (allocatable - allocated) minus the headroom target for nodes in this label group; negative when below target",
+			"label_group", "label_group_value", "group", "resource"),
+		groupHeadroomTargetMet: desc("group_headroom_target_met",
+			"Whether free capacity in this label group meets the headroom target (1) or not (0)",
+			"label_group", "label_group_value", "group", "resource"),
+		snapshotAge: desc("snapshot_age_seconds",
+			"Time since the served binpacking snapshot was computed. Only present in snapshot mode"),
+		snapshotComputeDuration: desc("snapshot_compute_duration_seconds",
+			"Time taken to compute the served binpacking snapshot. Only present in snapshot mode"),
+	}
+}
 
 // BinpackingCollector implements prometheus.Collector using informer caches.
 type BinpackingCollector struct {
-	nodeLister        listerscorev1.NodeLister
-	podLister         listerscorev1.PodLister
-	logger            *slog.Logger
-	resources         []corev1.ResourceName
-	labelGroups       [][]string
-	enableNodeMetrics bool
-	syncInfo          *SyncInfo
-	isLeader          *atomic.Bool // nil = leader election disabled (always emit); non-nil = check value
+	nodeLister       listerscorev1.NodeLister
+	podLister        listerscorev1.PodLister
+	logger           *slog.Logger
+	desc             *descriptors
+	settings         atomic.Pointer[CollectorSettings]
+	syncInfo         *SyncInfo
+	isLeader         *atomic.Bool     // nil = leader election disabled (always emit); non-nil = check value
+	usage            *UsageTracker    // nil = usage metrics disabled
+	index            allocationSource // nil = recompute allocations from the pod lister on every scrape
+	snapshotInterval time.Duration    // 0 = compute on every scrape
+	exporterMetrics  *ExporterMetrics // nil = no self-observability metrics
+	staleThreshold   time.Duration    // 0 = staleness not checked
+	dropWhenStale    bool
+	shard            *ShardMembership // nil = every node is collected by this instance
+	shardCached      func() []string  // member list of the pod cache; nil = latest membership
+	snapshot         atomic.Pointer[binpackingSnapshot]
+	snapshotMu       sync.Mutex // serializes snapshot refreshes
+}
+
+// HeadroomTargets maps a label group name to the free capacity required per
+// resource in each of that group's values.
+type HeadroomTargets map[string]map[corev1.ResourceName]float64
+
+// LabelGroup is a combination of node label keys that nodes are grouped by.
+// Keys starting with @ are node fields instead (see nodeKeyValue). Name is the
+// label_group label value; for groups given as --label-group it is the
+// comma-joined keys.
+type LabelGroup struct {
+	Name string
+	Keys []string
+	// Resources overrides the tracked resources for this group; nil uses
+	// CollectorSettings.Resources.
+	Resources []corev1.ResourceName
+	// NodeSelector restricts the group to matching nodes; nil matches all.
+	NodeSelector labels.Selector
+	// DisableDaemonsetOverhead skips the group's DaemonSet overhead metrics.
+	DisableDaemonsetOverhead bool
+	// Relabel rewrites label values before the composite value is built.
+	Relabel []RelabelRule
+	// DefaultValue replaces a missing label; empty means "<none>".
+	DefaultValue string
+}
+
+// RelabelRule rewrites the value of one label key, Prometheus style: if the
+// anchored Regex matches, the value becomes Replacement with $1-style
+// references expanded; otherwise it is left unchanged.
+type RelabelRule struct {
+	Key         string
+	Regex       *regexp.Regexp
+	Replacement string
+}
+
+// compositeValue returns the node's value for the group: each key's label
+// (or node field) value after relabeling, joined with commas. Missing values,
+// and values relabeled to empty, become the group's default value.
+func (g *LabelGroup) compositeValue(node *corev1.Node, now time.Time) string {
+	values := make([]string, len(g.Keys))
+	for i, key := range g.Keys {
+		v, ok := nodeKeyValue(node, key, now)
+		if ok {
+			for _, rule := range g.Relabel {
+				if rule.Key != key {
+					continue
+				}
+				if match := rule.Regex.FindStringSubmatchIndex(v); match != nil {
+					v = string(rule.Regex.ExpandString(nil, rule.Replacement, v, match))
+					if v == "" {
+						ok = false
+						break
+					}
+				}
+			}
+		}
+		if !ok {
+			v = g.DefaultValue
+			if v == "" {
+				v = "<none>"
+			}
+		}
+		values[i] = v
+	}
+	return strings.Join(values, ",")
+}
+
+// newLabelGroup returns a group over keys named after them, with the global
+// resources and no node selector.
+func newLabelGroup(keys ...string) LabelGroup {
+	return LabelGroup{Name: strings.Join(keys, ","), Keys: keys}
+}
+
+// resources returns the resources tracked for the group.
+func (g *LabelGroup) resources(defaults []corev1.ResourceName) []corev1.ResourceName {
+	if g.Resources != nil {
+		return g.Resources
+	}
+	return defaults
+}
+
+// SelectorGroup is a named set of nodes matching a label selector. Unlike
+// label groups, a node can belong to several selector groups.
+type SelectorGroup struct {
+	Name     string
+	Selector labels.Selector
+}
+
+// CollectorSettings are the collector options that can be changed at runtime
+// with Reconfigure.
+type CollectorSettings struct {
+	Resources         []corev1.ResourceName
+	LabelGroups       []LabelGroup
+	SelectorGroups    []SelectorGroup
+	EnableNodeMetrics bool
+	HeadroomTargets   HeadroomTargets
+	Pricing           *PricingTable // nil = cost metrics disabled
+}
+
+// Settings returns the settings currently in effect.
+func (c *BinpackingCollector) Settings() CollectorSettings {
+	return *c.settings.Load()
+}
+
+// Reconfigure replaces the collector settings. Scrapes in progress finish
+// with the previous settings; in snapshot mode the leader recomputes the
+// snapshot immediately rather than at the next interval.
+func (c *BinpackingCollector) Reconfigure(s CollectorSettings) {
+	c.settings.Store(&s)
+	if c.snapshotInterval > 0 {
+		c.refreshIfLeader()
+	}
+}
+
+// CollectorOption configures optional BinpackingCollector features.
+type CollectorOption func(*BinpackingCollector)
+
+// WithUsageTracker enables usage and efficiency metrics backed by the metrics.k8s.io API.
+func WithUsageTracker(u *UsageTracker) CollectorOption {
+	return func(c *BinpackingCollector) {
+		c.usage = u
+	}
+}
+
+// WithStaleThreshold emits kube_binpacking_cache_stale, and when drop is
+// true stops emitting binpacking metrics while the cache age exceeds the
+// threshold, so dashboards show gaps instead of frozen data.
+func WithStaleThreshold(threshold time.Duration, drop bool) CollectorOption {
+	return func(c *BinpackingCollector) {
+		c.staleThreshold = threshold
+		c.dropWhenStale = drop
+	}
+}
+
+// WithExporterMetrics records collection self-metrics (duration, objects
+// processed, skipped pods) into m.
+func WithExporterMetrics(m *ExporterMetrics) CollectorOption {
+	return func(c *BinpackingCollector) {
+		c.exporterMetrics = m
+	}
+}
+
+// WithMetricNamespace replaces the kube_binpacking metric name prefix and
+// adds constLabels to every binpacking metric.
+func WithMetricNamespace(namespace string, constLabels prometheus.Labels) CollectorOption {
+	return func(c *BinpackingCollector) {
+		c.desc = newDescriptors(namespace, constLabels)
+	}
+}
+
+// WithShard restricts collection to the nodes assigned to this replica.
+// Cluster and group metrics become partial sums over the shard, to be summed
+// across replicas in PromQL. cached returns the member list the pod cache was
+// built with, such as PodSource.ShardMembers; nodes are assigned by it rather
+// than the latest membership so that newly assigned nodes are only collected
+// once their pods are cached. nil assigns by the latest membership.
+func WithShard(s *ShardMembership, cached func() []string) CollectorOption {
+	return func(c *BinpackingCollector) {
+		c.shard = s
+		c.shardCached = cached
+	}
+}
+
+// WithAllocationIndex makes Collect read incrementally maintained per-node
+// totals instead of listing and recomputing every pod on each scrape.
+func WithAllocationIndex(i allocationSource) CollectorOption {
+	return func(c *BinpackingCollector) {
+		c.index = i
+	}
 }
 
 // calculatePodRequest computes the effective resource request for a pod.
@@ -194,319 +466,595 @@ func NewBinpackingCollector(
 	podLister listerscorev1.PodLister,
 	logger *slog.Logger,
 	resources []corev1.ResourceName,
-	labelGroups [][]string,
+	labelGroups []LabelGroup,
 	enableNodeMetrics bool,
 	syncInfo *SyncInfo,
 	isLeader *atomic.Bool,
+	opts ...CollectorOption,
 ) *BinpackingCollector {
-	return &BinpackingCollector{
-		nodeLister:        nodeLister,
-		podLister:         podLister,
-		logger:            logger,
-		resources:         resources,
-		labelGroups:       labelGroups,
-		enableNodeMetrics: enableNodeMetrics,
-		syncInfo:          syncInfo,
-		isLeader:          isLeader,
+	c := &BinpackingCollector{
+		nodeLister: nodeLister,
+		podLister:  podLister,
+		logger:     logger,
+		desc:       newDescriptors(defaultMetricNamespace, nil),
+		syncInfo:   syncInfo,
+		isLeader:   isLeader,
+	}
+	c.settings.Store(&CollectorSettings{
+		Resources:         resources,
+		LabelGroups:       labelGroups,
+		EnableNodeMetrics: enableNodeMetrics,
+	})
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 func (c *BinpackingCollector) Describe(ch chan<- *prometheus.Desc) {
-	if c.enableNodeMetrics {
-		ch <- nodeAllocated
-		ch <- nodeAllocatable
-		ch <- nodeUtilization
-		ch <- nodeDaemonsetOverhead
-		ch <- nodeDaemonsetOverheadRatio
-	}
-	ch <- clusterAllocated
-	ch <- clusterAllocatable
-	ch <- clusterUtilization
-	ch <- clusterDaemonsetOverhead
-	ch <- clusterDaemonsetOverheadRatio
-	ch <- clusterNodeCount
-	if len(c.labelGroups) > 0 {
-		ch <- groupAllocated
-		ch <- groupAllocatable
-		ch <- groupUtilization
-		ch <- groupDaemonsetOverhead
-		ch <- groupDaemonsetOverheadRatio
-		ch <- groupNodeCount
-	}
-	ch <- cacheAge
+	s := c.settings.Load()
+	hasGroups := len(s.LabelGroups) > 0 || len(s.SelectorGroups) > 0
+	if s.EnableNodeMetrics {
+		ch <- c.desc.nodeAllocated
+		ch <- c.desc.nodeAllocatable
+		ch <- c.desc.nodeUtilization
+		ch <- c.desc.nodeDaemonsetOverhead
+		ch <- c.desc.nodeDaemonsetOverheadRatio
+	}
+	ch <- c.desc.clusterAllocated
+	ch <- c.desc.clusterAllocatable
+	ch <- c.desc.clusterUtilization
+	ch <- c.desc.clusterDaemonsetOverhead
+	ch <- c.desc.clusterDaemonsetOverheadRatio
+	ch <- c.desc.clusterNodeCount
+	if hasGroups {
+		ch <- c.desc.groupAllocated
+		ch <- c.desc.groupAllocatable
+		ch <- c.desc.groupUtilization
+		ch <- c.desc.groupDaemonsetOverhead
+		ch <- c.desc.groupDaemonsetOverheadRatio
+		ch <- c.desc.groupNodeCount
+	}
+	if c.usage != nil {
+		if s.EnableNodeMetrics {
+			ch <- c.desc.nodeUsage
+			ch <- c.desc.nodeEfficiency
+		}
+		ch <- c.desc.clusterUsage
+		ch <- c.desc.clusterEfficiency
+		if hasGroups {
+			ch <- c.desc.groupUsage
+			ch <- c.desc.groupEfficiency
+		}
+		ch <- c.desc.usageAvailable
+	}
+	if s.Pricing != nil {
+		ch <- c.desc.clusterHourlyCost
+		ch <- c.desc.clusterUnallocatedCost
+		ch <- c.desc.clusterDaemonsetOverheadCost
+		ch <- c.desc.clusterUnpricedNodeCount
+		if hasGroups {
+			ch <- c.desc.groupHourlyCost
+			ch <- c.desc.groupUnallocatedCost
+			ch <- c.desc.groupDaemonsetOverheadCost
+		}
+	}
+	if len(s.HeadroomTargets) > 0 {
+		ch <- c.desc.groupHeadroomSurplus
+		ch <- c.desc.groupHeadroomTargetMet
+	}
+	ch <- c.desc.cacheAge
+	if c.syncInfo != nil && len(c.syncInfo.Informers()) > 0 {
+		ch <- c.desc.informerLastEvent
+		ch <- c.desc.informerLastResync
+		ch <- c.desc.informerWatchReconnects
+	}
 	if c.isLeader != nil {
-		ch <- leaderStatus
+		ch <- c.desc.leaderStatus
+	}
+	if c.shard != nil {
+		ch <- c.desc.shardMembers
+		ch <- c.desc.shardOwnedNodes
+	}
+	if c.staleThreshold > 0 && c.syncInfo != nil {
+		ch <- c.desc.cacheStale
+	}
+	if c.snapshotInterval > 0 {
+		ch <- c.desc.snapshotAge
+		ch <- c.desc.snapshotComputeDuration
 	}
 }
 
 func (c *BinpackingCollector) Collect(ch chan<- prometheus.Metric) {
-	// Emit cache age metric
+	// Emit cache freshness metrics
 	if c.syncInfo != nil {
-		ageSeconds := time.Since(c.syncInfo.LastSyncTime).Seconds()
-		ch <- prometheus.MustNewConstMetric(cacheAge, prometheus.GaugeValue, ageSeconds)
+		ageSeconds := c.syncInfo.CacheAge(time.Now()).Seconds()
+		ch <- prometheus.MustNewConstMetric(c.desc.cacheAge, prometheus.GaugeValue, ageSeconds)
+		for kind, f := range c.syncInfo.Informers() {
+			ch <- prometheus.MustNewConstMetric(c.desc.informerLastEvent, prometheus.GaugeValue, unixSeconds(f.LastEvent()), kind)
+			ch <- prometheus.MustNewConstMetric(c.desc.informerLastResync, prometheus.GaugeValue, unixSeconds(f.LastResync()), kind)
+			ch <- prometheus.MustNewConstMetric(c.desc.informerWatchReconnects, prometheus.CounterValue, float64(f.WatchReconnects()), kind)
+		}
 	}
 
 	// Leader election gate: when enabled, emit leader_status and return early if standby.
 	if c.isLeader != nil {
 		leader := c.isLeader.Load()
-		ch <- prometheus.MustNewConstMetric(leaderStatus, prometheus.GaugeValue, boolToFloat64(leader))
+		ch <- prometheus.MustNewConstMetric(c.desc.leaderStatus, prometheus.GaugeValue, boolToFloat64(leader))
 		if !leader {
 			return // standby: only cache_age + leader_status
 		}
 	}
 
+	if c.staleThreshold > 0 && c.syncInfo != nil {
+		stale := c.syncInfo.IsStale(c.staleThreshold, time.Now())
+		ch <- prometheus.MustNewConstMetric(c.desc.cacheStale, prometheus.GaugeValue, boolToFloat64(stale))
+		if stale && c.dropWhenStale {
+			c.logger.Warn("informer cache is stale, not emitting binpacking metrics",
+				"cache_age", c.syncInfo.CacheAge(time.Now()), "threshold", c.staleThreshold)
+			return
+		}
+	}
+
+	if c.snapshotInterval > 0 {
+		c.collectSnapshot(ch)
+		return
+	}
+	c.collectBinpacking(ch)
+}
+
+// resourceTotals are one resource's values for a node, or summed over a
+// group or the cluster. Costs are only summed when pricing is configured and
+// usage only when usage is available.
+type resourceTotals struct {
+	allocated             float64
+	allocatable           float64
+	daemonsetOverhead     float64
+	usage                 float64
+	unallocatedCost       float64
+	daemonsetOverheadCost float64
+}
+
+// nodeSetTotals are the per-resource totals of a set of nodes.
+type nodeSetTotals struct {
+	nodeCount  int
+	hourlyCost float64
+	byResource map[corev1.ResourceName]resourceTotals
+}
+
+// add sums one node's values for res into t.
+func (t *nodeSetTotals) add(res corev1.ResourceName, v resourceTotals) {
+	if t.byResource == nil {
+		t.byResource = make(map[corev1.ResourceName]resourceTotals)
+	}
+	sum := t.byResource[res]
+	sum.allocated += v.allocated
+	sum.allocatable += v.allocatable
+	sum.daemonsetOverhead += v.daemonsetOverhead
+	sum.usage += v.usage
+	sum.unallocatedCost += v.unallocatedCost
+	sum.daemonsetOverheadCost += v.daemonsetOverheadCost
+	t.byResource[res] = sum
+}
+
+// nodeTotals are one node's per-resource values.
+type nodeTotals struct {
+	name       string
+	byResource map[corev1.ResourceName]resourceTotals
+}
+
+// groupTotals are the totals of one label group value or selector group.
+type groupTotals struct {
+	labelGroup      string
+	labelGroupValue string
+	group           string
+	// resources are the group's resources; daemonsetOverhead is false when
+	// the group disables DaemonSet overhead metrics.
+	resources         []corev1.ResourceName
+	daemonsetOverhead bool
+	headroomTarget    map[corev1.ResourceName]float64
+	nodeSetTotals
+}
+
+// labelValues returns the label_group, label_group_value and group label values.
+func (g *groupTotals) labelValues() []string {
+	return []string{g.labelGroup, g.labelGroupValue, g.group}
+}
+
+// binpackingResult is one binpacking computation from the informer cache.
+// Both /metrics and the JSON API are rendered from it, so they always agree.
+type binpackingResult struct {
+	// settings are the settings the result was computed with.
+	settings *CollectorSettings
+	// nodes are only kept when per-node metrics are enabled.
+	nodes          []nodeTotals
+	cluster        nodeSetTotals
+	unpricedNodes  int
+	labelGroups    []groupTotals
+	selectorGroups []groupTotals
+
+	// usageTracked is true when a usage tracker is configured, usage when it
+	// had usage to report.
+	usageTracked bool
+	usage        bool
+
+	// sharded is true when the result only covers this replica's shard.
+	sharded      bool
+	shardMembers int
+
+	stats podFilterStats
+}
+
+// collectBinpacking computes binpacking metrics from the informer cache,
+// emits them and records the collect self-metrics.
+func (c *BinpackingCollector) collectBinpacking(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	result := c.computeBinpacking()
+	if result == nil {
+		return
+	}
+	c.emitBinpacking(ch, result)
+	c.exporterMetrics.observeCollect(time.Since(start), result.cluster.nodeCount, result.stats)
+}
+
+// computeBinpacking computes per-node, cluster and group totals from the
+// informer cache. It returns nil if nodes or pods could not be listed.
+func (c *BinpackingCollector) computeBinpacking() *binpackingResult {
+	s := c.settings.Load()
+
 	nodes, err := c.nodeLister.List(labels.Everything())
 	if err != nil {
 		c.logger.Error("failed to list nodes", "error", err)
-		return
+		return nil
+	}
+	result := &binpackingResult{settings: s}
+	if c.shard != nil {
+		members := c.shard.Members()
+		result.sharded = true
+		result.shardMembers = len(members)
+		// A replica that missed its heartbeats claims no nodes (members is
+		// nil); otherwise nodes are assigned as the pod cache was built.
+		if members != nil && c.shardCached != nil {
+			members = c.shardCached()
+		}
+		nodes = c.shardNodes(nodes, members)
 	}
 
-	pods, err := c.podLister.List(labels.Everything())
-	if err != nil {
-		c.logger.Error("failed to list pods", "error", err)
-		return
+	allocations, stats, ok := c.nodeAllocations()
+	if !ok {
+		return nil
 	}
+	result.stats = stats
+
+	c.logger.Debug("scraping metrics", "node_count", len(nodes), "scheduled_node_count", len(allocations))
+
+	// Usage is read from the tracker's cache; nil when disabled or unavailable.
+	usage := c.usage.Snapshot()
+	result.usageTracked = c.usage != nil
+	result.usage = usage != nil
+
+	result.cluster.nodeCount = len(nodes)
+	for _, node := range nodes {
+		alloc := allocations[node.Name]
 
-	c.logger.Debug("scraping metrics", "node_count", len(nodes), "pod_count", len(pods))
+		var price float64
+		if s.Pricing != nil {
+			var priced bool
+			price, priced = s.Pricing.NodePrice(node)
+			if !priced {
+				result.unpricedNodes++
+				c.logger.Debug("no price for node", "node", node.Name)
+			}
+			result.cluster.hourlyCost += price
+		}
 
-	// Build podsByNode map, filtering out unscheduled and terminated pods.
-	podsByNode := make(map[string][]*corev1.Pod)
-	var unscheduledCount, terminatedCount int
-	for _, pod := range pods {
-		if pod.Spec.NodeName == "" {
-			unscheduledCount++
-			c.logger.Debug("skipping unscheduled pod", "pod", pod.Namespace+"/"+pod.Name)
-			continue
+		var totals map[corev1.ResourceName]resourceTotals
+		if s.EnableNodeMetrics {
+			totals = make(map[corev1.ResourceName]resourceTotals, len(s.Resources))
 		}
-		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
-			terminatedCount++
-			c.logger.Debug("skipping terminated pod", "pod", pod.Namespace+"/"+pod.Name, "phase", pod.Status.Phase)
-			continue
+		for _, res := range s.Resources {
+			v := nodeResourceTotals(s, node, alloc, usage, res, price)
+			result.cluster.add(res, v)
+			if totals != nil {
+				totals[res] = v
+			}
+		}
+		if totals != nil {
+			result.nodes = append(result.nodes, nodeTotals{name: node.Name, byResource: totals})
 		}
-		podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod)
 	}
 
-	if unscheduledCount > 0 || terminatedCount > 0 {
-		c.logger.Debug("filtered pods", "unscheduled", unscheduledCount, "terminated", terminatedCount)
+	if len(s.LabelGroups) > 0 {
+		result.labelGroups = c.labelGroupTotals(s, nodes, allocations, usage)
+	}
+	if len(s.SelectorGroups) > 0 {
+		result.selectorGroups = selectorGroupTotals(s, nodes, allocations, usage)
 	}
+	return result
+}
 
-	// Track cluster-wide totals per resource.
-	clusterAllocatedTotals := make(map[corev1.ResourceName]float64)
-	clusterAllocatableTotals := make(map[corev1.ResourceName]float64)
-	clusterDaemonsetTotals := make(map[corev1.ResourceName]float64)
+// nodeResourceTotals returns one node's values for res. price is the node's
+// hourly price, used when pricing is configured.
+func nodeResourceTotals(s *CollectorSettings, node *corev1.Node, alloc *nodeAllocation, usage map[string]corev1.ResourceList, res corev1.ResourceName, price float64) resourceTotals {
+	v := resourceTotals{
+		allocated:         alloc.allocatedFor(res),
+		allocatable:       allocatableOf(node, res),
+		daemonsetOverhead: alloc.daemonsetOverheadFor(res),
+	}
+	if usage != nil {
+		v.usage = alloc.usageFor(usage, res)
+	}
+	if s.Pricing != nil {
+		v.unallocatedCost = costShare(price, v.allocatable-v.allocated, v.allocatable)
+		v.daemonsetOverheadCost = costShare(price, v.daemonsetOverhead, v.allocatable)
+	}
+	return v
+}
 
-	for _, node := range nodes {
-		nodePods := podsByNode[node.Name]
+// nodeAllocations returns per-node allocations and pod counts, read from the
+// incremental index when configured, or fully recomputed from the pod lister
+// otherwise. The last return value is false if pods could not be listed.
+func (c *BinpackingCollector) nodeAllocations() (map[string]*nodeAllocation, podFilterStats, bool) {
+	if c.index != nil {
+		allocations, stats := c.index.Allocations()
+		return allocations, stats, true
+	}
 
-		c.logger.Debug("processing node", "node", node.Name, "pod_count", len(nodePods))
+	pods, err := c.podLister.List(labels.Everything())
+	if err != nil {
+		c.logger.Error("failed to list pods", "error", err)
+		return nil, podFilterStats{}, false
+	}
 
-		for _, res := range c.resources {
-			resStr := string(res)
+	allocations, stats := computeNodeAllocations(pods, c.logger)
+	if stats.unscheduled > 0 || stats.terminated > 0 {
+		c.logger.Debug("filtered pods", "unscheduled", stats.unscheduled, "terminated", stats.terminated)
+	}
+	return allocations, stats, true
+}
 
-			// Sum pod requests for this resource on this node.
-			// For each pod, take the max of:
-			// 1. Sum of all regular container requests
-			// 2. Max init container request (they run sequentially)
-			var allocated float64
-			var daemonsetOverhead float64
-			for _, pod := range nodePods {
-				podRequest, details := calculatePodRequest(pod, res)
-				allocated += podRequest
-
-				if isDaemonSetPod(pod) {
-					daemonsetOverhead += podRequest
-				}
+// labelGroupTotals calculates binpacking totals grouped by node label combinations.
+// Each group is a set of label keys. Nodes are grouped by the composite value of all keys in the group.
+// Per-node allocations are shared with the cluster totals, so grouping only sums precomputed totals.
+// Values are sorted by composite value.
+func (c *BinpackingCollector) labelGroupTotals(s *CollectorSettings, nodes []*corev1.Node, allocations map[string]*nodeAllocation, usage map[string]corev1.ResourceList) []groupTotals {
+	var totals []groupTotals
+	for i := range s.LabelGroups {
+		group := &s.LabelGroups[i]
 
-				if c.logger.Enabled(context.TODO(), slog.LevelDebug) && podRequest > 0 {
-					if details.usedInit {
-						c.logger.Debug("pod resource request (init container dominates)",
-							"pod", pod.Namespace+"/"+pod.Name,
-							"resource", resStr,
-							"effective", details.effective,
-							"init_max", details.initMax,
-							"init_container", details.initMaxContainer,
-							"regular_sum", details.regularSum)
-					} else {
-						c.logger.Debug("pod resource request",
-							"pod", pod.Namespace+"/"+pod.Name,
-							"resource", resStr,
-							"effective", details.effective,
-							"containers", details.containerCount,
-							"init_containers", details.initContainerCount)
-					}
-				}
+		// Group nodes by composite label value.
+		now := time.Now()
+		nodesByCompositeValue := make(map[string][]*corev1.Node)
+		for _, node := range nodes {
+			if group.NodeSelector != nil && !group.NodeSelector.Matches(labels.Set(node.Labels)) {
+				continue
 			}
+			compositeValue := group.compositeValue(node, now)
+			nodesByCompositeValue[compositeValue] = append(nodesByCompositeValue[compositeValue], node)
+		}
 
-			// Get node allocatable for this resource.
-			var allocatable float64
-			if qty, ok := node.Status.Allocatable[res]; ok {
-				allocatable = qty.AsApproximateFloat64()
-			}
+		c.logger.Debug("grouping nodes by label combination",
+			"label_group", group.Name,
+			"group_count", len(nodesByCompositeValue))
 
-			// Compute ratios.
-			var ratio float64
-			if allocatable > 0 {
-				ratio = allocated / allocatable
-			}
-			var dsRatio float64
-			if allocatable > 0 {
-				dsRatio = daemonsetOverhead / allocatable
+		// For each composite value, calculate aggregate binpacking totals.
+		for _, compositeValue := range slices.Sorted(maps.Keys(nodesByCompositeValue)) {
+			g := groupTotals{
+				labelGroup:        group.Name,
+				labelGroupValue:   compositeValue,
+				resources:         group.resources(s.Resources),
+				daemonsetOverhead: !group.DisableDaemonsetOverhead,
+				headroomTarget:    s.HeadroomTargets[group.Name],
 			}
+			g.sum(s, nodesByCompositeValue[compositeValue], allocations, usage)
+			totals = append(totals, g)
+		}
+	}
+	return totals
+}
 
-			// Emit per-node metrics if enabled
-			if c.enableNodeMetrics {
-				c.logger.Debug("node metrics",
-					"node", node.Name,
-					"resource", resStr,
-					"allocated", allocated,
-					"allocatable", allocatable,
-					"utilization", ratio,
-					"daemonset_overhead", daemonsetOverhead)
-
-				ch <- prometheus.MustNewConstMetric(nodeAllocated, prometheus.GaugeValue, allocated, node.Name, resStr)
-				ch <- prometheus.MustNewConstMetric(nodeAllocatable, prometheus.GaugeValue, allocatable, node.Name, resStr)
-				ch <- prometheus.MustNewConstMetric(nodeUtilization, prometheus.GaugeValue, ratio, node.Name, resStr)
-				ch <- prometheus.MustNewConstMetric(nodeDaemonsetOverhead, prometheus.GaugeValue, daemonsetOverhead, node.Name, resStr)
-				ch <- prometheus.MustNewConstMetric(nodeDaemonsetOverheadRatio, prometheus.GaugeValue, dsRatio, node.Name, resStr)
+// selectorGroupTotals calculates the totals of each named selector group. A
+// node is counted in every group whose selector it matches, and groups
+// without matching nodes have zero totals.
+func selectorGroupTotals(s *CollectorSettings, nodes []*corev1.Node, allocations map[string]*nodeAllocation, usage map[string]corev1.ResourceList) []groupTotals {
+	totals := make([]groupTotals, 0, len(s.SelectorGroups))
+	for _, sg := range s.SelectorGroups {
+		var groupNodes []*corev1.Node
+		for _, node := range nodes {
+			if sg.Selector.Matches(labels.Set(node.Labels)) {
+				groupNodes = append(groupNodes, node)
 			}
+		}
+		g := groupTotals{group: sg.Name, resources: s.Resources, daemonsetOverhead: true}
+		g.sum(s, groupNodes, allocations, usage)
+		totals = append(totals, g)
+	}
+	return totals
+}
 
-			clusterAllocatedTotals[res] += allocated
-			clusterAllocatableTotals[res] += allocatable
-			clusterDaemonsetTotals[res] += daemonsetOverhead
+// sum adds the values of the group's nodes to its totals.
+func (g *groupTotals) sum(s *CollectorSettings, groupNodes []*corev1.Node, allocations map[string]*nodeAllocation, usage map[string]corev1.ResourceList) {
+	g.nodeCount = len(groupNodes)
+	for _, node := range groupNodes {
+		var price float64
+		if s.Pricing != nil {
+			price, _ = s.Pricing.NodePrice(node)
+			g.hourlyCost += price
+		}
+		for _, res := range g.resources {
+			g.add(res, nodeResourceTotals(s, node, allocations[node.Name], usage, res, price))
 		}
 	}
+}
 
-	// Emit cluster-aggregate metrics.
-	for _, res := range c.resources {
-		resStr := string(res)
-		allocated := clusterAllocatedTotals[res]
-		allocatable := clusterAllocatableTotals[res]
-		dsOverhead := clusterDaemonsetTotals[res]
+// emitBinpacking emits the metrics of a binpacking result.
+func (c *BinpackingCollector) emitBinpacking(ch chan<- prometheus.Metric, r *binpackingResult) {
+	s := r.settings
 
-		var ratio float64
-		if allocatable > 0 {
-			ratio = allocated / allocatable
-		}
-		var dsRatio float64
-		if allocatable > 0 {
-			dsRatio = dsOverhead / allocatable
+	if r.sharded {
+		ch <- prometheus.MustNewConstMetric(c.desc.shardMembers, prometheus.GaugeValue, float64(r.shardMembers))
+		ch <- prometheus.MustNewConstMetric(c.desc.shardOwnedNodes, prometheus.GaugeValue, float64(r.cluster.nodeCount))
+	}
+	if r.usageTracked {
+		ch <- prometheus.MustNewConstMetric(c.desc.usageAvailable, prometheus.GaugeValue, boolToFloat64(r.usage))
+	}
+
+	// Emit per-node metrics; nodes are only kept when enabled.
+	for _, node := range r.nodes {
+		for _, res := range s.Resources {
+			resStr := string(res)
+			v := node.byResource[res]
+			ratio := safeRatio(v.allocated, v.allocatable)
+
+			c.logger.Debug("node metrics",
+				"node", node.name,
+				"resource", resStr,
+				"allocated", v.allocated,
+				"allocatable", v.allocatable,
+				"utilization", ratio,
+				"daemonset_overhead", v.daemonsetOverhead)
+
+			ch <- prometheus.MustNewConstMetric(c.desc.nodeAllocated, prometheus.GaugeValue, v.allocated, node.name, resStr)
+			ch <- prometheus.MustNewConstMetric(c.desc.nodeAllocatable, prometheus.GaugeValue, v.allocatable, node.name, resStr)
+			ch <- prometheus.MustNewConstMetric(c.desc.nodeUtilization, prometheus.GaugeValue, ratio, node.name, resStr)
+			ch <- prometheus.MustNewConstMetric(c.desc.nodeDaemonsetOverhead, prometheus.GaugeValue, v.daemonsetOverhead, node.name, resStr)
+			ch <- prometheus.MustNewConstMetric(c.desc.nodeDaemonsetOverheadRatio, prometheus.GaugeValue, safeRatio(v.daemonsetOverhead, v.allocatable), node.name, resStr)
+
+			if r.usage && usageResources[res] {
+				ch <- prometheus.MustNewConstMetric(c.desc.nodeUsage, prometheus.GaugeValue, v.usage, node.name, resStr)
+				ch <- prometheus.MustNewConstMetric(c.desc.nodeEfficiency, prometheus.GaugeValue, safeRatio(v.usage, v.allocated), node.name, resStr)
+			}
 		}
+	}
+
+	// Emit cluster-aggregate metrics.
+	for _, res := range s.Resources {
+		resStr := string(res)
+		v := r.cluster.byResource[res]
+		ratio := safeRatio(v.allocated, v.allocatable)
 
 		c.logger.Debug("cluster metrics",
 			"resource", resStr,
-			"allocated", allocated,
-			"allocatable", allocatable,
+			"allocated", v.allocated,
+			"allocatable", v.allocatable,
 			"utilization", ratio,
-			"daemonset_overhead", dsOverhead)
+			"daemonset_overhead", v.daemonsetOverhead)
+
+		ch <- prometheus.MustNewConstMetric(c.desc.clusterAllocated, prometheus.GaugeValue, v.allocated, resStr)
+		ch <- prometheus.MustNewConstMetric(c.desc.clusterAllocatable, prometheus.GaugeValue, v.allocatable, resStr)
+		ch <- prometheus.MustNewConstMetric(c.desc.clusterUtilization, prometheus.GaugeValue, ratio, resStr)
+		ch <- prometheus.MustNewConstMetric(c.desc.clusterDaemonsetOverhead, prometheus.GaugeValue, v.daemonsetOverhead, resStr)
+		ch <- prometheus.MustNewConstMetric(c.desc.clusterDaemonsetOverheadRatio, prometheus.GaugeValue, safeRatio(v.daemonsetOverhead, v.allocatable), resStr)
+
+		if r.usage && usageResources[res] {
+			ch <- prometheus.MustNewConstMetric(c.desc.clusterUsage, prometheus.GaugeValue, v.usage, resStr)
+			ch <- prometheus.MustNewConstMetric(c.desc.clusterEfficiency, prometheus.GaugeValue, safeRatio(v.usage, v.allocated), resStr)
+		}
 
-		ch <- prometheus.MustNewConstMetric(clusterAllocated, prometheus.GaugeValue, allocated, resStr)
-		ch <- prometheus.MustNewConstMetric(clusterAllocatable, prometheus.GaugeValue, allocatable, resStr)
-		ch <- prometheus.MustNewConstMetric(clusterUtilization, prometheus.GaugeValue, ratio, resStr)
-		ch <- prometheus.MustNewConstMetric(clusterDaemonsetOverhead, prometheus.GaugeValue, dsOverhead, resStr)
-		ch <- prometheus.MustNewConstMetric(clusterDaemonsetOverheadRatio, prometheus.GaugeValue, dsRatio, resStr)
+		if s.Pricing != nil {
+			ch <- prometheus.MustNewConstMetric(c.desc.clusterUnallocatedCost, prometheus.GaugeValue, v.unallocatedCost, resStr)
+			ch <- prometheus.MustNewConstMetric(c.desc.clusterDaemonsetOverheadCost, prometheus.GaugeValue, v.daemonsetOverheadCost, resStr)
+		}
 	}
 
 	// Emit cluster node count
-	ch <- prometheus.MustNewConstMetric(clusterNodeCount, prometheus.GaugeValue, float64(len(nodes)))
+	ch <- prometheus.MustNewConstMetric(c.desc.clusterNodeCount, prometheus.GaugeValue, float64(r.cluster.nodeCount))
+
+	if s.Pricing != nil {
+		ch <- prometheus.MustNewConstMetric(c.desc.clusterHourlyCost, prometheus.GaugeValue, r.cluster.hourlyCost)
+		ch <- prometheus.MustNewConstMetric(c.desc.clusterUnpricedNodeCount, prometheus.GaugeValue, float64(r.unpricedNodes))
+	}
 
-	// Emit label-group metrics if configured.
-	if len(c.labelGroups) > 0 {
-		c.collectLabelGroupMetrics(ch, nodes, podsByNode)
+	// Emit label-group and selector-group metrics if configured.
+	for i := range r.labelGroups {
+		c.emitGroupMetrics(ch, s, r, &r.labelGroups[i])
+	}
+	for i := range r.selectorGroups {
+		c.emitGroupMetrics(ch, s, r, &r.selectorGroups[i])
 	}
 }
 
-// collectLabelGroupMetrics calculates and emits binpacking metrics grouped by node label combinations.
-// Each group is a slice of label keys. Nodes are grouped by the composite value of all keys in the group.
-func (c *BinpackingCollector) collectLabelGroupMetrics(ch chan<- prometheus.Metric, nodes []*corev1.Node, podsByNode map[string][]*corev1.Pod) {
-	for _, group := range c.labelGroups {
-		labelGroupKey := strings.Join(group, ",")
+// emitGroupMetrics emits the metrics of one group's totals.
+func (c *BinpackingCollector) emitGroupMetrics(ch chan<- prometheus.Metric, s *CollectorSettings, r *binpackingResult, g *groupTotals) {
+	groupLabels := g.labelValues()
+	for _, res := range g.resources {
+		resStr := string(res)
+		lv := append(append(make([]string, 0, len(groupLabels)+1), groupLabels...), resStr)
+		v := g.byResource[res]
+		ratio := safeRatio(v.allocated, v.allocatable)
 
-		// Group nodes by composite label value.
-		nodesByCompositeValue := make(map[string][]*corev1.Node)
-		for _, node := range nodes {
-			values := make([]string, len(group))
-			for i, key := range group {
-				if v, ok := node.Labels[key]; ok {
-					values[i] = v
-				} else {
-					values[i] = "<none>"
-				}
-			}
-			compositeValue := strings.Join(values, ",")
-			nodesByCompositeValue[compositeValue] = append(nodesByCompositeValue[compositeValue], node)
-		}
+		c.logger.Debug("group metrics",
+			"label_group", g.labelGroup,
+			"label_group_value", g.labelGroupValue,
+			"group", g.group,
+			"resource", resStr,
+			"allocated", v.allocated,
+			"allocatable", v.allocatable,
+			"utilization", ratio,
+			"daemonset_overhead", v.daemonsetOverhead,
+			"node_count", g.nodeCount)
 
-		c.logger.Debug("grouping nodes by label combination",
-			"label_group", labelGroupKey,
-			"group_count", len(nodesByCompositeValue))
+		ch <- prometheus.MustNewConstMetric(c.desc.groupAllocated, prometheus.GaugeValue, v.allocated, lv...)
+		ch <- prometheus.MustNewConstMetric(c.desc.groupAllocatable, prometheus.GaugeValue, v.allocatable, lv...)
+		ch <- prometheus.MustNewConstMetric(c.desc.groupUtilization, prometheus.GaugeValue, ratio, lv...)
+		if g.daemonsetOverhead {
+			ch <- prometheus.MustNewConstMetric(c.desc.groupDaemonsetOverhead, prometheus.GaugeValue, v.daemonsetOverhead, lv...)
+			ch <- prometheus.MustNewConstMetric(c.desc.groupDaemonsetOverheadRatio, prometheus.GaugeValue, safeRatio(v.daemonsetOverhead, v.allocatable), lv...)
+		}
 
-		// For each composite value, calculate aggregate binpacking metrics.
-		for compositeValue, groupNodes := range nodesByCompositeValue {
-			allocatedTotals := make(map[corev1.ResourceName]float64)
-			allocatableTotals := make(map[corev1.ResourceName]float64)
-			daemonsetTotals := make(map[corev1.ResourceName]float64)
-
-			for _, node := range groupNodes {
-				nodePods := podsByNode[node.Name]
-
-				for _, res := range c.resources {
-					var allocated float64
-					var dsOverhead float64
-					for _, pod := range nodePods {
-						podRequest, _ := calculatePodRequest(pod, res)
-						allocated += podRequest
-						if isDaemonSetPod(pod) {
-							dsOverhead += podRequest
-						}
-					}
+		if r.usage && usageResources[res] {
+			ch <- prometheus.MustNewConstMetric(c.desc.groupUsage, prometheus.GaugeValue, v.usage, lv...)
+			ch <- prometheus.MustNewConstMetric(c.desc.groupEfficiency, prometheus.GaugeValue, safeRatio(v.usage, v.allocated), lv...)
+		}
 
-					var allocatable float64
-					if qty, ok := node.Status.Allocatable[res]; ok {
-						allocatable = qty.AsApproximateFloat64()
-					}
+		if target, ok := g.headroomTarget[res]; ok {
+			surplus := v.allocatable - v.allocated - target
+			ch <- prometheus.MustNewConstMetric(c.desc.groupHeadroomSurplus, prometheus.GaugeValue, surplus, lv...)
+			ch <- prometheus.MustNewConstMetric(c.desc.groupHeadroomTargetMet, prometheus.GaugeValue, boolToFloat64(surplus >= 0), lv...)
+		}
 
-					allocatedTotals[res] += allocated
-					allocatableTotals[res] += allocatable
-					daemonsetTotals[res] += dsOverhead
-				}
+		if s.Pricing != nil {
+			ch <- prometheus.MustNewConstMetric(c.desc.groupUnallocatedCost, prometheus.GaugeValue, v.unallocatedCost, lv...)
+			if g.daemonsetOverhead {
+				ch <- prometheus.MustNewConstMetric(c.desc.groupDaemonsetOverheadCost, prometheus.GaugeValue, v.daemonsetOverheadCost, lv...)
 			}
+		}
+	}
 
-			// Emit metrics for this combination group.
-			for _, res := range c.resources {
-				resStr := string(res)
-				allocated := allocatedTotals[res]
-				allocatable := allocatableTotals[res]
-				dsOverhead := daemonsetTotals[res]
-
-				var ratio float64
-				if allocatable > 0 {
-					ratio = allocated / allocatable
-				}
-				var dsRatio float64
-				if allocatable > 0 {
-					dsRatio = dsOverhead / allocatable
-				}
+	ch <- prometheus.MustNewConstMetric(c.desc.groupNodeCount, prometheus.GaugeValue, float64(g.nodeCount), groupLabels...)
 
-				c.logger.Debug("group metrics",
-					"label_group", labelGroupKey,
-					"label_group_value", compositeValue,
-					"resource", resStr,
-					"allocated", allocated,
-					"allocatable", allocatable,
-					"utilization", ratio,
-					"daemonset_overhead", dsOverhead,
-					"node_count", len(groupNodes))
-
-				ch <- prometheus.MustNewConstMetric(groupAllocated, prometheus.GaugeValue, allocated, labelGroupKey, compositeValue, resStr)
-				ch <- prometheus.MustNewConstMetric(groupAllocatable, prometheus.GaugeValue, allocatable, labelGroupKey, compositeValue, resStr)
-				ch <- prometheus.MustNewConstMetric(groupUtilization, prometheus.GaugeValue, ratio, labelGroupKey, compositeValue, resStr)
-				ch <- prometheus.MustNewConstMetric(groupDaemonsetOverhead, prometheus.GaugeValue, dsOverhead, labelGroupKey, compositeValue, resStr)
-				ch <- prometheus.MustNewConstMetric(groupDaemonsetOverheadRatio, prometheus.GaugeValue, dsRatio, labelGroupKey, compositeValue, resStr)
-			}
+	if s.Pricing != nil {
+		ch <- prometheus.MustNewConstMetric(c.desc.groupHourlyCost, prometheus.GaugeValue, g.hourlyCost, groupLabels...)
+	}
+}
 
-			ch <- prometheus.MustNewConstMetric(groupNodeCount, prometheus.GaugeValue, float64(len(groupNodes)), labelGroupKey, compositeValue)
+// shardNodes returns the nodes assigned to this replica. The member list is
+// read once so that a concurrent membership change cannot split one scrape
+// across two assignments.
+func (c *BinpackingCollector) shardNodes(nodes []*corev1.Node, members []string) []*corev1.Node {
+	owned := make([]*corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if shardOwner(members, node.Name) == c.shard.config.Identity {
+			owned = append(owned, node)
 		}
 	}
+	return owned
+}
+
+// allocatableOf returns a node's allocatable amount of a resource.
+func allocatableOf(node *corev1.Node, res corev1.ResourceName) float64 {
+	if qty, ok := node.Status.Allocatable[res]; ok {
+		return qty.AsApproximateFloat64()
+	}
+	return 0
+}
+
+// safeRatio returns numerator/denominator, or 0 when the denominator is not positive.
+func safeRatio(numerator, denominator float64) float64 {
+	if denominator > 0 {
+		return numerator / denominator
+	}
+	return 0
 }
 
 func boolToFloat64(b bool) float64 {
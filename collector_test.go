@@ -4,11 +4,13 @@ import (
 	"log/slog"
 	"math"
 	"os"
+	"regexp"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -792,7 +794,7 @@ func TestBinpackingCollector_LabelGrouping(t *testing.T) {
 
 	t.Run("single-key group", func(t *testing.T) {
 		// Group by zone only (single key per group)
-		labelGroups := [][]string{{"topology.kubernetes.io/zone"}}
+		labelGroups := []LabelGroup{newLabelGroup("topology.kubernetes.io/zone")}
 		resources := []corev1.ResourceName{corev1.ResourceCPU}
 
 		collector := NewBinpackingCollector(nodeLister, podLister, logger, resources, labelGroups, true, nil, nil)
@@ -819,7 +821,7 @@ func TestBinpackingCollector_LabelGrouping(t *testing.T) {
 
 	t.Run("multi-key combination group", func(t *testing.T) {
 		// Group by zone AND instance-type (combination group)
-		labelGroups := [][]string{{"topology.kubernetes.io/zone", "node.kubernetes.io/instance-type"}}
+		labelGroups := []LabelGroup{newLabelGroup("topology.kubernetes.io/zone", "node.kubernetes.io/instance-type")}
 		resources := []corev1.ResourceName{corev1.ResourceCPU}
 
 		collector := NewBinpackingCollector(nodeLister, podLister, logger, resources, labelGroups, true, nil, nil)
@@ -844,9 +846,9 @@ func TestBinpackingCollector_LabelGrouping(t *testing.T) {
 
 	t.Run("multiple groups", func(t *testing.T) {
 		// Two separate groups: one single-key, one multi-key
-		labelGroups := [][]string{
-			{"topology.kubernetes.io/zone"},
-			{"topology.kubernetes.io/zone", "node.kubernetes.io/instance-type"},
+		labelGroups := []LabelGroup{
+			newLabelGroup("topology.kubernetes.io/zone"),
+			newLabelGroup("topology.kubernetes.io/zone", "node.kubernetes.io/instance-type"),
 		}
 		resources := []corev1.ResourceName{corev1.ResourceCPU}
 
@@ -880,7 +882,7 @@ func TestBinpackingCollector_LabelGrouping(t *testing.T) {
 
 	t.Run("missing labels use none", func(t *testing.T) {
 		// node-no-zone is missing the zone label, should get <none>
-		labelGroups := [][]string{{"topology.kubernetes.io/zone"}}
+		labelGroups := []LabelGroup{newLabelGroup("topology.kubernetes.io/zone")}
 		resources := []corev1.ResourceName{corev1.ResourceCPU}
 
 		collector := NewBinpackingCollector(nodeLister, podLister, logger, resources, labelGroups, true, nil, nil)
@@ -1052,7 +1054,7 @@ func TestBinpackingCollector_LabelGrouping_NoLabels(t *testing.T) {
 	podLister := &fakePodLister{pods: nil}
 
 	// No label groups configured
-	labelGroups := [][]string{}
+	labelGroups := []LabelGroup{}
 	resources := []corev1.ResourceName{corev1.ResourceCPU}
 
 	collector := NewBinpackingCollector(nodeLister, podLister, logger, resources, labelGroups, true, nil, nil)
@@ -1450,7 +1452,7 @@ func TestBinpackingCollector_DaemonSetOverhead_LabelGroups(t *testing.T) {
 	}
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	labelGroups := [][]string{{"topology.kubernetes.io/zone"}}
+	labelGroups := []LabelGroup{newLabelGroup("topology.kubernetes.io/zone")}
 	resources := []corev1.ResourceName{corev1.ResourceCPU}
 	collector := NewBinpackingCollector(
 		&fakeNodeLister{nodes: nodes}, &fakePodLister{pods: pods},
@@ -1481,6 +1483,196 @@ func TestBinpackingCollector_DaemonSetOverhead_LabelGroups(t *testing.T) {
 	}
 }
 
+// TestBinpackingCollector_LabelGroupOptions tests per-group resources, node
+// selectors and the DaemonSet overhead toggle.
+func TestBinpackingCollector_LabelGroupOptions(t *testing.T) {
+	gpuNode := makeNode("gpu-1", "8", "32Gi")
+	gpuNode.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse("4")
+	gpuNode.Labels = map[string]string{"zone": "a", "instance-type": "g5.2xlarge", "gpu": "true"}
+	cpuNode := makeNode("cpu-1", "4", "16Gi")
+	cpuNode.Labels = map[string]string{"zone": "a", "instance-type": "m6i.xlarge"}
+	pods := []*corev1.Pod{
+		makeDaemonSetPod("kube-system", "fluentbit", "gpu-1", "250m", ""),
+	}
+
+	gpuGroup := newLabelGroup("instance-type")
+	gpuGroup.Name = "gpu"
+	gpuGroup.Resources = []corev1.ResourceName{corev1.ResourceCPU, "nvidia.com/gpu"}
+	gpuGroup.NodeSelector = labels.SelectorFromSet(labels.Set{"gpu": "true"})
+	zoneGroup := newLabelGroup("zone")
+	zoneGroup.DisableDaemonsetOverhead = true
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	collector := NewBinpackingCollector(
+		&fakeNodeLister{nodes: []*corev1.Node{gpuNode, cpuNode}}, &fakePodLister{pods: pods},
+		logger, []corev1.ResourceName{corev1.ResourceCPU}, []LabelGroup{gpuGroup, zoneGroup}, false, nil, nil,
+	)
+	metrics := collectMetrics(collector)
+
+	if v, ok := findMetricValue(t, metrics, "kube_binpacking_group_allocatable",
+		map[string]string{"label_group": "gpu", "label_group_value": "g5.2xlarge", "resource": "nvidia.com/gpu"}); !ok || v != 4 {
+		t.Errorf("gpu group nvidia.com/gpu allocatable = %v, %v, want 4", v, ok)
+	}
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_group_node_count",
+		map[string]string{"label_group": "gpu", "label_group_value": "m6i.xlarge"}); ok {
+		t.Error("node not matching the gpu group's selector should not be grouped")
+	}
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_group_allocatable",
+		map[string]string{"label_group": "zone", "resource": "nvidia.com/gpu"}); ok {
+		t.Error("zone group should only track the global resources")
+	}
+	if v, ok := findMetricValue(t, metrics, "kube_binpacking_group_node_count",
+		map[string]string{"label_group": "zone", "label_group_value": "a"}); !ok || v != 2 {
+		t.Errorf("zone group node count = %v, %v, want 2", v, ok)
+	}
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_group_daemonset_overhead",
+		map[string]string{"label_group": "gpu", "resource": "cpu"}); !ok {
+		t.Error("gpu group should emit DaemonSet overhead")
+	}
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_group_daemonset_overhead",
+		map[string]string{"label_group": "zone"}); ok {
+		t.Error("zone group has DaemonSet overhead disabled")
+	}
+}
+
+// TestBinpackingCollector_SelectorGroups tests that selector groups emit the
+// group metrics under a group label, with overlapping membership.
+func TestBinpackingCollector_SelectorGroups(t *testing.T) {
+	nodeA := makeNode("node-a", "4", "8Gi")
+	nodeA.Labels = map[string]string{"pool": "a", "workload": "batch"}
+	nodeB := makeNode("node-b", "8", "16Gi")
+	nodeB.Labels = map[string]string{"pool": "b"}
+	nodeGPU := makeNode("node-gpu", "16", "64Gi")
+	nodeGPU.Labels = map[string]string{"pool": "a", "gpu": "true"}
+	pods := []*corev1.Pod{
+		makePodWithResources("default", "app", "node-a", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "2", "1Gi")}, nil),
+	}
+
+	general, _ := labels.Parse("pool in (a,b),!gpu")
+	batch, _ := labels.Parse("workload=batch")
+	empty, _ := labels.Parse("pool=c")
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	collector := NewBinpackingCollector(
+		&fakeNodeLister{nodes: []*corev1.Node{nodeA, nodeB, nodeGPU}}, &fakePodLister{pods: pods},
+		logger, []corev1.ResourceName{corev1.ResourceCPU}, nil, false, nil, nil,
+	)
+	s := collector.Settings()
+	s.SelectorGroups = []SelectorGroup{{Name: "general", Selector: general}, {Name: "batch", Selector: batch}, {Name: "empty", Selector: empty}}
+	collector.Reconfigure(s)
+	metrics := collectMetrics(collector)
+
+	tests := []struct {
+		group       string
+		nodes       float64
+		allocatable float64
+		allocated   float64
+	}{
+		{group: "general", nodes: 2, allocatable: 12, allocated: 2},
+		{group: "batch", nodes: 1, allocatable: 4, allocated: 2},
+		{group: "empty", nodes: 0, allocatable: 0, allocated: 0},
+	}
+	for _, tt := range tests {
+		groupLabels := map[string]string{"group": tt.group, "label_group": "", "label_group_value": ""}
+		if v, ok := findMetricValue(t, metrics, "kube_binpacking_group_node_count", groupLabels); !ok || v != tt.nodes {
+			t.Errorf("%s node_count = %v, %v, want %v", tt.group, v, ok, tt.nodes)
+		}
+		groupLabels["resource"] = "cpu"
+		if v, ok := findMetricValue(t, metrics, "kube_binpacking_group_allocatable", groupLabels); !ok || v != tt.allocatable {
+			t.Errorf("%s allocatable = %v, %v, want %v", tt.group, v, ok, tt.allocatable)
+		}
+		if v, ok := findMetricValue(t, metrics, "kube_binpacking_group_allocated", groupLabels); !ok || v != tt.allocated {
+			t.Errorf("%s allocated = %v, %v, want %v", tt.group, v, ok, tt.allocated)
+		}
+	}
+}
+
+// TestBinpackingCollector_MetricNamespace tests that the metric prefix and
+// constant labels apply to every binpacking metric.
+func TestBinpackingCollector_MetricNamespace(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	node := makeNode("node-1", "4", "8Gi")
+	node.Labels = map[string]string{"zone": "a"}
+	collector := NewBinpackingCollector(
+		&fakeNodeLister{nodes: []*corev1.Node{node}}, &fakePodLister{},
+		logger, []corev1.ResourceName{corev1.ResourceCPU}, []LabelGroup{newLabelGroup("zone")}, true, nil, nil,
+		WithMetricNamespace("acme_binpacking", prometheus.Labels{"cluster": "prod-eu1"}),
+	)
+	metrics := collectMetrics(collector)
+	if len(metrics) == 0 {
+		t.Fatal("no metrics collected")
+	}
+
+	for _, m := range metrics {
+		desc := m.Desc().String()
+		if !contains(desc, `"acme_binpacking_`) {
+			t.Errorf("metric %s does not use the configured namespace", desc)
+		}
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatalf("writing metric: %v", err)
+		}
+		var cluster string
+		for _, lp := range pb.GetLabel() {
+			if lp.GetName() == "cluster" {
+				cluster = lp.GetValue()
+			}
+		}
+		if cluster != "prod-eu1" {
+			t.Errorf("metric %s has cluster=%q, want prod-eu1", desc, cluster)
+		}
+	}
+	if v, ok := findMetricValue(t, metrics, "acme_binpacking_cluster_node_count", nil); !ok || v != 1 {
+		t.Errorf("acme_binpacking_cluster_node_count = %v, %v, want 1", v, ok)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(collector); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Errorf("Gather() error = %v", err)
+	}
+}
+
+// TestLabelGroup_CompositeValue tests relabel rules and the default value
+// for missing labels.
+func TestLabelGroup_CompositeValue(t *testing.T) {
+	family := RelabelRule{Key: "instance-type", Regex: regexp.MustCompile(`^(?:([^.]+)\..*)$`), Replacement: "$1"}
+	region := RelabelRule{Key: "zone", Regex: regexp.MustCompile(`^(?:(.*)[a-z])$`), Replacement: "$1"}
+	drop := RelabelRule{Key: "zone", Regex: regexp.MustCompile(`^(?:local-.*)$`), Replacement: ""}
+
+	tests := []struct {
+		name   string
+		group  LabelGroup
+		labels map[string]string
+		want   string
+	}{
+		{name: "no rules", group: newLabelGroup("zone", "instance-type"),
+			labels: map[string]string{"zone": "us-east-1a", "instance-type": "m6i.2xlarge"}, want: "us-east-1a,m6i.2xlarge"},
+		{name: "missing label", group: newLabelGroup("zone"), labels: nil, want: "<none>"},
+		{name: "custom default", group: LabelGroup{Keys: []string{"zone"}, DefaultValue: "unknown"}, labels: nil, want: "unknown"},
+		{name: "instance family", group: LabelGroup{Keys: []string{"instance-type"}, Relabel: []RelabelRule{family}},
+			labels: map[string]string{"instance-type": "m6i.2xlarge"}, want: "m6i"},
+		{name: "region from zone", group: LabelGroup{Keys: []string{"zone", "instance-type"}, Relabel: []RelabelRule{region, family}},
+			labels: map[string]string{"zone": "us-east-1a", "instance-type": "m6i.2xlarge"}, want: "us-east-1,m6i"},
+		{name: "no match leaves value", group: LabelGroup{Keys: []string{"instance-type"}, Relabel: []RelabelRule{family}},
+			labels: map[string]string{"instance-type": "custom"}, want: "custom"},
+		{name: "empty result uses default", group: LabelGroup{Keys: []string{"zone"}, Relabel: []RelabelRule{drop}, DefaultValue: "unknown"},
+			labels: map[string]string{"zone": "local-1"}, want: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := makeNode("node-1", "4", "8Gi")
+			node.Labels = tt.labels
+			if got := tt.group.compositeValue(node, time.Now()); got != tt.want {
+				t.Errorf("compositeValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestBinpackingCollector_DaemonSetOverhead_DisableNodeMetrics tests that
 // node-level DS metrics are suppressed when node metrics are disabled,
 // but cluster-level DS metrics are still emitted.
@@ -1522,3 +1714,104 @@ func TestBinpackingCollector_DaemonSetOverhead_DisableNodeMetrics(t *testing.T)
 		t.Errorf("Expected 2 cluster DS metrics, got %d", clusterDSCount)
 	}
 }
+
+// collectMetrics runs Collect on the collector and returns every emitted metric.
+func collectMetrics(c prometheus.Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric, 1000)
+	c.Collect(ch)
+	close(ch)
+
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// findMetricValue returns the gauge value of the first metric with the given
+// fully-qualified name whose labels include all of wantLabels.
+func findMetricValue(t *testing.T, metrics []prometheus.Metric, name string, wantLabels map[string]string) (float64, bool) {
+	t.Helper()
+	for _, m := range metrics {
+		if !contains(m.Desc().String(), `"`+name+`"`) {
+			continue
+		}
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatalf("writing metric %s: %v", name, err)
+		}
+		got := make(map[string]string, len(pb.GetLabel()))
+		for _, lp := range pb.GetLabel() {
+			got[lp.GetName()] = lp.GetValue()
+		}
+		matched := true
+		for k, v := range wantLabels {
+			if got[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return pb.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// TestBinpackingCollector_HeadroomTargets tests headroom surplus and compliance
+// metrics computed from label-group totals.
+func TestBinpackingCollector_HeadroomTargets(t *testing.T) {
+	nodes := []*corev1.Node{
+		makeNode("node-a-1", "4", "8Gi"),
+		makeNode("node-a-2", "4", "8Gi"),
+		makeNode("node-b-1", "4", "8Gi"),
+	}
+	nodes[0].Labels = map[string]string{"zone": "a"}
+	nodes[1].Labels = map[string]string{"zone": "a"}
+	nodes[2].Labels = map[string]string{"zone": "b"}
+
+	pods := []*corev1.Pod{
+		// zone a: 3 CPU allocated of 8 → 5 free
+		makePodWithResources("default", "pod-1", "node-a-1", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "3", "1Gi")}, nil),
+		// zone b: 3.5 CPU allocated of 4 → 0.5 free
+		makePodWithResources("default", "pod-2", "node-b-1", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "3500m", "1Gi")}, nil),
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	resources := []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+	targets := HeadroomTargets{"zone": {corev1.ResourceCPU: 2}}
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{pods: pods},
+		logger, resources, []LabelGroup{newLabelGroup("zone")}, true, nil, nil)
+	s := collector.Settings()
+	s.HeadroomTargets = targets
+	collector.Reconfigure(s)
+	metrics := collectMetrics(collector)
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"kube_binpacking_group_headroom_surplus", map[string]string{"label_group_value": "a", "resource": "cpu"}, 3},
+		{"kube_binpacking_group_headroom_target_met", map[string]string{"label_group_value": "a", "resource": "cpu"}, 1},
+		{"kube_binpacking_group_headroom_surplus", map[string]string{"label_group_value": "b", "resource": "cpu"}, -1.5},
+		{"kube_binpacking_group_headroom_target_met", map[string]string{"label_group_value": "b", "resource": "cpu"}, 0},
+	}
+	for _, tt := range tests {
+		got, ok := findMetricValue(t, metrics, tt.name, tt.labels)
+		if !ok {
+			t.Errorf("%s%v not emitted", tt.name, tt.labels)
+			continue
+		}
+		if !floatEquals(got, tt.want) {
+			t.Errorf("%s%v = %v, want %v", tt.name, tt.labels, got, tt.want)
+		}
+	}
+
+	// Memory has no target, so no headroom series should be emitted for it.
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_group_headroom_surplus", map[string]string{"resource": "memory"}); ok {
+		t.Error("headroom metrics should only be emitted for resources with a target")
+	}
+}
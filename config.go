@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// labelGroupsKey is the config file key for named label groups. Every other
+// top-level key is a flag name.
+const labelGroupsKey = "label-groups"
+
+// labelGroupConfig is a named label group with per-group settings, as
+// written in the config file:
+//
+//	label-groups:
+//	  - name: gpu
+//	    labels: [node.kubernetes.io/instance-type]
+//	    resources: [cpu, memory, nvidia.com/gpu]
+//	    node-selector: nvidia.com/gpu.present=true
+//	    daemonset-overhead: false
+//	    relabel:
+//	      - label: node.kubernetes.io/instance-type
+//	        regex: '([^.]+)\..*'
+//	    default: unknown
+//	    headroom: {cpu: "8", memory: 32Gi}
+type labelGroupConfig struct {
+	Name              string                                    `json:"name"`
+	Labels            []string                                  `json:"labels"`
+	Resources         []corev1.ResourceName                     `json:"resources,omitempty"`
+	NodeSelector      string                                    `json:"node-selector,omitempty"`
+	DaemonsetOverhead *bool                                     `json:"daemonset-overhead,omitempty"`
+	Relabel           []relabelConfig                           `json:"relabel,omitempty"`
+	Default           string                                    `json:"default,omitempty"`
+	Headroom          map[corev1.ResourceName]resource.Quantity `json:"headroom,omitempty"`
+}
+
+// relabelConfig is a relabel rule as written in the config file. Regex
+// defaults to (.*) and Replacement to $1, as in Prometheus.
+type relabelConfig struct {
+	Label       string  `json:"label"`
+	Regex       string  `json:"regex,omitempty"`
+	Replacement *string `json:"replacement,omitempty"`
+}
+
+// labelGroup validates the config and returns its LabelGroup. The name
+// defaults to the comma-joined label keys, as for --label-group; resources
+// default to the global --resources.
+func (c labelGroupConfig) labelGroup() (LabelGroup, error) {
+	var keys []string
+	for _, key := range c.Labels {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return LabelGroup{}, fmt.Errorf("label group %q has no labels", c.Name)
+	}
+	group := newLabelGroup(keys...)
+	if c.Name != "" {
+		group.Name = c.Name
+	}
+
+	for _, res := range c.Resources {
+		if res = corev1.ResourceName(strings.TrimSpace(string(res))); res != "" {
+			group.Resources = append(group.Resources, res)
+		}
+	}
+	if c.Resources != nil && len(group.Resources) == 0 {
+		return LabelGroup{}, fmt.Errorf("label group %q has an empty resource list", group.Name)
+	}
+
+	if c.NodeSelector != "" {
+		sel, err := labels.Parse(c.NodeSelector)
+		if err != nil {
+			return LabelGroup{}, fmt.Errorf("label group %q: invalid node selector %q: %w", group.Name, c.NodeSelector, err)
+		}
+		group.NodeSelector = sel
+	}
+	group.DisableDaemonsetOverhead = c.DaemonsetOverhead != nil && !*c.DaemonsetOverhead
+
+	for _, rc := range c.Relabel {
+		rule, err := rc.rule(keys)
+		if err != nil {
+			return LabelGroup{}, fmt.Errorf("label group %q: %w", group.Name, err)
+		}
+		group.Relabel = append(group.Relabel, rule)
+	}
+	group.DefaultValue = c.Default
+	return group, nil
+}
+
+// rule validates the config against the group's label keys and compiles the
+// anchored regex.
+func (c relabelConfig) rule(keys []string) (RelabelRule, error) {
+	if !slices.Contains(keys, c.Label) {
+		return RelabelRule{}, fmt.Errorf("relabel rule for %q: not one of the group's labels", c.Label)
+	}
+	regex := c.Regex
+	if regex == "" {
+		regex = "(.*)"
+	}
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		return RelabelRule{}, fmt.Errorf("relabel rule for %q: invalid regex: %w", c.Label, err)
+	}
+	replacement := "$1"
+	if c.Replacement != nil {
+		replacement = *c.Replacement
+	}
+	return RelabelRule{Key: c.Label, Regex: re, Replacement: replacement}, nil
+}
+
+// headroomTarget converts the group's headroom quantities to floats.
+func (c labelGroupConfig) headroomTarget() map[corev1.ResourceName]float64 {
+	target := make(map[corev1.ResourceName]float64, len(c.Headroom))
+	for res, qty := range c.Headroom {
+		target[res] = qty.AsApproximateFloat64()
+	}
+	return target
+}
+
+// applyConfigFile reads a YAML config file and sets each flag it names on fs,
+// except those in explicit (given on the command line or environment). Lists
+// set repeatable flags once per element and are comma-joined for other flags.
+// It returns the named label groups.
+func applyConfigFile(fs *flag.FlagSet, path string, explicit map[string]bool) ([]labelGroupConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &entries); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: expected a mapping of option names: %w", path, err)
+	}
+
+	var groups []labelGroupConfig
+	for name, raw := range entries {
+		if name == labelGroupsKey {
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&groups); err != nil {
+				return nil, fmt.Errorf("config file %s: %s: %w", path, labelGroupsKey, err)
+			}
+			continue
+		}
+
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return nil, fmt.Errorf("config file %s: unknown option %q", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		values, err := configValues(raw)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, name, err)
+		}
+		if _, repeatable := f.Value.(*stringSliceFlag); !repeatable {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return nil, fmt.Errorf("config file %s: %s: %w", path, name, err)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// configValues converts a config file value (scalar or list of scalars) to
+// flag value strings.
+func configValues(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		switch item := item.(type) {
+		case string, json.Number, bool:
+			values = append(values, fmt.Sprint(item))
+		default:
+			return nil, fmt.Errorf("expected a scalar or a list of scalars")
+		}
+	}
+	return values, nil
+}
+
+// reloadTarget applies reloaded settings to the running exporter: a single
+// cluster's clusterConn, or the ClusterSet in multi-cluster mode.
+type reloadTarget interface {
+	Apply(ctx context.Context, selector string, settings CollectorSettings) error
+}
+
+// configReloader polls the --config file and the pricing table it points to,
+// and applies changes to the running exporter: collector settings are swapped
+// in place and the node informer is restarted only when the node selector
+// changes. Options that need a restart are reported but not applied.
+type configReloader struct {
+	args     []string
+	interval time.Duration
+	startup  *options // restart-only options stay as they were at startup
+	target   reloadTarget
+	logger   *slog.Logger
+
+	// pricingFile is the --pricing-file of the configuration in effect.
+	pricingFile string
+	// lastConfig and lastPricing are the file contents last applied
+	// successfully; a failed reload is retried on the next check.
+	lastConfig  []byte
+	lastPricing []byte
+}
+
+// Run checks the config and pricing files every interval until the context
+// is cancelled. File contents are compared rather than modification times,
+// because a mounted ConfigMap is updated by swapping a symlink.
+func (r *configReloader) Run(ctx context.Context) {
+	r.pricingFile = r.startup.pricingFile
+	r.lastConfig, r.lastPricing, _ = r.readFiles()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		config, pricing, err := r.readFiles()
+		if err != nil {
+			r.logger.Warn("failed to read config file", "error", err)
+			continue
+		}
+		if bytes.Equal(config, r.lastConfig) && bytes.Equal(pricing, r.lastPricing) {
+			continue
+		}
+
+		pricingFile := r.pricingFile
+		if err := r.reload(ctx); err != nil {
+			r.logger.Error("config reload failed, keeping previous configuration", "path", r.startup.configFile, "error", err)
+			continue
+		}
+		if r.pricingFile != pricingFile {
+			// The config now points to another pricing table.
+			config, pricing, _ = r.readFiles()
+		}
+		r.lastConfig, r.lastPricing = config, pricing
+	}
+}
+
+// readFiles reads the config file and the pricing table in effect, if any.
+func (r *configReloader) readFiles() (config, pricing []byte, err error) {
+	if config, err = os.ReadFile(r.startup.configFile); err != nil {
+		return nil, nil, err
+	}
+	if r.pricingFile != "" {
+		if pricing, err = os.ReadFile(r.pricingFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	return config, pricing, nil
+}
+
+// reload re-parses the command line and config file and applies the result.
+// Nothing is applied if the new configuration is invalid.
+func (r *configReloader) reload(ctx context.Context) error {
+	next, err := parseOptions(r.args)
+	if err != nil {
+		return err
+	}
+	settings, err := next.collectorSettings()
+	if err != nil {
+		return err
+	}
+	if err := next.validateReloadable(settings); err != nil {
+		return err
+	}
+
+	if changed := r.startup.restartRequired(next); len(changed) > 0 {
+		sort.Strings(changed)
+		r.logger.Warn("config changes require a restart to take effect", "options", changed)
+	}
+
+	if err := r.target.Apply(ctx, next.nodeSelector, settings); err != nil {
+		return err
+	}
+	r.pricingFile = next.pricingFile
+
+	r.logger.Info("configuration reloaded",
+		"resources", settings.Resources,
+		"label_groups", len(settings.LabelGroups),
+		"node_selector", next.nodeSelector)
+	return nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	return path
+}
+
+// TestParseOptions_ConfigFile verifies config file values fill unset flags,
+// lists map onto repeatable and comma-separated flags, and command-line
+// flags take precedence.
+func TestParseOptions_ConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+resources: [cpu, memory, nvidia.com/gpu]
+label-group:
+  - topology.kubernetes.io/zone
+  - topology.kubernetes.io/zone,node.kubernetes.io/instance-type
+disable-node-metrics: true
+list-page-size: 1000000
+node-selector: "env=production"
+metrics-addr: ":9999"
+label-groups:
+  - name: pool
+    labels: [karpenter.sh/nodepool]
+    headroom: {cpu: 8, memory: 32Gi}
+`)
+
+	opts, err := parseOptions([]string{"--config=" + path, "--metrics-addr=:9101"})
+	if err != nil {
+		t.Fatalf("parseOptions() error = %v", err)
+	}
+
+	if opts.resourceCSV != "cpu,memory,nvidia.com/gpu" {
+		t.Errorf("resources = %q, want cpu,memory,nvidia.com/gpu", opts.resourceCSV)
+	}
+	if len(opts.labelGroupFlags) != 2 {
+		t.Errorf("label-group = %v, want 2 entries", opts.labelGroupFlags)
+	}
+	if !opts.disableNodeMetrics {
+		t.Error("disable-node-metrics = false, want true")
+	}
+	if opts.listPageSize != 1000000 {
+		t.Errorf("list-page-size = %d, want 1000000", opts.listPageSize)
+	}
+	if opts.nodeSelector != "env=production" {
+		t.Errorf("node-selector = %q, want env=production", opts.nodeSelector)
+	}
+	if opts.metricsAddr != ":9101" {
+		t.Errorf("metrics-addr = %q, want the command-line value :9101", opts.metricsAddr)
+	}
+	if len(opts.labelGroupConfigs) != 1 || opts.labelGroupConfigs[0].Name != "pool" {
+		t.Errorf("label-groups = %+v, want the pool group", opts.labelGroupConfigs)
+	}
+}
+
+// TestParseOptions_ConfigFileErrors tests rejected config files.
+func TestParseOptions_ConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown option", content: "no-such-flag: 1", wantErr: "unknown option"},
+		{name: "config is not settable", content: "config: other.yaml", wantErr: "unknown option"},
+		{name: "invalid value", content: "list-page-size: many", wantErr: "list-page-size"},
+		{name: "nested value", content: "resources: {cpu: true}", wantErr: "scalar"},
+		{name: "unknown label group field", content: "label-groups: [{name: a, keys: [zone]}]", wantErr: "label-groups"},
+		{name: "not a mapping", content: "- a\n- b", wantErr: "mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseOptions([]string{"--config=" + writeConfigFile(t, tt.content)})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseOptions() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := parseOptions([]string{"--config=/nonexistent/config.yaml"}); err == nil {
+		t.Error("parseOptions() with missing config file should fail")
+	}
+}
+
+// TestOptions_CollectorSettings verifies named label groups and their
+// headroom targets are merged with flag-defined groups.
+func TestOptions_CollectorSettings(t *testing.T) {
+	path := writeConfigFile(t, `
+label-group: [topology.kubernetes.io/zone]
+headroom-target: ["topology.kubernetes.io/zone:cpu=4"]
+label-groups:
+  - name: pool
+    labels: [karpenter.sh/nodepool]
+    headroom: {cpu: 8, memory: 1Ki}
+  - labels: [node.kubernetes.io/instance-type]
+`)
+	opts, err := parseOptions([]string{"--config=" + path})
+	if err != nil {
+		t.Fatalf("parseOptions() error = %v", err)
+	}
+	settings, err := opts.collectorSettings()
+	if err != nil {
+		t.Fatalf("collectorSettings() error = %v", err)
+	}
+
+	wantGroups := []LabelGroup{
+		{Name: "topology.kubernetes.io/zone", Keys: []string{"topology.kubernetes.io/zone"}},
+		{Name: "pool", Keys: []string{"karpenter.sh/nodepool"}},
+		{Name: "node.kubernetes.io/instance-type", Keys: []string{"node.kubernetes.io/instance-type"}},
+	}
+	if !reflect.DeepEqual(settings.LabelGroups, wantGroups) {
+		t.Errorf("LabelGroups = %+v, want %+v", settings.LabelGroups, wantGroups)
+	}
+	wantHeadroom := HeadroomTargets{
+		"topology.kubernetes.io/zone": {corev1.ResourceCPU: 4},
+		"pool":                        {corev1.ResourceCPU: 8, corev1.ResourceMemory: 1024},
+	}
+	if !reflect.DeepEqual(settings.HeadroomTargets, wantHeadroom) {
+		t.Errorf("HeadroomTargets = %v, want %v", settings.HeadroomTargets, wantHeadroom)
+	}
+
+	t.Run("duplicate name", func(t *testing.T) {
+		opts, err := parseOptions([]string{"--label-group=zone", "--config=" + writeConfigFile(t, "label-groups: [{labels: [zone]}]")})
+		if err != nil {
+			t.Fatalf("parseOptions() error = %v", err)
+		}
+		if _, err := opts.collectorSettings(); err == nil {
+			t.Error("collectorSettings() with duplicate group name should fail")
+		}
+	})
+
+	t.Run("group options", func(t *testing.T) {
+		opts, err := parseOptions([]string{"--config=" + writeConfigFile(t, `
+label-groups:
+  - name: gpu
+    labels: [node.kubernetes.io/instance-type]
+    resources: [cpu, nvidia.com/gpu]
+    node-selector: nvidia.com/gpu.present=true
+    daemonset-overhead: false
+  - labels: [topology.kubernetes.io/zone]
+    daemonset-overhead: true
+    relabel:
+      - label: topology.kubernetes.io/zone
+        regex: '(.*)[a-z]'
+    default: unknown
+`)})
+		if err != nil {
+			t.Fatalf("parseOptions() error = %v", err)
+		}
+		settings, err := opts.collectorSettings()
+		if err != nil {
+			t.Fatalf("collectorSettings() error = %v", err)
+		}
+		gpu, zone := settings.LabelGroups[0], settings.LabelGroups[1]
+		if !reflect.DeepEqual(gpu.Resources, []corev1.ResourceName{"cpu", "nvidia.com/gpu"}) {
+			t.Errorf("gpu Resources = %v, want [cpu nvidia.com/gpu]", gpu.Resources)
+		}
+		if gpu.NodeSelector == nil || gpu.NodeSelector.String() != "nvidia.com/gpu.present=true" {
+			t.Errorf("gpu NodeSelector = %v, want nvidia.com/gpu.present=true", gpu.NodeSelector)
+		}
+		if !gpu.DisableDaemonsetOverhead {
+			t.Error("gpu DisableDaemonsetOverhead = false, want true")
+		}
+		if zone.Resources != nil || zone.NodeSelector != nil || zone.DisableDaemonsetOverhead {
+			t.Errorf("zone group = %+v, want default resources, selector and overhead", zone)
+		}
+		node := makeNode("node-1", "4", "8Gi")
+		node.Labels = map[string]string{"topology.kubernetes.io/zone": "eu-west-1b"}
+		if got := zone.compositeValue(node, time.Now()); got != "eu-west-1" {
+			t.Errorf("relabeled zone = %q, want eu-west-1", got)
+		}
+		if got := zone.compositeValue(makeNode("node-2", "4", "8Gi"), time.Now()); got != "unknown" {
+			t.Errorf("missing zone = %q, want the default unknown", got)
+		}
+	})
+
+	for name, content := range map[string]string{
+		"invalid group node selector": "label-groups: [{labels: [zone], node-selector: \"env in (\"}]",
+		"empty group resources":       "label-groups: [{labels: [zone], resources: []}]",
+		"relabel unknown label":       "label-groups: [{labels: [zone], relabel: [{label: region}]}]",
+		"unknown node field":          "label-group: [\"@nope\"]",
+		"relabel invalid regex":       "label-groups: [{labels: [zone], relabel: [{label: zone, regex: \"(\"}]}]",
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts, err := parseOptions([]string{"--config=" + writeConfigFile(t, content)})
+			if err != nil {
+				t.Fatalf("parseOptions() error = %v", err)
+			}
+			if _, err := opts.collectorSettings(); err == nil {
+				t.Error("collectorSettings() should fail")
+			}
+		})
+	}
+
+	t.Run("group without labels", func(t *testing.T) {
+		opts, err := parseOptions([]string{"--config=" + writeConfigFile(t, "label-groups: [{name: empty}]")})
+		if err != nil {
+			t.Fatalf("parseOptions() error = %v", err)
+		}
+		if _, err := opts.collectorSettings(); err == nil {
+			t.Error("collectorSettings() with a group without labels should fail")
+		}
+	})
+}
+
+// TestOptions_RestartRequired verifies only non-reloadable changes are reported.
+func TestOptions_RestartRequired(t *testing.T) {
+	before, err := parseOptions([]string{"--resources=cpu", "--metrics-addr=:9101"})
+	if err != nil {
+		t.Fatalf("parseOptions() error = %v", err)
+	}
+	after, err := parseOptions([]string{"--resources=cpu,memory", "--metrics-addr=:9102", "--node-selector=env=prod"})
+	if err != nil {
+		t.Fatalf("parseOptions() error = %v", err)
+	}
+	if got := before.restartRequired(after); !reflect.DeepEqual(got, []string{"metrics-addr"}) {
+		t.Errorf("restartRequired() = %v, want [metrics-addr]", got)
+	}
+}
+
+// TestConfigReloader_Reload verifies a changed config file is applied to the
+// running collector, the node informer is restarted for a new selector, and
+// an invalid file leaves the previous configuration in place.
+func TestConfigReloader_Reload(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prod := makeNode("prod-1", "4", "8Gi")
+	prod.Labels = map[string]string{"env": "production", "zone": "a"}
+	clientset := fake.NewClientset(prod, makeNode("dev-1", "4", "8Gi"))
+	nodes, err := newNodeSource(ctx, clientset, 0, 0, "", NodeFields{}, &InformerFreshness{}, nil, logger)
+	if err != nil {
+		t.Fatalf("newNodeSource() error = %v", err)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), nodes.HasSynced) {
+		t.Fatal("node informer did not sync")
+	}
+
+	path := writeConfigFile(t, "resources: [cpu]\n")
+	args := []string{"--config=" + path}
+	opts, err := parseOptions(args)
+	if err != nil {
+		t.Fatalf("parseOptions() error = %v", err)
+	}
+	collector := NewBinpackingCollector(nodes, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil)
+	reloader := &configReloader{args: args, startup: opts, target: &clusterConn{nodes: nodes, collector: collector}, logger: logger}
+
+	if err := os.WriteFile(path, []byte(`
+resources: [cpu, memory]
+node-selector: env=production
+label-groups:
+  - name: zone
+    labels: [zone]
+`), 0o600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	if err := reloader.reload(ctx); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+
+	settings := collector.Settings()
+	if len(settings.Resources) != 2 || len(settings.LabelGroups) != 1 {
+		t.Errorf("settings after reload = %+v, want 2 resources and 1 label group", settings)
+	}
+	metrics := collectMetrics(collector)
+	if v, ok := findMetricValue(t, metrics, "kube_binpacking_cluster_node_count", nil); !ok || v != 1 {
+		t.Errorf("cluster_node_count = %v, want 1 (node selector applied)", v)
+	}
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_group_node_count",
+		map[string]string{"label_group": "zone", "label_group_value": "a"}); !ok {
+		t.Error("group_node_count for the named group should be emitted")
+	}
+
+	if err := os.WriteFile(path, []byte(`
+node-selector: env=production
+label-groups:
+  - labels: ["@kubeletVersion"]
+`), 0o600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	if err := reloader.reload(ctx); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if !nodes.Fields().NodeInfo {
+		t.Error("node informer should be restarted to keep nodeInfo for @kubeletVersion")
+	}
+
+	if err := os.WriteFile(path, []byte("node-selector: \"env in (\"\n"), 0o600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	if err := reloader.reload(ctx); err == nil {
+		t.Error("reload() with an invalid node selector should fail")
+	}
+	if got := nodes.Selector(); got != "env=production" {
+		t.Errorf("Selector() after failed reload = %q, want env=production", got)
+	}
+	if list, _ := nodes.List(labels.Everything()); len(list) != 1 {
+		t.Errorf("List() after failed reload = %d nodes, want 1", len(list))
+	}
+}
+
+// flakyReloadTarget fails the first failures Apply calls and records the
+// settings of the others.
+type flakyReloadTarget struct {
+	mu       sync.Mutex
+	failures int
+	applied  []CollectorSettings
+}
+
+func (f *flakyReloadTarget) Apply(_ context.Context, _ string, settings CollectorSettings) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("informer restart timed out")
+	}
+	f.applied = append(f.applied, settings)
+	return nil
+}
+
+func (f *flakyReloadTarget) appliedSettings() []CollectorSettings {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.applied)
+}
+
+// TestConfigReloader_Run verifies a failed reload is retried without another
+// file change, and that edits to the pricing file alone are picked up.
+func TestConfigReloader_Run(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	pricingPath := filepath.Join(t.TempDir(), "pricing.yaml")
+	writePricing := func(price string) {
+		t.Helper()
+		if err := os.WriteFile(pricingPath, []byte("labelKeys: [pool]\ndefaultHourlyPrice: "+price+"\nprices: []\n"), 0o600); err != nil {
+			t.Fatalf("writing pricing file: %v", err)
+		}
+	}
+	writePricing("1")
+	path := writeConfigFile(t, "resources: [cpu]\npricing-file: "+pricingPath+"\n")
+	args := []string{"--config=" + path}
+	opts, err := parseOptions(args)
+	if err != nil {
+		t.Fatalf("parseOptions() error = %v", err)
+	}
+
+	target := &flakyReloadTarget{failures: 1}
+	reloader := &configReloader{args: args, interval: 10 * time.Millisecond, startup: opts, target: target, logger: logger}
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		reloader.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	waitApplied := func(n int) []CollectorSettings {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if applied := target.appliedSettings(); len(applied) >= n {
+				return applied
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("reloader applied %d configurations, want %d", len(target.appliedSettings()), n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond) // let Run record the initial contents
+	if err := os.WriteFile(path, []byte("resources: [cpu, memory]\npricing-file: "+pricingPath+"\n"), 0o600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	if applied := waitApplied(1); len(applied[0].Resources) != 2 {
+		t.Errorf("resources after retried reload = %v, want cpu and memory", applied[0].Resources)
+	}
+
+	writePricing("2")
+	applied := waitApplied(2)
+	if price, ok := applied[1].Pricing.NodePrice(makeNode("node-1", "4", "8Gi")); !ok || price != 2 {
+		t.Errorf("hourly price after pricing file edit = %v, %v, want 2", price, ok)
+	}
+}
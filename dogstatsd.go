@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Maximum DogStatsD datagram sizes: the agent's recommended UDP payload,
+// and its default Unix socket buffer.
+const (
+	dogstatsdMaxUDPPacket  = 1432
+	dogstatsdMaxUnixPacket = 8192
+)
+
+// dogstatsdTagReplacer replaces characters that delimit DogStatsD fields or
+// tags in tag values.
+var dogstatsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// DogStatsDEmitter gathers the binpacking registry every interval and sends
+// each gauge to a DogStatsD agent, with the metric labels as tags, named as
+// described in datadogName.
+type DogStatsDEmitter struct {
+	conn            net.Conn
+	maxPacket       int
+	gatherer        prometheus.Gatherer
+	interval        time.Duration
+	metricNamespace string
+	instance        string
+	logger          *slog.Logger
+}
+
+// NewDogStatsDEmitter connects to addr: host:port or udp://host:port for
+// UDP, unix:///path for a Unix datagram socket. metricNamespace is the
+// --metric-namespace the gathered metrics are named with. instance is sent
+// as the instance tag, since every replica emits its own gauges.
+func NewDogStatsDEmitter(addr string, gatherer prometheus.Gatherer, interval time.Duration, metricNamespace, instance string, logger *slog.Logger) (*DogStatsDEmitter, error) {
+	network, address, maxPacket := "udp", strings.TrimPrefix(addr, "udp://"), dogstatsdMaxUDPPacket
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		network, address, maxPacket = "unixgram", path, dogstatsdMaxUnixPacket
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to DogStatsD at %s: %w", addr, err)
+	}
+	return &DogStatsDEmitter{
+		conn:            conn,
+		maxPacket:       maxPacket,
+		gatherer:        gatherer,
+		interval:        interval,
+		metricNamespace: metricNamespace,
+		instance:        instance,
+		logger:          logger,
+	}, nil
+}
+
+// Run emits every interval until the context is cancelled, then closes the
+// connection.
+func (e *DogStatsDEmitter) Run(ctx context.Context) {
+	defer e.conn.Close()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := e.emit(); err != nil {
+			e.logger.Warn("DogStatsD emit failed", "error", err)
+		}
+	}
+}
+
+// emit gathers the registry and sends the gauges, packing as many lines as
+// fit in each datagram. Nothing is sent if gathering fails, since gauges
+// missing from a partial gather would look like they went away.
+func (e *DogStatsDEmitter) emit() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics: %w", err)
+	}
+
+	var packet []byte
+	for _, line := range dogstatsdLines(families, e.metricNamespace, e.instance) {
+		if len(packet) > 0 && len(packet)+1+len(line) > e.maxPacket {
+			if _, err := e.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		if _, err := e.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dogstatsdLines formats every gauge as a DogStatsD gauge line,
+// <name>:<value>|g|#<label>:<value>,... Empty labels are left out. Gauges
+// without an instance label are tagged with instance if non-empty.
+func dogstatsdLines(families []*dto.MetricFamily, metricNamespace, instance string) []string {
+	var lines []string
+	for _, mf := range families {
+		if mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		name := datadogName(mf.GetName(), metricNamespace)
+		for _, m := range mf.GetMetric() {
+			var b strings.Builder
+			b.WriteString(name)
+			b.WriteByte(':')
+			b.WriteString(strconv.FormatFloat(m.GetGauge().GetValue(), 'g', -1, 64))
+			b.WriteString("|g")
+			sep := "|#"
+			hasInstance := false
+			for _, lp := range m.GetLabel() {
+				if lp.GetValue() == "" {
+					continue
+				}
+				b.WriteString(sep)
+				b.WriteString(lp.GetName())
+				b.WriteByte(':')
+				b.WriteString(dogstatsdTagReplacer.Replace(lp.GetValue()))
+				sep = ","
+				hasInstance = hasInstance || lp.GetName() == "instance"
+			}
+			if instance != "" && !hasInstance {
+				b.WriteString(sep)
+				b.WriteString("instance:")
+				b.WriteString(dogstatsdTagReplacer.Replace(instance))
+			}
+			lines = append(lines, b.String())
+		}
+	}
+	return lines
+}
+
+// datadogName separates the metric namespace from the rest of the name with
+// a dot: kube_binpacking_node_utilization_ratio becomes
+// kube_binpacking.node_utilization_ratio. Names outside the namespace are
+// kept.
+func datadogName(name, metricNamespace string) string {
+	rest, ok := strings.CutPrefix(name, metricNamespace+"_")
+	if !ok {
+		return name
+	}
+	return metricNamespace + "." + rest
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDatadogName(t *testing.T) {
+	tests := []struct {
+		name, namespace, want string
+	}{
+		{"kube_binpacking_node_utilization_ratio", "kube_binpacking", "kube_binpacking.node_utilization_ratio"},
+		{"kube_binpacking_cluster_allocated", "kube_binpacking", "kube_binpacking.cluster_allocated"},
+		{"kube_binpacking_cache_age_seconds", "kube_binpacking", "kube_binpacking.cache_age_seconds"},
+		{"capacity_group_node_count", "capacity", "capacity.group_node_count"},
+		{"other_metric", "kube_binpacking", "other_metric"},
+	}
+	for _, tt := range tests {
+		if got := datadogName(tt.name, tt.namespace); got != tt.want {
+			t.Errorf("datadogName(%q, %q) = %q, want %q", tt.name, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+// newDogStatsDTestRegistry returns a registry with one node in zone a, grouped
+// by a two-key label group whose name contains a comma.
+func newDogStatsDTestRegistry() *prometheus.Registry {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	node := makeNode("node-1", "4", "8Gi")
+	node.Labels = map[string]string{"zone": "a", "pool": "general"}
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: []*corev1.Node{node}}, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, []LabelGroup{newLabelGroup("zone", "pool")}, true, nil, nil)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	return registry
+}
+
+// TestDogStatsDEmitter sends a round of gauges to a local UDP listener and a
+// Unix datagram socket and checks the lines and tags.
+func TestDogStatsDEmitter(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	registry := newDogStatsDTestRegistry()
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer udp.Close()
+	socket := filepath.Join(t.TempDir(), "dsd.socket")
+	unix, err := net.ListenPacket("unixgram", socket)
+	if err != nil {
+		t.Fatalf("listen unixgram: %v", err)
+	}
+	defer unix.Close()
+
+	tests := []struct {
+		name     string
+		addr     string
+		listener net.PacketConn
+	}{
+		{name: "udp", addr: udp.LocalAddr().String(), listener: udp},
+		{name: "unix", addr: "unix://" + socket, listener: unix},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emitter, err := NewDogStatsDEmitter(tt.addr, registry, time.Minute, defaultMetricNamespace, "replica-a", logger)
+			if err != nil {
+				t.Fatalf("NewDogStatsDEmitter() error = %v", err)
+			}
+			defer emitter.conn.Close()
+			if err := emitter.emit(); err != nil {
+				t.Fatalf("emit() error = %v", err)
+			}
+
+			var lines []string
+			buf := make([]byte, dogstatsdMaxUnixPacket)
+			for {
+				_ = tt.listener.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+				n, _, err := tt.listener.ReadFrom(buf)
+				if err != nil {
+					break
+				}
+				if n > emitter.maxPacket {
+					t.Errorf("packet of %d bytes exceeds %d", n, emitter.maxPacket)
+				}
+				lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+			}
+
+			for _, want := range []string{
+				"kube_binpacking.node_allocatable:4|g|#node:node-1,resource:cpu,instance:replica-a",
+				"kube_binpacking.cluster_node_count:1|g|#instance:replica-a",
+				"kube_binpacking.group_node_count:1|g|#label_group:zone_pool,label_group_value:a_general,instance:replica-a",
+			} {
+				if !slices.Contains(lines, want) {
+					t.Errorf("line %q not received", want)
+				}
+			}
+		})
+	}
+}
+
+// failingCollector emits one metric that cannot be gathered.
+type failingCollector struct{ desc *prometheus.Desc }
+
+func (c failingCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.desc }
+func (c failingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.NewInvalidMetric(c.desc, errors.New("collect failed"))
+}
+
+// TestDogStatsDEmitter_GatherError verifies nothing is sent when gathering
+// fails, rather than the families that happened to succeed.
+func TestDogStatsDEmitter_GatherError(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	registry := newDogStatsDTestRegistry()
+	registry.MustRegister(failingCollector{prometheus.NewDesc("failing", "Always fails.", nil, nil)})
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer udp.Close()
+	emitter, err := NewDogStatsDEmitter(udp.LocalAddr().String(), registry, time.Minute, defaultMetricNamespace, "", logger)
+	if err != nil {
+		t.Fatalf("NewDogStatsDEmitter() error = %v", err)
+	}
+	defer emitter.conn.Close()
+
+	if err := emitter.emit(); err == nil {
+		t.Error("emit() should fail when gathering fails")
+	}
+	_ = udp.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, _, err := udp.ReadFrom(make([]byte, dogstatsdMaxUDPPacket)); err == nil {
+		t.Errorf("received %d bytes after a failed gather, want none", n)
+	}
+}
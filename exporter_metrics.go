@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ExporterMetrics are self-observability metrics describing the exporter
+// itself rather than the cluster. They live on their own registry, served on
+// a separate path, so they can be scraped at a different interval. All
+// methods are safe to call on a nil receiver.
+//
+// In multi-cluster mode the collection and informer metrics carry a cluster
+// label; ForCluster returns the metrics one cluster records to.
+type ExporterMetrics struct {
+	collectDuration prometheus.ObserverVec
+	nodesProcessed  *prometheus.GaugeVec
+	podsProcessed   *prometheus.GaugeVec
+	podsSkipped     *prometheus.GaugeVec
+	informerEvents  *prometheus.CounterVec
+	watchErrors     *prometheus.CounterVec
+
+	remoteWriteBatches *prometheus.CounterVec
+	remoteWriteSamples prometheus.Counter
+	remoteWriteQueue   prometheus.Gauge
+}
+
+// Remote-write batch outcomes.
+const (
+	remoteWriteSent    = "sent"
+	remoteWriteFailed  = "failed"  // retryable failure; the batch stays queued
+	remoteWriteDropped = "dropped" // rejected by the endpoint or queue overflow
+)
+
+// NewExporterMetrics creates the exporter self-metrics and registers them,
+// along with Go runtime and process collectors, on reg. With perCluster, the
+// collection and informer metrics are labelled by cluster and must be
+// recorded through ForCluster.
+func NewExporterMetrics(reg prometheus.Registerer, perCluster bool) *ExporterMetrics {
+	var clusterLabels []string
+	if perCluster {
+		clusterLabels = []string{clusterLabel}
+	}
+	m := &ExporterMetrics{
+		collectDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kube_binpacking_exporter_collect_duration_seconds",
+			Help:    "Time taken to compute binpacking metrics from the informer cache",
+			Buckets: []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, clusterLabels),
+		nodesProcessed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kube_binpacking_exporter_nodes_processed",
+			Help: "Number of nodes processed by the last binpacking computation",
+		}, clusterLabels),
+		podsProcessed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kube_binpacking_exporter_pods_processed",
+			Help: "Number of pods counted towards allocation by the last binpacking computation",
+		}, clusterLabels),
+		podsSkipped: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kube_binpacking_exporter_pods_skipped",
+			Help: "Number of pods skipped by the last binpacking computation, by reason (unscheduled, terminated)",
+		}, append([]string{"reason"}, clusterLabels...)),
+		informerEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_binpacking_exporter_informer_events_total",
+			Help: "Informer events received, by object kind and event type (add, update, delete)",
+		}, append([]string{"kind", "type"}, clusterLabels...)),
+		watchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_binpacking_exporter_watch_errors_total",
+			Help: "List/watch errors reported by informers, by object kind",
+		}, append([]string{"kind"}, clusterLabels...)),
+		remoteWriteBatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_binpacking_exporter_remote_write_batches_total",
+			Help: "Remote-write batch send attempts, by result (sent, failed, dropped)",
+		}, []string{"result"}),
+		remoteWriteSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kube_binpacking_exporter_remote_write_samples_total",
+			Help: "Samples successfully sent over remote-write",
+		}),
+		remoteWriteQueue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kube_binpacking_exporter_remote_write_queue_batches",
+			Help: "Remote-write batches waiting to be sent",
+		}),
+	}
+	reg.MustRegister(
+		m.collectDuration,
+		m.nodesProcessed,
+		m.podsProcessed,
+		m.podsSkipped,
+		m.informerEvents,
+		m.watchErrors,
+		m.remoteWriteBatches,
+		m.remoteWriteSamples,
+		m.remoteWriteQueue,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if !perCluster {
+		m.initCollectMetrics()
+	}
+	return m
+}
+
+// ForCluster returns the metrics cluster records its collections and
+// informer events to. The remote-write metrics are shared. It must only be
+// called on metrics created with perCluster.
+func (m *ExporterMetrics) ForCluster(cluster string) *ExporterMetrics {
+	if m == nil {
+		return nil
+	}
+	labels := prometheus.Labels{clusterLabel: cluster}
+	c := *m
+	c.collectDuration = m.collectDuration.MustCurryWith(labels)
+	c.nodesProcessed = m.nodesProcessed.MustCurryWith(labels)
+	c.podsProcessed = m.podsProcessed.MustCurryWith(labels)
+	c.podsSkipped = m.podsSkipped.MustCurryWith(labels)
+	c.informerEvents = m.informerEvents.MustCurryWith(labels)
+	c.watchErrors = m.watchErrors.MustCurryWith(labels)
+	c.initCollectMetrics()
+	return &c
+}
+
+// initCollectMetrics exports the collection metrics before the first
+// computation, as unlabelled metrics would be.
+func (m *ExporterMetrics) initCollectMetrics() {
+	m.collectDuration.WithLabelValues()
+	m.nodesProcessed.WithLabelValues()
+	m.podsProcessed.WithLabelValues()
+}
+
+// observeCollect records one binpacking computation.
+func (m *ExporterMetrics) observeCollect(d time.Duration, nodes int, stats podFilterStats) {
+	if m == nil {
+		return
+	}
+	m.collectDuration.WithLabelValues().Observe(d.Seconds())
+	m.nodesProcessed.WithLabelValues().Set(float64(nodes))
+	m.podsProcessed.WithLabelValues().Set(float64(stats.counted))
+	m.podsSkipped.WithLabelValues(skipReasonUnscheduled).Set(float64(stats.unscheduled))
+	m.podsSkipped.WithLabelValues(skipReasonTerminated).Set(float64(stats.terminated))
+}
+
+// observeRemoteWrite records a remote-write batch outcome and, when sent, its
+// sample count.
+func (m *ExporterMetrics) observeRemoteWrite(result string, samples int) {
+	if m == nil {
+		return
+	}
+	m.remoteWriteBatches.WithLabelValues(result).Inc()
+	m.remoteWriteSamples.Add(float64(samples))
+}
+
+// setRemoteWriteQueue records the number of queued remote-write batches.
+func (m *ExporterMetrics) setRemoteWriteQueue(batches int) {
+	if m == nil {
+		return
+	}
+	m.remoteWriteQueue.Set(float64(batches))
+}
+
+// eventHandler returns an informer event handler counting events of kind.
+func (m *ExporterMetrics) eventHandler(kind string) cache.ResourceEventHandlerFuncs {
+	added := m.informerEvents.WithLabelValues(kind, "add")
+	updated := m.informerEvents.WithLabelValues(kind, "update")
+	deleted := m.informerEvents.WithLabelValues(kind, "delete")
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { added.Inc() },
+		UpdateFunc: func(interface{}, interface{}) { updated.Inc() },
+		DeleteFunc: func(interface{}) { deleted.Inc() },
+	}
+}
+
+// watchErrorHandler returns an informer watch error handler counting errors
+// of kind before delegating to client-go's default logging handler.
+func (m *ExporterMetrics) watchErrorHandler(kind string) cache.WatchErrorHandlerWithContext {
+	errs := m.watchErrors.WithLabelValues(kind)
+	return func(ctx context.Context, r *cache.Reflector, err error) {
+		errs.Inc()
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+	}
+}
+
+// instrumentInformer registers event counting and watch error counting on an
+// informer. It must be called before the informer is started.
+func (m *ExporterMetrics) instrumentInformer(informer cache.SharedIndexInformer, kind string) error {
+	if m == nil {
+		return nil
+	}
+	if err := informer.SetWatchErrorHandlerWithContext(m.watchErrorHandler(kind)); err != nil {
+		return err
+	}
+	_, err := informer.AddEventHandler(m.eventHandler(kind))
+	return err
+}
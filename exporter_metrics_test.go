@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestExporterMetrics_Collect verifies collection self-metrics, including
+// skipped pod counts that were previously only logged.
+func TestExporterMetrics_Collect(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	m := NewExporterMetrics(prometheus.NewRegistry(), false)
+
+	nodes := []*corev1.Node{makeNode("node-1", "4", "8Gi"), makeNode("node-2", "4", "8Gi")}
+	pods := []*corev1.Pod{
+		makePodWithResources("default", "running", "node-1", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil),
+		makePodWithResources("default", "pending", "", corev1.PodPending,
+			[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil),
+		makePodWithResources("default", "done", "node-2", corev1.PodSucceeded,
+			[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil),
+		makePodWithResources("default", "failed", "node-2", corev1.PodFailed,
+			[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil),
+	}
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{pods: pods},
+		logger, []corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil, WithExporterMetrics(m))
+	collectMetrics(collector)
+
+	if got := testutil.ToFloat64(m.nodesProcessed); got != 2 {
+		t.Errorf("nodes_processed = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.podsProcessed); got != 1 {
+		t.Errorf("pods_processed = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.podsSkipped.WithLabelValues("unscheduled")); got != 1 {
+		t.Errorf("pods_skipped{reason=unscheduled} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.podsSkipped.WithLabelValues("terminated")); got != 2 {
+		t.Errorf("pods_skipped{reason=terminated} = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(m.collectDuration); got != 1 {
+		t.Errorf("collect_duration_seconds series = %d, want 1", got)
+	}
+
+	t.Run("nil metrics are a no-op", func(t *testing.T) {
+		var nilMetrics *ExporterMetrics
+		nilMetrics.observeCollect(time.Second, 1, podFilterStats{})
+		if err := nilMetrics.instrumentInformer(nil, "pod"); err != nil {
+			t.Errorf("instrumentInformer() on nil = %v, want nil", err)
+		}
+	})
+}
+
+// TestExporterMetrics_InformerEvents verifies informer events are counted by
+// kind and type.
+func TestExporterMetrics_InformerEvents(t *testing.T) {
+	m := NewExporterMetrics(prometheus.NewRegistry(), false)
+	clientset := fake.NewClientset()
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	podInformer := factory.Core().V1().Pods().Informer()
+	if err := m.instrumentInformer(podInformer, "pod"); err != nil {
+		t.Fatalf("instrumentInformer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default"}}
+	if _, err := clientset.CoreV1().Pods("default").Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("creating pod: %v", err)
+	}
+	if err := clientset.CoreV1().Pods("default").Delete(ctx, "p", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("deleting pod: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if testutil.ToFloat64(m.informerEvents.WithLabelValues("pod", "delete")) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(m.informerEvents.WithLabelValues("pod", "add")); got != 1 {
+		t.Errorf("informer_events_total{kind=pod,type=add} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.informerEvents.WithLabelValues("pod", "delete")); got != 1 {
+		t.Errorf("informer_events_total{kind=pod,type=delete} = %v, want 1", got)
+	}
+}
+
+// TestExporterMetrics_ForCluster verifies each cluster's collections are
+// recorded under its own cluster label rather than overwriting each other.
+func TestExporterMetrics_ForCluster(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	m := NewExporterMetrics(prometheus.NewRegistry(), true)
+
+	for cluster, nodeCount := range map[string]int{"prod": 2, "staging": 1} {
+		var nodes []*corev1.Node
+		for i := range nodeCount {
+			nodes = append(nodes, makeNode(fmt.Sprintf("node-%d", i), "4", "8Gi"))
+		}
+		collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{}, logger,
+			[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil, WithExporterMetrics(m.ForCluster(cluster)))
+		collectMetrics(collector)
+	}
+
+	for cluster, want := range map[string]float64{"prod": 2, "staging": 1} {
+		if got := testutil.ToFloat64(m.nodesProcessed.WithLabelValues(cluster)); got != want {
+			t.Errorf("nodes_processed{cluster=%q} = %v, want %v", cluster, got, want)
+		}
+	}
+	if got := testutil.CollectAndCount(m.collectDuration); got != 2 {
+		t.Errorf("collect_duration_seconds series = %d, want one per cluster", got)
+	}
+}
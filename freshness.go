@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// InformerFreshness tracks when an informer last received data from the API
+// server. Unlike HasSynced, which never reverts, it lets a stuck watch be
+// detected: a healthy informer receives watch events and periodic resyncs.
+// It implements cache.ResourceEventHandler.
+type InformerFreshness struct {
+	lastEvent   atomic.Int64 // unix nanoseconds; 0 = never
+	lastResync  atomic.Int64 // unix nanoseconds; 0 = never
+	watchStarts atomic.Int64
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (f *InformerFreshness) OnAdd(interface{}, bool) {
+	f.lastEvent.Store(time.Now().UnixNano())
+}
+
+// OnUpdate implements cache.ResourceEventHandler. An update whose object
+// ResourceVersion is unchanged is a resync replayed from the local cache, not
+// a watch event.
+func (f *InformerFreshness) OnUpdate(oldObj, newObj interface{}) {
+	now := time.Now().UnixNano()
+	if isResync(oldObj, newObj) {
+		f.lastResync.Store(now)
+		return
+	}
+	f.lastEvent.Store(now)
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (f *InformerFreshness) OnDelete(interface{}) {
+	f.lastEvent.Store(time.Now().UnixNano())
+}
+
+// LastEvent returns when the last watch event was received (zero if never).
+func (f *InformerFreshness) LastEvent() time.Time {
+	return unixNanoTime(f.lastEvent.Load())
+}
+
+// LastResync returns when the last resync was observed (zero if never).
+func (f *InformerFreshness) LastResync() time.Time {
+	return unixNanoTime(f.lastResync.Load())
+}
+
+// LastActivity returns the most recent of the last event and last resync.
+func (f *InformerFreshness) LastActivity() time.Time {
+	event, resync := f.LastEvent(), f.LastResync()
+	if resync.After(event) {
+		return resync
+	}
+	return event
+}
+
+// WatchReconnects returns how many times the watch was re-established after
+// the first one.
+func (f *InformerFreshness) WatchReconnects() int64 {
+	if n := f.watchStarts.Load(); n > 1 {
+		return n - 1
+	}
+	return 0
+}
+
+func isResync(oldObj, newObj interface{}) bool {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return false
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return false
+	}
+	return oldMeta.GetResourceVersion() != "" && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion()
+}
+
+func unixNanoTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// watchCountingTransport counts watch requests per resource so that watch
+// reconnects can be reported. Reflectors re-establish watches silently, so the
+// transport is the only place every (re)connect is visible.
+type watchCountingTransport struct {
+	next     http.RoundTripper
+	counters map[string]*InformerFreshness // keyed by resource, e.g. "pods"
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *watchCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("watch") == "true" || req.URL.Query().Get("watch") == "1" {
+		resource := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		if f, ok := t.counters[resource]; ok {
+			f.watchStarts.Add(1)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// unixSeconds returns t as fractional Unix seconds, or 0 for the zero time.
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
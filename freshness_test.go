@@ -0,0 +1,171 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podWithResourceVersion(rv string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default", ResourceVersion: rv}}
+}
+
+// TestInformerFreshness_Events verifies watch events and resyncs are told
+// apart by ResourceVersion.
+func TestInformerFreshness_Events(t *testing.T) {
+	f := &InformerFreshness{}
+	if !f.LastEvent().IsZero() || !f.LastResync().IsZero() || !f.LastActivity().IsZero() {
+		t.Fatal("new InformerFreshness should report zero times")
+	}
+
+	f.OnAdd(podWithResourceVersion("1"), true)
+	if f.LastEvent().IsZero() {
+		t.Error("OnAdd should record an event")
+	}
+
+	// Same ResourceVersion: a resync from the local cache.
+	f.OnUpdate(podWithResourceVersion("1"), podWithResourceVersion("1"))
+	if f.LastResync().IsZero() {
+		t.Error("OnUpdate with unchanged ResourceVersion should record a resync")
+	}
+
+	before := f.LastEvent()
+	f.lastEvent.Store(before.Add(-time.Minute).UnixNano())
+	f.OnUpdate(podWithResourceVersion("1"), podWithResourceVersion("2"))
+	if !f.LastEvent().After(before.Add(-time.Minute)) {
+		t.Error("OnUpdate with changed ResourceVersion should record an event")
+	}
+
+	f.lastEvent.Store(0)
+	f.OnDelete(podWithResourceVersion("2"))
+	if f.LastEvent().IsZero() {
+		t.Error("OnDelete should record an event")
+	}
+}
+
+// TestIsResync tests resync detection edge cases.
+func TestIsResync(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new interface{}
+		want     bool
+	}{
+		{name: "unchanged", old: podWithResourceVersion("5"), new: podWithResourceVersion("5"), want: true},
+		{name: "changed", old: podWithResourceVersion("5"), new: podWithResourceVersion("6"), want: false},
+		{name: "empty resource version", old: podWithResourceVersion(""), new: podWithResourceVersion(""), want: false},
+		{name: "not an object", old: "a", new: "a", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isResync(tt.old, tt.new); got != tt.want {
+				t.Errorf("isResync() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSyncInfo_CacheAge verifies the cache age follows the least recently
+// active informer and never predates the initial sync.
+func TestSyncInfo_CacheAge(t *testing.T) {
+	now := time.Now()
+	syncInfo := &SyncInfo{LastSyncTime: now.Add(-time.Hour)}
+
+	if got := syncInfo.CacheAge(now); got != time.Hour {
+		t.Errorf("CacheAge() without freshness = %v, want 1h", got)
+	}
+
+	nodes, pods := &InformerFreshness{}, &InformerFreshness{}
+	syncInfo.NodeFreshness, syncInfo.PodFreshness = nodes, pods
+	nodes.lastResync.Store(now.Add(-5 * time.Minute).UnixNano())
+	pods.lastEvent.Store(now.Add(-time.Second).UnixNano())
+	if got := syncInfo.CacheAge(now); got != 5*time.Minute {
+		t.Errorf("CacheAge() = %v, want 5m (stalest informer)", got)
+	}
+
+	// An informer with no activity since the initial sync is as old as the sync.
+	nodes.lastResync.Store(0)
+	if got := syncInfo.CacheAge(now); got != time.Hour {
+		t.Errorf("CacheAge() with idle informer = %v, want 1h", got)
+	}
+}
+
+// TestWatchCountingTransport verifies that only watch requests are counted,
+// per resource, and that the first watch is not a reconnect.
+func TestWatchCountingTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	nodes, pods := &InformerFreshness{}, &InformerFreshness{}
+	client := &http.Client{Transport: &watchCountingTransport{
+		next:     http.DefaultTransport,
+		counters: map[string]*InformerFreshness{"nodes": nodes, "pods": pods},
+	}}
+
+	for _, path := range []string{
+		"/api/v1/pods?limit=500",                   // list
+		"/api/v1/pods?watch=true",                  // first watch
+		"/api/v1/pods?watch=true&timeoutSeconds=1", // reconnect
+		"/api/v1/pods?watch=1",                     // reconnect
+		"/api/v1/nodes?watch=true",                 // first watch
+		"/api/v1/services?watch=true",              // untracked
+	} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if got := pods.WatchReconnects(); got != 2 {
+		t.Errorf("pods WatchReconnects() = %d, want 2", got)
+	}
+	if got := nodes.WatchReconnects(); got != 0 {
+		t.Errorf("nodes WatchReconnects() = %d, want 0", got)
+	}
+}
+
+// TestBinpackingCollector_StaleCache verifies the cache_stale metric and that
+// binpacking metrics are only dropped while stale when configured to.
+func TestBinpackingCollector_StaleCache(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	nodes := []*corev1.Node{makeNode("node-1", "4", "8Gi")}
+
+	tests := []struct {
+		name          string
+		lastSync      time.Duration
+		drop          bool
+		wantStale     float64
+		wantBinpacked bool
+	}{
+		{name: "fresh", lastSync: time.Minute, drop: true, wantStale: 0, wantBinpacked: true},
+		{name: "stale keep", lastSync: 10 * time.Minute, drop: false, wantStale: 1, wantBinpacked: true},
+		{name: "stale drop", lastSync: 10 * time.Minute, drop: true, wantStale: 1, wantBinpacked: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syncInfo := &SyncInfo{LastSyncTime: time.Now().Add(-tt.lastSync)}
+			collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{}, logger,
+				[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, syncInfo, nil,
+				WithStaleThreshold(5*time.Minute, tt.drop))
+			metrics := collectMetrics(collector)
+
+			if got, ok := findMetricValue(t, metrics, "kube_binpacking_cache_stale", nil); !ok || got != tt.wantStale {
+				t.Errorf("cache_stale = %v (emitted=%v), want %v", got, ok, tt.wantStale)
+			}
+			if _, ok := findMetricValue(t, metrics, "kube_binpacking_cluster_node_count", nil); ok != tt.wantBinpacked {
+				t.Errorf("binpacking metrics emitted = %v, want %v", ok, tt.wantBinpacked)
+			}
+			if _, ok := findMetricValue(t, metrics, "kube_binpacking_cache_age_seconds", nil); !ok {
+				t.Error("cache_age_seconds should always be emitted")
+			}
+		})
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	listerscorev1 "k8s.io/client-go/listers/core/v1"
@@ -21,123 +25,551 @@ import (
 // ReadyChecker returns true if the system is ready to serve traffic.
 type ReadyChecker func() bool
 
+// readinessCheck combines the conditions /readyz requires beyond the initial
+// cache sync: a fresh cache and, optionally, held leadership.
+type readinessCheck struct {
+	synced         ReadyChecker
+	syncInfo       *SyncInfo
+	staleThreshold time.Duration // 0 = staleness not checked
+	isLeader       *atomic.Bool  // nil = leadership not required
+}
+
+// notReadyReason returns why the exporter is not ready, or "" if it is.
+func (r readinessCheck) notReadyReason(now time.Time) string {
+	if !r.synced() {
+		return "informer cache not synced"
+	}
+	if r.syncInfo.IsStale(r.staleThreshold, now) {
+		return fmt.Sprintf("informer cache stale (no events or resync for %s, threshold %s)",
+			r.syncInfo.CacheAge(now).Truncate(time.Second), r.staleThreshold)
+	}
+	if r.isLeader != nil && !r.isLeader.Load() {
+		return "not the leader"
+	}
+	return ""
+}
+
 // SyncInfo tracks informer synchronization state.
 type SyncInfo struct {
-	LastSyncTime time.Time
+	LastSyncTime time.Time // initial cache sync
 	ResyncPeriod time.Duration
 	NodeSynced   func() bool
 	PodSynced    func() bool
-}
 
-func setupKubernetes(ctx context.Context, logger *slog.Logger, kubeconfigPath string, resyncPeriod time.Duration, listPageSize int64, nodeSelector string) (listerscorev1.NodeLister, listerscorev1.PodLister, ReadyChecker, *SyncInfo, kubernetes.Interface, error) {
-	config, configSource, err := buildConfig(kubeconfigPath)
-	if err != nil {
-		return nil, nil, nil, nil, nil, fmt.Errorf("building kubeconfig: %w", err)
-	}
+	// NodeFreshness and PodFreshness track ongoing informer activity after
+	// the initial sync. Nil when not tracked.
+	NodeFreshness *InformerFreshness
+	PodFreshness  *InformerFreshness
+}
 
-	logger.Info("kubernetes client config",
-		"source", configSource,
-		"host", config.Host,
-		"qps", config.QPS,
-		"burst", config.Burst)
+// IsStale reports whether the cache age exceeds threshold. A zero threshold
+// disables the check.
+func (s *SyncInfo) IsStale(threshold time.Duration, now time.Time) bool {
+	return s != nil && threshold > 0 && s.CacheAge(now) > threshold
+}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, nil, nil, nil, nil, fmt.Errorf("creating kubernetes client: %w", err)
+// Informers returns the tracked informers' freshness keyed by kind.
+func (s *SyncInfo) Informers() map[string]*InformerFreshness {
+	informers := make(map[string]*InformerFreshness, 2)
+	if s.NodeFreshness != nil {
+		informers["node"] = s.NodeFreshness
+	}
+	if s.PodFreshness != nil {
+		informers["pod"] = s.PodFreshness
 	}
+	return informers
+}
 
-	// Test connectivity before setting up informers
-	serverVersion, err := clientset.Discovery().ServerVersion()
-	if err != nil {
-		return nil, nil, nil, nil, nil, fmt.Errorf("failed to connect to kubernetes API: %w", err)
+// CacheAge returns how stale the cache may be: the time since the least
+// recently active informer last received an event or resync. Activity before
+// the initial sync is not considered, so a freshly synced cache has age ~0.
+// Without freshness tracking it is the time since the initial sync.
+func (s *SyncInfo) CacheAge(now time.Time) time.Duration {
+	age := now.Sub(s.LastSyncTime)
+	informers := s.Informers()
+	if len(informers) == 0 {
+		return age
 	}
-	logger.Info("connected to kubernetes API",
-		"version", serverVersion.String(),
-		"platform", serverVersion.Platform)
+	age = 0
+	for _, f := range informers {
+		last := f.LastActivity()
+		if last.Before(s.LastSyncTime) {
+			last = s.LastSyncTime
+		}
+		if a := now.Sub(last); a > age {
+			age = a
+		}
+	}
+	return age
+}
+
+// NodeSource serves nodes from an informer whose label selector and kept
+// node fields can be changed at runtime. Restart builds and syncs an informer
+// for the new selector before swapping it in, so scrapes keep reading the old
+// cache until the new one is complete. It implements listerscorev1.NodeLister.
+type NodeSource struct {
+	clientset       kubernetes.Interface
+	resyncPeriod    time.Duration
+	listPageSize    int64
+	freshness       *InformerFreshness
+	exporterMetrics *ExporterMetrics
+	logger          *slog.Logger
+
+	mu      sync.Mutex // serializes Restart
+	current atomic.Pointer[nodeInformer]
+}
+
+// nodeInformer is one node informer and the means to stop it.
+type nodeInformer struct {
+	selector string
+	fields   NodeFields
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	lister   listerscorev1.NodeLister
+	stop     context.CancelFunc
+}
+
+// List implements listerscorev1.NodeLister.
+func (s *NodeSource) List(selector labels.Selector) ([]*corev1.Node, error) {
+	return s.current.Load().lister.List(selector)
+}
+
+// Get implements listerscorev1.NodeLister.
+func (s *NodeSource) Get(name string) (*corev1.Node, error) {
+	return s.current.Load().lister.Get(name)
+}
+
+// HasSynced reports whether the current node informer has synced.
+func (s *NodeSource) HasSynced() bool {
+	return s.current.Load().informer.HasSynced()
+}
+
+// Selector returns the label selector of the current node informer.
+func (s *NodeSource) Selector() string {
+	return s.current.Load().selector
+}
+
+// Fields returns the node fields kept by the current node informer.
+func (s *NodeSource) Fields() NodeFields {
+	return s.current.Load().fields
+}
 
-	// Create separate informer factories for nodes and pods.
-	// Pods use a server-side field selector to exclude terminated (Succeeded/Failed)
-	// pods, avoiding unnecessary cache memory for pods that don't contribute to
-	// allocation calculations. This requires a separate factory because
-	// WithTweakListOptions applies to all informers in a factory.
-	nodeOpts := []informers.SharedInformerOption{
-		informers.WithTransform(stripUnusedFields),
+// newNodeSource creates a NodeSource and starts its informer for selector,
+// keeping fields. It does not wait for the informer to sync; use HasSynced.
+func newNodeSource(ctx context.Context, clientset kubernetes.Interface, resyncPeriod time.Duration, listPageSize int64, selector string, fields NodeFields, freshness *InformerFreshness, exporterMetrics *ExporterMetrics, logger *slog.Logger) (*NodeSource, error) {
+	s := &NodeSource{
+		clientset:       clientset,
+		resyncPeriod:    resyncPeriod,
+		listPageSize:    listPageSize,
+		freshness:       freshness,
+		exporterMetrics: exporterMetrics,
+		logger:          logger,
 	}
-	podOpts := []informers.SharedInformerOption{
-		informers.WithTransform(stripUnusedFields),
-		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
-			opts.FieldSelector = "status.phase!=Succeeded,status.phase!=Failed"
-			if listPageSize > 0 {
-				opts.Limit = listPageSize
-			}
-		}),
+	initial, err := s.start(ctx, selector, fields)
+	if err != nil {
+		return nil, err
 	}
+	s.current.Store(initial)
+	return s, nil
+}
 
-	if listPageSize > 0 || nodeSelector != "" {
-		nodeOpts = append(nodeOpts, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
-			if listPageSize > 0 {
-				opts.Limit = listPageSize
+// start creates and starts a node informer for selector, keeping fields,
+// without waiting for it to sync.
+func (s *NodeSource) start(ctx context.Context, selector string, fields NodeFields) (*nodeInformer, error) {
+	opts := []informers.SharedInformerOption{
+		informers.WithTransform(fields.transform),
+	}
+	if s.listPageSize > 0 || selector != "" {
+		opts = append(opts, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			if s.listPageSize > 0 {
+				opts.Limit = s.listPageSize
 			}
-			if nodeSelector != "" {
-				opts.LabelSelector = nodeSelector
+			if selector != "" {
+				opts.LabelSelector = selector
 			}
 		}))
 	}
-
-	nodeFactory := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, nodeOpts...)
-	podFactory := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, podOpts...)
-	logger.Info("informer factories configured",
-		"pod_field_selector", "status.phase!=Succeeded,status.phase!=Failed",
-		"node_label_selector", nodeSelector,
-		"pagination", listPageSize > 0)
-
-	nodeInformer := nodeFactory.Core().V1().Nodes()
-	podInformer := podFactory.Core().V1().Pods()
+	factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, s.resyncPeriod, opts...)
+	informer := factory.Core().V1().Nodes()
 
 	// Add event handlers for debug logging.
-	if logger.Enabled(ctx, slog.LevelDebug) {
-		_, err = nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+	if s.logger.Enabled(ctx, slog.LevelDebug) {
+		_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
 				node := obj.(*corev1.Node)
-				logger.Debug("node added", "node", node.Name)
+				s.logger.Debug("node added", "node", node.Name)
 			},
 			UpdateFunc: func(oldObj, newObj interface{}) {
 				node := newObj.(*corev1.Node)
-				logger.Debug("node updated", "node", node.Name)
+				s.logger.Debug("node updated", "node", node.Name)
 			},
 			DeleteFunc: func(obj interface{}) {
 				node := obj.(*corev1.Node)
-				logger.Debug("node deleted", "node", node.Name)
+				s.logger.Debug("node deleted", "node", node.Name)
 			},
 		})
 		if err != nil {
-			return nil, nil, nil, nil, nil, fmt.Errorf("adding node event handler: %w", err)
+			return nil, fmt.Errorf("adding node event handler: %w", err)
+		}
+	}
+	if _, err := informer.Informer().AddEventHandler(s.freshness); err != nil {
+		return nil, fmt.Errorf("adding node freshness event handler: %w", err)
+	}
+	if err := s.exporterMetrics.instrumentInformer(informer.Informer(), "node"); err != nil {
+		return nil, fmt.Errorf("instrumenting node informer: %w", err)
+	}
+
+	informerCtx, stop := context.WithCancel(ctx)
+	factory.Start(informerCtx.Done())
+	return &nodeInformer{
+		selector: selector,
+		fields:   fields,
+		factory:  factory,
+		informer: informer.Informer(),
+		lister:   informer.Lister(),
+		stop:     stop,
+	}, nil
+}
+
+// Restart replaces the node informer with one using selector and keeping
+// fields. It returns an error, keeping the current informer, if the new one
+// does not sync within two minutes.
+func (s *NodeSource) Restart(ctx context.Context, selector string, fields NodeFields) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger.Info("restarting node informer", "old_selector", s.Selector(), "new_selector", selector, "fields", fields)
+	next, err := s.start(ctx, selector, fields)
+	if err != nil {
+		return err
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), next.informer.HasSynced) {
+		next.stop()
+		return fmt.Errorf("node informer for selector %q did not sync within timeout", selector)
+	}
+
+	prev := s.current.Swap(next)
+	prev.stop()
+	go prev.factory.Shutdown()
+	s.logger.Info("node informer restarted", "selector", selector)
+	return nil
+}
+
+// podFieldSelector excludes terminated (Succeeded/Failed) pods server-side,
+// avoiding cache memory for pods that don't contribute to allocation.
+const podFieldSelector = "status.phase!=Succeeded,status.phase!=Failed"
+
+// podRestartRetryInterval is how long to wait before retrying a failed pod
+// informer restart.
+const podRestartRetryInterval = 30 * time.Second
+
+// PodSource serves pods from an informer and, when indexed, the allocation
+// index fed by it. With sharding only pods on nodes assigned to this replica
+// are kept in full and indexed; an informer cannot drop objects, so the
+// others are cached as stubs without containers. Restart rebuilds the
+// informer and index for a new assignment, serving the old ones until the
+// new ones have synced; ShardMembers reports the member list of the informer
+// being served. It implements listerscorev1.PodLister.
+type PodSource struct {
+	clientset       kubernetes.Interface
+	resyncPeriod    time.Duration
+	listPageSize    int64
+	indexed         bool
+	assignment      func() shardAssignment // nil = every node
+	freshness       *InformerFreshness
+	exporterMetrics *ExporterMetrics
+	logger          *slog.Logger
+
+	mu      sync.Mutex // serializes Restart
+	current atomic.Pointer[podInformer]
+}
+
+// podInformer is one pod informer, its allocation index and the means to
+// stop them.
+type podInformer struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	lister   listerscorev1.PodLister
+	index    *AllocationIndex // nil unless indexed
+	synced   []cache.InformerSynced
+	stop     context.CancelFunc
+	// assignment is the shard assignment pods were cached by.
+	assignment shardAssignment
+}
+
+// List implements listerscorev1.PodLister.
+func (s *PodSource) List(selector labels.Selector) ([]*corev1.Pod, error) {
+	return s.current.Load().lister.List(selector)
+}
+
+// Pods implements listerscorev1.PodLister.
+func (s *PodSource) Pods(namespace string) listerscorev1.PodNamespaceLister {
+	return s.current.Load().lister.Pods(namespace)
+}
+
+// HasSynced reports whether the current pod informer, and its allocation
+// index if indexed, have synced.
+func (s *PodSource) HasSynced() bool {
+	for _, synced := range s.current.Load().synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// ShardMembers returns the member list the current pod informer caches pods
+// by. Nodes newly assigned by a later membership are only collected once the
+// informer for it has synced, since their pods are cached as stubs until then.
+func (s *PodSource) ShardMembers() []string {
+	return s.current.Load().assignment.members
+}
+
+// Allocations returns the per-node totals of the current allocation index.
+// It must only be used when the source is indexed.
+func (s *PodSource) Allocations() (map[string]*nodeAllocation, podFilterStats) {
+	return s.current.Load().index.Allocations()
+}
+
+// newPodSource creates a PodSource and starts its informer. It does not wait
+// for the informer to sync; use HasSynced.
+func newPodSource(ctx context.Context, clientset kubernetes.Interface, resyncPeriod time.Duration, listPageSize int64, indexed bool, assignment func() shardAssignment, freshness *InformerFreshness, exporterMetrics *ExporterMetrics, logger *slog.Logger) (*PodSource, error) {
+	s := &PodSource{
+		clientset:       clientset,
+		resyncPeriod:    resyncPeriod,
+		listPageSize:    listPageSize,
+		indexed:         indexed,
+		assignment:      assignment,
+		freshness:       freshness,
+		exporterMetrics: exporterMetrics,
+		logger:          logger,
+	}
+	initial, err := s.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(initial)
+	return s, nil
+}
+
+// shardTransform returns a transform that strips pods as stripUnusedFields
+// does and reduces pods on nodes owns rejects to a stub.
+func shardTransform(owns func(nodeName string) bool) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		obj, err := stripUnusedFields(obj)
+		if err != nil {
+			return nil, err
+		}
+		if pod, ok := obj.(*corev1.Pod); ok && owns != nil && pod.Spec.NodeName != "" && !owns(pod.Spec.NodeName) {
+			pod.Spec = corev1.PodSpec{NodeName: pod.Spec.NodeName}
+			pod.OwnerReferences = nil
 		}
+		return obj, nil
+	}
+}
+
+// start creates and starts a pod informer, and its allocation index if
+// indexed, without waiting for them to sync. With sharding, it caches pods by
+// the assignment at the time it is called.
+func (s *PodSource) start(ctx context.Context) (*podInformer, error) {
+	p := &podInformer{}
+	var owns func(nodeName string) bool
+	if s.assignment != nil {
+		p.assignment = s.assignment()
+		owns = p.assignment.owns
+	}
 
-		_, err = podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+	// Pods need their own factory because WithTweakListOptions applies to
+	// all informers in a factory.
+	factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, s.resyncPeriod,
+		informers.WithTransform(shardTransform(owns)),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = podFieldSelector
+			if s.listPageSize > 0 {
+				opts.Limit = s.listPageSize
+			}
+		}))
+	informer := factory.Core().V1().Pods()
+
+	// Add event handlers for debug logging.
+	if s.logger.Enabled(ctx, slog.LevelDebug) {
+		_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
 				pod := obj.(*corev1.Pod)
-				logger.Debug("pod added", "pod", pod.Namespace+"/"+pod.Name, "node", pod.Spec.NodeName)
+				s.logger.Debug("pod added", "pod", pod.Namespace+"/"+pod.Name, "node", pod.Spec.NodeName)
 			},
 			UpdateFunc: func(oldObj, newObj interface{}) {
 				pod := newObj.(*corev1.Pod)
-				logger.Debug("pod updated", "pod", pod.Namespace+"/"+pod.Name, "node", pod.Spec.NodeName, "phase", pod.Status.Phase)
+				s.logger.Debug("pod updated", "pod", pod.Namespace+"/"+pod.Name, "node", pod.Spec.NodeName, "phase", pod.Status.Phase)
 			},
 			DeleteFunc: func(obj interface{}) {
 				pod := obj.(*corev1.Pod)
-				logger.Debug("pod deleted", "pod", pod.Namespace+"/"+pod.Name)
+				s.logger.Debug("pod deleted", "pod", pod.Namespace+"/"+pod.Name)
 			},
 		})
 		if err != nil {
-			return nil, nil, nil, nil, nil, fmt.Errorf("adding pod event handler: %w", err)
+			return nil, fmt.Errorf("adding pod event handler: %w", err)
+		}
+	}
+	if _, err := informer.Informer().AddEventHandler(s.freshness); err != nil {
+		return nil, fmt.Errorf("adding pod freshness event handler: %w", err)
+	}
+	if err := s.exporterMetrics.instrumentInformer(informer.Informer(), "pod"); err != nil {
+		return nil, fmt.Errorf("instrumenting pod informer: %w", err)
+	}
+
+	p.factory = factory
+	p.informer = informer.Informer()
+	p.lister = informer.Lister()
+	p.synced = []cache.InformerSynced{informer.Informer().HasSynced}
+
+	// Feed the allocation index from pod events so scrapes read precomputed
+	// per-node totals. Its registration must sync before the index is complete.
+	if s.indexed {
+		p.index = NewAllocationIndex(s.logger)
+		p.index.owns = owns
+		registration, err := informer.Informer().AddEventHandler(p.index)
+		if err != nil {
+			return nil, fmt.Errorf("adding allocation index event handler: %w", err)
+		}
+		p.synced = append(p.synced, registration.HasSynced)
+	}
+
+	informerCtx, stop := context.WithCancel(ctx)
+	p.stop = stop
+	factory.Start(informerCtx.Done())
+	return p, nil
+}
+
+// Restart replaces the pod informer and allocation index with new ones,
+// which cache and index pods by the current node assignment. It returns an
+// error, keeping the current informer, if the new one does not sync within
+// two minutes.
+func (s *PodSource) Restart(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger.Info("restarting pod informer")
+	next, err := s.start(ctx)
+	if err != nil {
+		return err
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), next.synced...) {
+		next.stop()
+		return fmt.Errorf("pod informer did not sync within timeout")
+	}
+
+	prev := s.current.Swap(next)
+	prev.stop()
+	go prev.factory.Shutdown()
+	s.logger.Info("pod informer restarted")
+	return nil
+}
+
+// RestartOn restarts the pod informer whenever changes is signalled, such as
+// when the shard assignment changes, until ctx is cancelled. A failed
+// restart is retried after podRestartRetryInterval.
+func (s *PodSource) RestartOn(ctx context.Context, changes <-chan struct{}) {
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+		case <-retry:
+		}
+		retry = nil
+		if err := s.Restart(ctx); err != nil {
+			s.logger.Error("pod informer restart failed, retrying", "error", err, "retry_in", podRestartRetryInterval)
+			retry = time.After(podRestartRetryInterval)
 		}
 	}
+}
+
+// kubeClient is a clientset connected to a cluster, with watch (re)connects
+// counted per resource at the transport level.
+type kubeClient struct {
+	clientset     kubernetes.Interface
+	nodeFreshness *InformerFreshness
+	podFreshness  *InformerFreshness
+}
 
-	nodeLister := nodeInformer.Lister()
-	podLister := podInformer.Lister()
+// connectKubernetes creates a client and checks the API server is reachable.
+func connectKubernetes(logger *slog.Logger, kubeconfigPath, kubeContext string) (*kubeClient, error) {
+	config, configSource, err := buildConfig(kubeconfigPath, kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("building kubeconfig: %w", err)
+	}
 
-	nodeFactory.Start(ctx.Done())
-	podFactory.Start(ctx.Done())
+	logger.Info("kubernetes client config",
+		"source", configSource,
+		"host", config.Host,
+		"qps", config.QPS,
+		"burst", config.Burst)
+
+	// Count watch (re)connects per resource at the transport level.
+	client := &kubeClient{nodeFreshness: &InformerFreshness{}, podFreshness: &InformerFreshness{}}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &watchCountingTransport{
+			next:     rt,
+			counters: map[string]*InformerFreshness{"nodes": client.nodeFreshness, "pods": client.podFreshness},
+		}
+	})
+
+	client.clientset, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating kubernetes client: %w", err)
+	}
+
+	// Test connectivity before setting up informers
+	serverVersion, err := client.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kubernetes API: %w", err)
+	}
+	logger.Info("connected to kubernetes API",
+		"version", serverVersion.String(),
+		"platform", serverVersion.Platform)
+	return client, nil
+}
+
+// setupKubernetes connects to a cluster and starts its informers.
+func setupKubernetes(ctx context.Context, logger *slog.Logger, kubeconfigPath, kubeContext string, resyncPeriod time.Duration, listPageSize int64, nodeSelector string, nodeFields NodeFields, indexed bool, exporterMetrics *ExporterMetrics) (*NodeSource, *PodSource, ReadyChecker, *SyncInfo, kubernetes.Interface, error) {
+	client, err := connectKubernetes(logger, kubeconfigPath, kubeContext)
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+	nodes, pods, readyChecker, syncInfo, err := startInformers(ctx, logger, client, resyncPeriod, listPageSize, nodeSelector, nodeFields, indexed, nil, exporterMetrics)
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+	return nodes, pods, readyChecker, syncInfo, client.clientset, nil
+}
+
+// startInformers starts the node and pod informers and waits up to two
+// minutes for them to sync. Nodes are served by a NodeSource so the node
+// selector can change at runtime. With assignment set, only pods on the nodes
+// assigned to this replica are cached in full and indexed.
+func startInformers(ctx context.Context, logger *slog.Logger, client *kubeClient, resyncPeriod time.Duration, listPageSize int64, nodeSelector string, nodeFields NodeFields, indexed bool, assignment func() shardAssignment, exporterMetrics *ExporterMetrics) (*NodeSource, *PodSource, ReadyChecker, *SyncInfo, error) {
+	logger.Info("informers configured",
+		"pod_field_selector", podFieldSelector,
+		"node_label_selector", nodeSelector,
+		"pagination", listPageSize > 0,
+		"sharded_pod_cache", assignment != nil)
+
+	pods, err := newPodSource(ctx, client.clientset, resyncPeriod, listPageSize, indexed, assignment, client.podFreshness, exporterMetrics, logger)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	nodes, err := newNodeSource(ctx, client.clientset, resyncPeriod, listPageSize, nodeSelector, nodeFields, client.nodeFreshness, exporterMetrics, logger)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 	logger.Info("starting informers and waiting for cache sync (this may take 10-30 seconds)")
 
 	// Wait with timeout and periodic progress updates
@@ -153,8 +585,8 @@ func setupKubernetes(ctx context.Context, logger *slog.Logger, kubeconfigPath st
 			case <-ticker.C:
 				elapsed := time.Since(startTime)
 				logger.Info("still waiting for cache sync...",
-					"node_synced", nodeInformer.Informer().HasSynced(),
-					"pod_synced", podInformer.Informer().HasSynced(),
+					"node_synced", nodes.HasSynced(),
+					"pod_synced", pods.HasSynced(),
 					"elapsed_seconds", int(elapsed.Seconds()))
 			case <-syncCtx.Done():
 				return
@@ -162,29 +594,46 @@ func setupKubernetes(ctx context.Context, logger *slog.Logger, kubeconfigPath st
 		}
 	}()
 
-	if !cache.WaitForCacheSync(syncCtx.Done(), nodeInformer.Informer().HasSynced, podInformer.Informer().HasSynced) {
-		return nil, nil, nil, nil, nil, fmt.Errorf("failed to sync informer caches within timeout")
+	if !cache.WaitForCacheSync(syncCtx.Done(), nodes.HasSynced, pods.HasSynced) {
+		return nil, nil, nil, nil, fmt.Errorf("failed to sync informer caches within timeout")
 	}
 
 	logger.Info("informer cache synced successfully")
 
 	// ReadyChecker returns true if both informers have synced.
 	readyChecker := func() bool {
-		return nodeInformer.Informer().HasSynced() && podInformer.Informer().HasSynced()
+		return nodes.HasSynced() && pods.HasSynced()
 	}
 
 	// Track sync information
 	syncInfo := &SyncInfo{
 		LastSyncTime: time.Now(),
 		ResyncPeriod: resyncPeriod,
-		NodeSynced:   nodeInformer.Informer().HasSynced,
-		PodSynced:    podInformer.Informer().HasSynced,
+		NodeSynced:   nodes.HasSynced,
+		PodSynced:    pods.HasSynced,
+
+		NodeFreshness: client.nodeFreshness,
+		PodFreshness:  client.podFreshness,
 	}
 
-	return nodeLister, podLister, readyChecker, syncInfo, clientset, nil
+	return nodes, pods, readyChecker, syncInfo, nil
 }
 
-func buildConfig(kubeconfigPath string) (*rest.Config, string, error) {
+// buildConfig returns the client config and a description of where it came
+// from. A non-empty kubeContext selects that context from kubeconfigPath, or
+// from the default kubeconfig loading rules (KUBECONFIG, ~/.kube/config).
+func buildConfig(kubeconfigPath, kubeContext string) (*rest.Config, string, error) {
+	if kubeContext != "" {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		source := "default kubeconfig"
+		if kubeconfigPath != "" {
+			rules.ExplicitPath = kubeconfigPath
+			source = kubeconfigPath
+		}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+		cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+		return cfg, fmt.Sprintf("context %s in %s", kubeContext, source), err
+	}
 	if kubeconfigPath != "" {
 		cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 		return cfg, fmt.Sprintf("explicit flag: %s", kubeconfigPath), err
@@ -210,7 +659,7 @@ func buildConfig(kubeconfigPath string) (*rest.Config, string, error) {
 func stripUnusedFields(obj interface{}) (interface{}, error) {
 	switch v := obj.(type) {
 	case *corev1.Pod:
-		// Keep only: Name, Namespace, NodeName, Phase, container resource requests
+		// Keep only: Name, Namespace, ResourceVersion (resync detection), NodeName, Phase, container resource requests
 		containers := make([]corev1.Container, len(v.Spec.Containers))
 		for i, c := range v.Spec.Containers {
 			containers[i] = corev1.Container{
@@ -234,15 +683,17 @@ func stripUnusedFields(obj interface{}) (interface{}, error) {
 		v.ObjectMeta = metav1.ObjectMeta{
 			Name:            v.Name,
 			Namespace:       v.Namespace,
+			ResourceVersion: v.ResourceVersion,
 			OwnerReferences: v.OwnerReferences,
 		}
 		return v, nil
 
 	case *corev1.Node:
-		// Keep only: Name, Labels, Allocatable
+		// Keep only: Name, ResourceVersion (resync detection), Labels, Allocatable
 		v.ObjectMeta = metav1.ObjectMeta{
-			Name:   v.Name,
-			Labels: v.Labels,
+			Name:            v.Name,
+			ResourceVersion: v.ResourceVersion,
+			Labels:          v.Labels,
 		}
 		v.Status = corev1.NodeStatus{Allocatable: v.Status.Allocatable}
 		v.Spec = corev1.NodeSpec{}
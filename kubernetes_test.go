@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 )
 
 // TestSyncInfo tests the SyncInfo struct fields and usage.
@@ -96,14 +105,15 @@ func TestReadinessCheck(t *testing.T) {
 }
 
 // TestStripUnusedFields_Pod verifies that a full Pod is stripped to only the
-// fields used by the collector: Name, Namespace, NodeName, Phase, and
-// container resource requests. Everything else should be zeroed.
+// fields used by the collector: Name, Namespace, ResourceVersion, NodeName,
+// Phase, and container resource requests. Everything else should be zeroed.
 func TestStripUnusedFields_Pod(t *testing.T) {
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "my-pod",
-			Namespace: "default",
-			UID:       "abc-123",
+			Name:            "my-pod",
+			Namespace:       "default",
+			UID:             "abc-123",
+			ResourceVersion: "42",
 			Labels:    map[string]string{"app": "web"},
 			Annotations: map[string]string{
 				"kubectl.kubernetes.io/last-applied-configuration": `{"big":"json"}`,
@@ -182,6 +192,9 @@ func TestStripUnusedFields_Pod(t *testing.T) {
 	if stripped.Namespace != "default" {
 		t.Errorf("Namespace = %q, want %q", stripped.Namespace, "default")
 	}
+	if stripped.ResourceVersion != "42" {
+		t.Errorf("ResourceVersion = %q, want %q", stripped.ResourceVersion, "42")
+	}
 	if stripped.Spec.NodeName != "node-1" {
 		t.Errorf("NodeName = %q, want %q", stripped.Spec.NodeName, "node-1")
 	}
@@ -267,11 +280,12 @@ func TestStripUnusedFields_Pod(t *testing.T) {
 }
 
 // TestStripUnusedFields_Node verifies that a full Node is stripped to only
-// Name, Labels, and Allocatable. Everything else should be zeroed.
+// Name, ResourceVersion, Labels, and Allocatable. Everything else should be zeroed.
 func TestStripUnusedFields_Node(t *testing.T) {
 	node := &corev1.Node{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "node-1",
+			Name:            "node-1",
+			ResourceVersion: "7",
 			Labels: map[string]string{
 				"topology.kubernetes.io/zone":        "us-east-1a",
 				"node.kubernetes.io/instance-type":   "m5.large",
@@ -327,6 +341,9 @@ func TestStripUnusedFields_Node(t *testing.T) {
 	if stripped.Name != "node-1" {
 		t.Errorf("Name = %q, want %q", stripped.Name, "node-1")
 	}
+	if stripped.ResourceVersion != "7" {
+		t.Errorf("ResourceVersion = %q, want %q", stripped.ResourceVersion, "7")
+	}
 	if len(stripped.Labels) != 3 {
 		t.Errorf("Labels count = %d, want 3", len(stripped.Labels))
 	}
@@ -543,3 +560,113 @@ func TestNodeInformerLabelSelector(t *testing.T) {
 		})
 	}
 }
+
+// TestNodeSource_Restart verifies that restarting the node informer with a
+// new selector swaps in a synced cache holding only the selected nodes.
+func TestNodeSource_Restart(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prod := makeNode("prod-1", "4", "8Gi")
+	prod.Labels = map[string]string{"env": "production"}
+	clientset := fake.NewClientset(prod, makeNode("dev-1", "4", "8Gi"))
+
+	nodes, err := newNodeSource(ctx, clientset, 0, 0, "", NodeFields{}, &InformerFreshness{}, nil, logger)
+	if err != nil {
+		t.Fatalf("newNodeSource() error = %v", err)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), nodes.HasSynced) {
+		t.Fatal("initial node informer did not sync")
+	}
+	if list, _ := nodes.List(labels.Everything()); len(list) != 2 {
+		t.Fatalf("List() = %d nodes, want 2", len(list))
+	}
+
+	if err := nodes.Restart(ctx, "env=production", NodeFields{}); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if got := nodes.Selector(); got != "env=production" {
+		t.Errorf("Selector() = %q, want env=production", got)
+	}
+	list, _ := nodes.List(labels.Everything())
+	if len(list) != 1 || list[0].Name != "prod-1" {
+		t.Errorf("List() after restart = %v, want only prod-1", list)
+	}
+	if _, err := nodes.Get("prod-1"); err != nil {
+		t.Errorf("Get(prod-1) error = %v", err)
+	}
+}
+
+// TestPodSource_Sharded verifies pods on nodes this replica does not own are
+// cached as stubs and left out of the index, and that a restart re-partitions
+// the cache for a new assignment, reporting the old member list until then.
+func TestPodSource_Sharded(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Find a node assigned to each of two members.
+	members := []string{"replica-a", "replica-b"}
+	owners := map[string]string{}
+	for i := 0; len(owners) < 2; i++ {
+		node := fmt.Sprintf("node-%d", i)
+		if _, ok := owners[shardOwner(members, node)]; !ok {
+			owners[shardOwner(members, node)] = node
+		}
+	}
+	nodeA, nodeB := owners["replica-a"], owners["replica-b"]
+
+	clientset := fake.NewClientset(
+		makePodWithResources("default", "a", nodeA, corev1.PodRunning, []corev1.Container{makeContainer("app", "1", "1Gi")}, nil),
+		makePodWithResources("default", "b", nodeB, corev1.PodRunning, []corev1.Container{makeContainer("app", "2", "1Gi")}, nil),
+	)
+	var assignment atomic.Value
+	assignment.Store(shardAssignment{members: members, identity: "replica-a"})
+
+	pods, err := newPodSource(ctx, clientset, 0, 0, true, func() shardAssignment { return assignment.Load().(shardAssignment) },
+		&InformerFreshness{}, nil, logger)
+	if err != nil {
+		t.Fatalf("newPodSource() error = %v", err)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), pods.HasSynced) {
+		t.Fatal("pod informer did not sync")
+	}
+
+	check := func(ownedNode, otherNode string) {
+		t.Helper()
+		allocations, stats := pods.Allocations()
+		if _, ok := allocations[otherNode]; ok || allocations[ownedNode] == nil || stats.counted != 1 {
+			t.Errorf("allocations = %v, stats = %+v, want only %s", allocations, stats, ownedNode)
+		}
+		list, _ := pods.List(labels.Everything())
+		for _, pod := range list {
+			if stub := len(pod.Spec.Containers) == 0; stub != (pod.Spec.NodeName == otherNode) {
+				t.Errorf("pod on %s cached with %d containers", pod.Spec.NodeName, len(pod.Spec.Containers))
+			}
+		}
+	}
+	check(nodeA, nodeB)
+
+	// replica-b left: every node is assigned to replica-a, but the cache
+	// still reflects the two-member list until it is restarted.
+	assignment.Store(shardAssignment{members: []string{"replica-a"}, identity: "replica-a"})
+	if got := pods.ShardMembers(); !slices.Equal(got, members) {
+		t.Errorf("ShardMembers() before restart = %v, want %v", got, members)
+	}
+	if err := pods.Restart(ctx); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if got := pods.ShardMembers(); !slices.Equal(got, []string{"replica-a"}) {
+		t.Errorf("ShardMembers() after restart = %v, want [replica-a]", got)
+	}
+	if allocations, stats := pods.Allocations(); allocations[nodeA] == nil || allocations[nodeB] == nil || stats.counted != 2 {
+		t.Errorf("allocations after restart = %v, stats = %+v, want both nodes", allocations, stats)
+	}
+
+	assignment.Store(shardAssignment{members: members, identity: "replica-b"})
+	if err := pods.Restart(ctx); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	check(nodeB, nodeA)
+}
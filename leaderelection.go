@@ -29,38 +29,41 @@ type LeaderElectionConfig struct {
 const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 
 // detectNamespace returns the override value if non-empty, otherwise reads from
-// the downward API service account file. Returns an error if neither is available.
-func detectNamespace(override string) (string, error) {
+// the downward API service account file. Returns an error if neither is
+// available, naming flagName, the flag that sets the override.
+func detectNamespace(override, flagName string) (string, error) {
 	if override != "" {
 		return override, nil
 	}
 	data, err := os.ReadFile(serviceAccountNamespaceFile)
 	if err != nil {
-		return "", fmt.Errorf("cannot detect namespace (not running in-cluster?): set --leader-election-namespace explicitly: %w", err)
+		return "", fmt.Errorf("cannot detect namespace (not running in-cluster?): set --%s or %s: %w", flagName, envName(flagName), err)
 	}
 	ns := string(data)
 	if ns == "" {
-		return "", fmt.Errorf("namespace file %s is empty: set --leader-election-namespace explicitly", serviceAccountNamespaceFile)
+		return "", fmt.Errorf("namespace file %s is empty: set --%s or %s", serviceAccountNamespaceFile, flagName, envName(flagName))
 	}
 	return ns, nil
 }
 
 // detectIdentity returns the override value if non-empty, otherwise falls back
-// to os.Hostname() which in Kubernetes equals the pod name.
-func detectIdentity(override string) (string, error) {
+// to os.Hostname() which in Kubernetes equals the pod name. Errors name
+// flagName, the flag that sets the override.
+func detectIdentity(override, flagName string) (string, error) {
 	if override != "" {
 		return override, nil
 	}
 	hostname, err := os.Hostname()
 	if err != nil {
-		return "", fmt.Errorf("cannot detect identity from hostname: set --leader-election-id explicitly: %w", err)
+		return "", fmt.Errorf("cannot detect identity from hostname: set --%s or %s: %w", flagName, envName(flagName), err)
 	}
 	return hostname, nil
 }
 
-// runLeaderElection starts the leader election loop. It blocks until the context
-// is cancelled. On leadership loss it calls os.Exit(0) — the standard Kubernetes
-// pattern where the kubelet restarts the pod to re-enter the election.
+// runLeaderElection runs the leader election loop until the context is
+// cancelled. On leadership loss isLeader flips back to false and the instance
+// re-enters the election as a standby, keeping its informer cache and HTTP
+// server running instead of restarting the process.
 func runLeaderElection(ctx context.Context, clientset kubernetes.Interface, config LeaderElectionConfig, isLeader *atomic.Bool, logger *slog.Logger) {
 	lock := &resourcelock.LeaseLock{
 		LeaseMeta: metav1.ObjectMeta{
@@ -80,28 +83,39 @@ func runLeaderElection(ctx context.Context, clientset kubernetes.Interface, conf
 		"renew_deadline", config.RenewDeadline,
 		"retry_period", config.RetryPeriod)
 
-	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
-		Lock:            lock,
-		LeaseDuration:   config.LeaseDuration,
-		RenewDeadline:   config.RenewDeadline,
-		RetryPeriod:     config.RetryPeriod,
-		ReleaseOnCancel: true,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
-				isLeader.Store(true)
-				logger.Info("acquired leadership — publishing binpacking metrics")
+	for {
+		// RunOrDie returns once leadership is lost or the context is cancelled.
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   config.LeaseDuration,
+			RenewDeadline:   config.RenewDeadline,
+			RetryPeriod:     config.RetryPeriod,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					isLeader.Store(true)
+					logger.Info("acquired leadership — publishing binpacking metrics")
+				},
+				OnStoppedLeading: func() {
+					// Called whenever RunOrDie returns, including on shutdown
+					// and when leadership was never acquired.
+					if isLeader.Swap(false) && ctx.Err() == nil {
+						logger.Warn("lost leadership — re-entering election as standby")
+					}
+				},
+				OnNewLeader: func(identity string) {
+					if identity == config.Identity {
+						return
+					}
+					logger.Info("current leader", "identity", identity)
+				},
 			},
-			OnStoppedLeading: func() {
-				isLeader.Store(false)
-				logger.Info("lost leadership — exiting to re-enter election")
-				os.Exit(0)
-			},
-			OnNewLeader: func(identity string) {
-				if identity == config.Identity {
-					return
-				}
-				logger.Info("current leader", "identity", identity)
-			},
-		},
-	})
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.RetryPeriod):
+		}
+	}
 }
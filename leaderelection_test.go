@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestDetectNamespace(t *testing.T) {
 	t.Run("override provided", func(t *testing.T) {
-		ns, err := detectNamespace("my-namespace")
+		ns, err := detectNamespace("my-namespace", "leader-election-namespace")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -19,20 +31,23 @@ func TestDetectNamespace(t *testing.T) {
 	t.Run("empty override and no service account file", func(t *testing.T) {
 		// This test assumes the CI/local environment doesn't have the
 		// in-cluster service account namespace file.
-		_, err := detectNamespace("")
+		_, err := detectNamespace("", "leader-election-namespace")
 		if err == nil {
 			// If we're running in-cluster this would succeed; skip in that case
 			if _, statErr := os.Stat(serviceAccountNamespaceFile); statErr == nil {
 				t.Skip("running in-cluster, skipping namespace detection failure test")
 			}
-			t.Error("expected error when no override and no SA file, got nil")
+			t.Fatal("expected error when no override and no SA file, got nil")
+		}
+		if msg := err.Error(); !strings.Contains(msg, "--leader-election-namespace") || !strings.Contains(msg, "KBE_LEADER_ELECTION_NAMESPACE") {
+			t.Errorf("error %q should name the flag and its environment variable", msg)
 		}
 	})
 }
 
 func TestDetectIdentity(t *testing.T) {
 	t.Run("override provided", func(t *testing.T) {
-		id, err := detectIdentity("my-pod-name")
+		id, err := detectIdentity("my-pod-name", "leader-election-id")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -42,7 +57,7 @@ func TestDetectIdentity(t *testing.T) {
 	})
 
 	t.Run("empty override falls back to hostname", func(t *testing.T) {
-		id, err := detectIdentity("")
+		id, err := detectIdentity("", "leader-election-id")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -52,3 +67,120 @@ func TestDetectIdentity(t *testing.T) {
 		}
 	})
 }
+
+// waitForLeader polls isLeader until it equals want or the timeout expires.
+func waitForLeader(t *testing.T, isLeader *atomic.Bool, want bool, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if isLeader.Load() == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("isLeader = %v after %s, want %v", isLeader.Load(), timeout, want)
+}
+
+// TestRunLeaderElection_ReacquiresAfterLoss verifies that losing the Lease
+// flips the instance back to standby without exiting, and that it re-enters
+// the election and reacquires the Lease once it can renew again.
+func TestRunLeaderElection_ReacquiresAfterLoss(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	clientset := fake.NewClientset()
+	config := LeaderElectionConfig{
+		LeaseName:      "kbe-test",
+		LeaseNamespace: "default",
+		Identity:       "replica-a",
+		LeaseDuration:  1 * time.Second,
+		RenewDeadline:  500 * time.Millisecond,
+		RetryPeriod:    100 * time.Millisecond,
+	}
+	isLeader := new(atomic.Bool)
+
+	// partitioned makes every Lease request fail, as if the API server were
+	// unreachable, so the leader cannot renew.
+	partitioned := new(atomic.Bool)
+	clientset.PrependReactor("*", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if partitioned.Load() {
+			return true, nil, fmt.Errorf("connection refused")
+		}
+		return false, nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runLeaderElection(ctx, clientset, config, isLeader, logger)
+		close(done)
+	}()
+
+	// Acquire: the Lease is free, so this replica becomes leader.
+	waitForLeader(t, isLeader, true, 5*time.Second)
+
+	// Lose: renewals fail past the renew deadline.
+	partitioned.Store(true)
+	waitForLeader(t, isLeader, false, 5*time.Second)
+
+	// Reacquire: the process kept running and re-entered the election, so it
+	// takes the Lease again once the API server is reachable.
+	partitioned.Store(false)
+	waitForLeader(t, isLeader, true, 5*time.Second)
+
+	lease, err := clientset.CoordinationV1().Leases(config.LeaseNamespace).Get(ctx, config.LeaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting lease: %v", err)
+	}
+	if got := *lease.Spec.HolderIdentity; got != config.Identity {
+		t.Errorf("lease holder = %q, want %q", got, config.Identity)
+	}
+
+	// Shutdown: cancelling the context returns and leaves standby state.
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runLeaderElection did not return after context cancellation")
+	}
+	if isLeader.Load() {
+		t.Error("isLeader should be false after shutdown")
+	}
+}
+
+// TestRunLeaderElection_StandbyWhileLeaseHeld verifies that a replica stays
+// standby while another holder keeps the Lease, and takes over once the
+// holder stops renewing.
+func TestRunLeaderElection_StandbyWhileLeaseHeld(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	holder := "replica-b"
+	now := metav1.NewMicroTime(time.Now())
+	leaseSeconds := int32(1)
+	clientset := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "kbe-test", Namespace: "default"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &leaseSeconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	})
+	config := LeaderElectionConfig{
+		LeaseName:      "kbe-test",
+		LeaseNamespace: "default",
+		Identity:       "replica-a",
+		LeaseDuration:  1 * time.Second,
+		RenewDeadline:  500 * time.Millisecond,
+		RetryPeriod:    100 * time.Millisecond,
+	}
+	isLeader := new(atomic.Bool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runLeaderElection(ctx, clientset, config, isLeader, logger)
+
+	time.Sleep(300 * time.Millisecond)
+	if isLeader.Load() {
+		t.Fatal("replica should be standby while another holder's Lease is valid")
+	}
+	// replica-b never renews, so its Lease expires and replica-a acquires it.
+	waitForLeader(t, isLeader, true, 5*time.Second)
+}
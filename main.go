@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -16,6 +23,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
@@ -33,141 +41,464 @@ func (s *stringSliceFlag) Set(val string) error {
 }
 
 func main() {
-	var (
-		kubeconfig      string
-		metricsAddr     string
-		metricsPath     string
-		resourceCSV     string
-		labelGroupFlags stringSliceFlag
-		logLevel        string
-		logFormat       string
-		resyncPeriod    string
-		listPageSize       int
-		nodeSelector       string
-		disableNodeMetrics bool
-
-		leaderElect              bool
-		leaderElectLeaseName     string
-		leaderElectNamespace     string
-		leaderElectID            string
-		leaderElectLeaseDuration string
-		leaderElectRenewDeadline string
-		leaderElectRetryPeriod   string
-	)
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(runSnapshot(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	opts, err := parseOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	flag.StringVar(&kubeconfig, "kubeconfig", "", "path to kubeconfig (uses in-cluster config if empty)")
-	flag.StringVar(&metricsAddr, "metrics-addr", ":9101", "address to serve metrics on")
-	flag.StringVar(&metricsPath, "metrics-path", "/metrics", "HTTP path for metrics endpoint")
-	flag.StringVar(&resourceCSV, "resources", "cpu,memory", "comma-separated list of resources to track")
-	flag.Var(&labelGroupFlags, "label-group", "comma-separated label keys defining one combination group (repeatable, e.g., --label-group=zone,instance-type --label-group=zone)")
-	flag.BoolVar(&disableNodeMetrics, "disable-node-metrics", false, "disable per-node metrics to reduce cardinality (only emit cluster-wide and group metrics)")
-	flag.StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn, error")
-	flag.StringVar(&logFormat, "log-format", "json", "log format: json, text")
-	flag.StringVar(&resyncPeriod, "resync-period", "30m", "informer cache resync period (e.g., 1m, 30s, 1h30m)")
-	flag.IntVar(&listPageSize, "list-page-size", 500, "number of resources to fetch per page during initial sync (0 = no pagination)")
-	flag.StringVar(&nodeSelector, "node-selector", "", "Kubernetes label selector to filter which nodes are tracked (e.g., 'environment=production,!node-role.kubernetes.io/control-plane')")
-	flag.BoolVar(&leaderElect, "leader-election", false, "enable leader election for HA (only the leader publishes binpacking metrics)")
-	flag.StringVar(&leaderElectLeaseName, "leader-election-lease-name", "kube-binpacking-exporter", "name of the Lease object used for leader election")
-	flag.StringVar(&leaderElectNamespace, "leader-election-namespace", "", "namespace for the leader election Lease (auto-detected from service account if empty)")
-	flag.StringVar(&leaderElectID, "leader-election-id", "", "unique identity for this participant in leader election (defaults to hostname)")
-	flag.StringVar(&leaderElectLeaseDuration, "leader-election-lease-duration", "15s", "duration that non-leader candidates will wait before attempting to acquire leadership")
-	flag.StringVar(&leaderElectRenewDeadline, "leader-election-renew-deadline", "10s", "duration that the leader will retry refreshing leadership before giving up")
-	flag.StringVar(&leaderElectRetryPeriod, "leader-election-retry-period", "2s", "duration between leader election retries")
-	flag.Parse()
-
-	level := parseLogLevel(logLevel)
-	handler := createLogHandler(logFormat, level)
+	level := parseLogLevel(opts.logLevel)
+	handler := createLogHandler(opts.logFormat, level)
 	logger := slog.New(handler)
-	logger.Info("starting kube-binpacking-exporter", "version", version, "log_level", logLevel, "log_format", logFormat)
+	logger.Info("starting kube-binpacking-exporter", "version", version, "log_level", opts.logLevel, "log_format", opts.logFormat)
 
-	resources := parseResources(resourceCSV)
-	logger.Info("tracking resources", "resources", resourceCSV)
+	if opts.configFile != "" {
+		logger.Info("loaded config file", "path", opts.configFile)
+	}
+	logger.Info("effective configuration", slog.Group("options", opts.logAttrs()...))
 
-	labelGroups := parseLabelGroups(labelGroupFlags)
-	if len(labelGroups) > 0 {
-		groupStrs := make([]string, len(labelGroups))
-		for i, g := range labelGroups {
-			groupStrs[i] = strings.Join(g, ",")
+	settings, err := opts.collectorSettings()
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("tracking resources", "resources", opts.resourceCSV)
+	if len(settings.LabelGroups) > 0 {
+		groupStrs := make([]string, len(settings.LabelGroups))
+		for i, g := range settings.LabelGroups {
+			groupStrs[i] = g.Name
 		}
 		logger.Info("tracking label groups", "groups", groupStrs)
 	}
+	for _, g := range settings.SelectorGroups {
+		logger.Info("tracking selector group", "group", g.Name, "selector", g.Selector.String())
+	}
+	for groupName, target := range settings.HeadroomTargets {
+		logger.Info("tracking headroom target", "label_group", groupName, "target", target)
+	}
+	if settings.Pricing != nil {
+		logger.Info("cost metrics enabled", "path", opts.pricingFile, "label_keys", settings.Pricing.LabelKeys(), "prices", settings.Pricing.Len())
+	}
 
-	if disableNodeMetrics {
+	if opts.disableNodeMetrics {
 		logger.Info("per-node metrics disabled - only emitting cluster-wide and group metrics")
 	}
 
-	resync, err := time.ParseDuration(resyncPeriod)
+	resync, err := time.ParseDuration(opts.resyncPeriod)
 	if err != nil {
-		logger.Error("invalid resync period", "error", err, "value", resyncPeriod)
+		logger.Error("invalid resync period", "error", err, "value", opts.resyncPeriod)
 		os.Exit(1)
 	}
 	logger.Info("informer resync period", "duration", resync)
 
-	if nodeSelector != "" {
-		if _, err := labels.Parse(nodeSelector); err != nil {
-			logger.Error("invalid node selector", "error", err, "value", nodeSelector)
+	staleAfter, err := time.ParseDuration(opts.staleThreshold)
+	if err != nil {
+		logger.Error("invalid stale threshold", "error", err, "value", opts.staleThreshold)
+		os.Exit(1)
+	}
+	if opts.staleMetrics != "keep" && opts.staleMetrics != "drop" {
+		logger.Error("invalid stale metrics mode, must be keep or drop", "value", opts.staleMetrics)
+		os.Exit(1)
+	}
+	if opts.staleMetrics == "drop" && staleAfter <= 0 {
+		logger.Error("--stale-metrics=drop requires --stale-threshold")
+		os.Exit(1)
+	}
+	if opts.readinessRequireLeader && !opts.leaderElect {
+		logger.Error("--readiness-require-leader requires --leader-election")
+		os.Exit(1)
+	}
+	if opts.standbyProxy && !opts.leaderElect {
+		logger.Error("--standby-proxy requires --leader-election")
+		os.Exit(1)
+	}
+	_, metricsPort, err := net.SplitHostPort(opts.metricsAddr)
+	if err != nil {
+		logger.Error("invalid metrics address", "error", err, "value", opts.metricsAddr)
+		os.Exit(1)
+	}
+
+	if opts.sharding && opts.leaderElect {
+		logger.Error("--sharding and --leader-election are mutually exclusive")
+		os.Exit(1)
+	}
+	if err := opts.validateReloadable(settings); err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	reloadEvery, err := time.ParseDuration(opts.configReloadInterval)
+	if err != nil {
+		logger.Error("invalid config reload interval", "error", err, "value", opts.configReloadInterval)
+		os.Exit(1)
+	}
+
+	if !metricNameRE.MatchString(opts.metricNamespace) {
+		logger.Error("invalid metric namespace", "value", opts.metricNamespace)
+		os.Exit(1)
+	}
+	constLabels, err := parseConstLabels(opts.constLabelFlags)
+	if err != nil {
+		logger.Error("invalid constant label", "error", err)
+		os.Exit(1)
+	}
+
+	clusters, err := parseClusters(opts.clusterFlags, opts.kubeconfig)
+	if err != nil {
+		logger.Error("invalid cluster", "error", err)
+		os.Exit(1)
+	}
+	if len(clusters) > 0 {
+		_, clusterConstLabel := constLabels[clusterLabel]
+		switch {
+		case opts.leaderElect, opts.sharding:
+			logger.Error("--cluster cannot be combined with --leader-election or --sharding")
+			os.Exit(1)
+		case opts.usageMetricsEndpoint != "":
+			logger.Error("--cluster cannot be combined with --usage-metrics-endpoint; usage is read through each cluster's API server")
+			os.Exit(1)
+		case clusterConstLabel:
+			logger.Error("--const-label cannot set the cluster label in multi-cluster mode")
 			os.Exit(1)
 		}
-		logger.Info("node selector filter", "selector", nodeSelector)
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	var usageInterval time.Duration
+	if opts.usageMetrics {
+		usageInterval, err = time.ParseDuration(opts.usageMetricsInterval)
+		if err != nil || usageInterval <= 0 {
+			logger.Error("invalid usage metrics interval, must be positive", "error", err, "value", opts.usageMetricsInterval)
+			os.Exit(1)
+		}
+	}
 
-	nodeLister, podLister, readyChecker, syncInfo, clientset, err := setupKubernetes(ctx, logger, kubeconfig, resync, int64(listPageSize), nodeSelector)
+	snapshotEvery, err := time.ParseDuration(opts.snapshotInterval)
 	if err != nil {
-		logger.Error("failed to setup kubernetes client", "error", err)
+		logger.Error("invalid snapshot interval", "error", err, "value", opts.snapshotInterval)
 		os.Exit(1)
 	}
 
-	// Leader election setup: when enabled, only the leader publishes binpacking metrics.
-	var isLeader *atomic.Bool
-	if leaderElect {
-		isLeader = new(atomic.Bool) // starts as false (standby)
+	var otlpEvery time.Duration
+	if opts.otlpEndpoint != "" {
+		otlpEvery, err = time.ParseDuration(opts.otlpInterval)
+		if err != nil || otlpEvery <= 0 {
+			logger.Error("invalid OTLP interval, must be positive", "error", err, "value", opts.otlpInterval)
+			os.Exit(1)
+		}
+	}
 
-		ns, err := detectNamespace(leaderElectNamespace)
-		if err != nil {
-			logger.Error("leader election namespace detection failed", "error", err)
+	var remoteWriteEvery time.Duration
+	if opts.remoteWriteURL != "" {
+		remoteWriteEvery, err = time.ParseDuration(opts.remoteWriteInterval)
+		if err != nil || remoteWriteEvery <= 0 {
+			logger.Error("invalid remote write interval, must be positive", "error", err, "value", opts.remoteWriteInterval)
 			os.Exit(1)
 		}
+		if opts.remoteWriteQueueSize < 1 {
+			logger.Error("invalid remote write queue size, must be at least 1", "value", opts.remoteWriteQueueSize)
+			os.Exit(1)
+		}
+		if opts.remoteWriteBearerToken != "" && opts.remoteWriteUsername != "" {
+			logger.Error("--remote-write-bearer-token and --remote-write-username are mutually exclusive")
+			os.Exit(1)
+		}
+	}
 
-		id, err := detectIdentity(leaderElectID)
-		if err != nil {
-			logger.Error("leader election identity detection failed", "error", err)
+	var dogstatsdEvery time.Duration
+	if opts.dogstatsdAddr != "" {
+		dogstatsdEvery, err = time.ParseDuration(opts.dogstatsdInterval)
+		if err != nil || dogstatsdEvery <= 0 {
+			logger.Error("invalid DogStatsD interval, must be positive", "error", err, "value", opts.dogstatsdInterval)
 			os.Exit(1)
 		}
+	}
 
-		leaseDuration, err := time.ParseDuration(leaderElectLeaseDuration)
+	// Every replica pushes its own series (standby gate metrics, or partial
+	// sums with sharding), so pushed metrics identify the replica.
+	var pushInstance string
+	if opts.remoteWriteURL != "" || opts.otlpEndpoint != "" || opts.dogstatsdAddr != "" {
+		pushInstance, err = detectIdentity(opts.pushInstance, "push-instance")
 		if err != nil {
-			logger.Error("invalid leader election lease duration", "error", err, "value", leaderElectLeaseDuration)
+			logger.Error("push instance detection failed", "error", err)
 			os.Exit(1)
 		}
-		renewDeadline, err := time.ParseDuration(leaderElectRenewDeadline)
+	}
+
+	if opts.nodeSelector != "" {
+		logger.Info("node selector filter", "selector", opts.nodeSelector)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Self-observability metrics live on their own registry so they can be
+	// scraped independently of the (potentially large) binpacking metrics.
+	exporterRegistry := prometheus.NewRegistry()
+	exporterMetrics := NewExporterMetrics(exporterRegistry, len(clusters) > 0)
+
+	// Collector options shared by every cluster.
+	var baseOpts []CollectorOption
+	if staleAfter > 0 {
+		baseOpts = append(baseOpts, WithStaleThreshold(staleAfter, opts.staleMetrics == "drop"))
+		logger.Info("cache staleness detection enabled", "threshold", staleAfter, "stale_metrics", opts.staleMetrics)
+	}
+	if snapshotEvery > 0 {
+		baseOpts = append(baseOpts, WithSnapshotInterval(snapshotEvery))
+		logger.Info("snapshot mode enabled", "interval", snapshotEvery)
+	}
+
+	registry := prometheus.NewRegistry()
+	var (
+		target          reloadTarget
+		readiness       readinessChecker
+		syncz           http.HandlerFunc
+		api             binpackingSource
+		currentSettings func() (string, CollectorSettings)
+		isLeader        *atomic.Bool
+		resolver        *leaderResolver
+	)
+	if len(clusters) > 0 {
+		// Multi-cluster mode: one informer set and collector per cluster,
+		// each connecting independently and labelled with the cluster name.
+		connect := func(ctx context.Context, cluster ClusterConfig, selector string, settings CollectorSettings) (*clusterConn, error) {
+			clusterLogger := logger.With("cluster", cluster.Name)
+			clusterMetrics := exporterMetrics.ForCluster(cluster.Name)
+			nodes, pods, synced, syncInfo, clientset, err := setupKubernetes(ctx, clusterLogger, cluster.Kubeconfig, cluster.Context, resync, int64(opts.listPageSize), selector, nodeFieldsFor(settings.LabelGroups), true, clusterMetrics)
+			if err != nil {
+				return nil, err
+			}
+
+			clusterLabels := prometheus.Labels{clusterLabel: cluster.Name}
+			maps.Copy(clusterLabels, constLabels)
+			collectorOpts := append(slices.Clone(baseOpts), WithExporterMetrics(clusterMetrics), WithAllocationIndex(pods), WithMetricNamespace(opts.metricNamespace, clusterLabels))
+			if opts.usageMetrics {
+				tracker := NewUsageTracker(newAPIServerFetcher(clientset.Discovery().RESTClient()), usageInterval, clusterLogger)
+				go tracker.Run(ctx)
+				collectorOpts = append(collectorOpts, WithUsageTracker(tracker))
+			}
+
+			collector := NewBinpackingCollector(nodes, pods, clusterLogger, nil, nil, false, syncInfo, nil, collectorOpts...)
+			collector.Reconfigure(settings)
+			go collector.RunSnapshots(ctx)
+			return &clusterConn{nodes: nodes, synced: synced, syncInfo: syncInfo, collector: collector}, nil
+		}
+
+		clusterSet := NewClusterSet(clusters, connect, registry, opts.nodeSelector, settings, logger)
+		go clusterSet.Run(ctx)
+		logger.Info("multi-cluster mode enabled", "clusters", clusterSet.Names())
+
+		target = clusterSet
+		currentSettings = clusterSet.Settings
+		readiness = clusterReadiness{set: clusterSet, staleThreshold: staleAfter}
+		syncz = clusterSyncHandler(clusterSet, staleAfter)
+		api = clusterSetSource(clusterSet)
+	} else {
+		client, err := connectKubernetes(logger, opts.kubeconfig, "")
 		if err != nil {
-			logger.Error("invalid leader election renew deadline", "error", err, "value", leaderElectRenewDeadline)
+			logger.Error("failed to setup kubernetes client", "error", err)
 			os.Exit(1)
 		}
-		retryPeriod, err := time.ParseDuration(leaderElectRetryPeriod)
+		clientset := client.clientset
+
+		// Sharding setup: each replica collects only the nodes hashed to it,
+		// and caches only the pods on them.
+		var (
+			shard      *ShardMembership
+			assignment func() shardAssignment
+		)
+		if opts.sharding {
+			ns, err := detectNamespace(opts.shardingNamespace, "sharding-namespace")
+			if err != nil {
+				logger.Error("sharding namespace detection failed", "error", err)
+				os.Exit(1)
+			}
+
+			id, err := detectIdentity(opts.shardingID, "sharding-id")
+			if err != nil {
+				logger.Error("sharding identity detection failed", "error", err)
+				os.Exit(1)
+			}
+
+			leaseDuration, err := time.ParseDuration(opts.shardingLeaseDuration)
+			if err != nil || leaseDuration < time.Second {
+				logger.Error("invalid sharding lease duration, must be at least 1s", "error", err, "value", opts.shardingLeaseDuration)
+				os.Exit(1)
+			}
+
+			shard = NewShardMembership(clientset, ShardConfig{
+				Group:         opts.shardingGroup,
+				Namespace:     ns,
+				Identity:      id,
+				LeaseDuration: leaseDuration,
+			}, logger)
+			// Join before the informers start, so the pod cache only ever
+			// holds this replica's pods.
+			if err := shard.Join(ctx); err != nil {
+				logger.Error("failed to join sharding group", "error", err)
+				os.Exit(1)
+			}
+			go shard.Run(ctx)
+			assignment = shard.Assignment
+		}
+
+		nodes, pods, readyChecker, syncInfo, err := startInformers(ctx, logger, client, resync, int64(opts.listPageSize), opts.nodeSelector, nodeFieldsFor(settings.LabelGroups), true, assignment, exporterMetrics)
 		if err != nil {
-			logger.Error("invalid leader election retry period", "error", err, "value", leaderElectRetryPeriod)
+			logger.Error("failed to start informers", "error", err)
 			os.Exit(1)
 		}
+		if shard != nil {
+			go pods.RestartOn(ctx, shard.Changes())
+		}
+
+		// Leader election setup: when enabled, only the leader publishes binpacking metrics.
+		if opts.leaderElect {
+			isLeader = new(atomic.Bool) // starts as false (standby)
+
+			ns, err := detectNamespace(opts.leaderElectNamespace, "leader-election-namespace")
+			if err != nil {
+				logger.Error("leader election namespace detection failed", "error", err)
+				os.Exit(1)
+			}
+
+			id, err := detectIdentity(opts.leaderElectID, "leader-election-id")
+			if err != nil {
+				logger.Error("leader election identity detection failed", "error", err)
+				os.Exit(1)
+			}
+
+			leaseDuration, err := time.ParseDuration(opts.leaderElectLeaseDuration)
+			if err != nil {
+				logger.Error("invalid leader election lease duration", "error", err, "value", opts.leaderElectLeaseDuration)
+				os.Exit(1)
+			}
+			renewDeadline, err := time.ParseDuration(opts.leaderElectRenewDeadline)
+			if err != nil {
+				logger.Error("invalid leader election renew deadline", "error", err, "value", opts.leaderElectRenewDeadline)
+				os.Exit(1)
+			}
+			retryPeriod, err := time.ParseDuration(opts.leaderElectRetryPeriod)
+			if err != nil {
+				logger.Error("invalid leader election retry period", "error", err, "value", opts.leaderElectRetryPeriod)
+				os.Exit(1)
+			}
+
+			leConfig := LeaderElectionConfig{
+				LeaseName:      opts.leaderElectLeaseName,
+				LeaseNamespace: ns,
+				Identity:       id,
+				LeaseDuration:  leaseDuration,
+				RenewDeadline:  renewDeadline,
+				RetryPeriod:    retryPeriod,
+			}
+
+			go runLeaderElection(ctx, clientset, leConfig, isLeader, logger)
+
+			if opts.standbyProxy {
+				resolver = newLeaderResolver(clientset, leConfig, metricsPort)
+				logger.Info("standby proxy enabled", "lease", leConfig.LeaseNamespace+"/"+leConfig.LeaseName)
+			}
+		}
+
+		collectorOpts := append(slices.Clone(baseOpts), WithExporterMetrics(exporterMetrics), WithAllocationIndex(pods))
+		if shard != nil {
+			collectorOpts = append(collectorOpts, WithShard(shard, pods.ShardMembers))
+		}
+
+		if opts.usageMetrics {
+			var fetch usageFetcher
+			if opts.usageMetricsEndpoint != "" {
+				fetch = newHTTPFetcher(opts.usageMetricsEndpoint, &http.Client{Timeout: 10 * time.Second})
+			} else {
+				fetch = newAPIServerFetcher(clientset.Discovery().RESTClient())
+			}
+			logger.Info("usage metrics enabled", "endpoint", opts.usageMetricsEndpoint, "interval", usageInterval)
+
+			tracker := NewUsageTracker(fetch, usageInterval, logger)
+			go tracker.Run(ctx)
+			collectorOpts = append(collectorOpts, WithUsageTracker(tracker))
+		}
 
-		leConfig := LeaderElectionConfig{
-			LeaseName:      leaderElectLeaseName,
-			LeaseNamespace: ns,
-			Identity:       id,
-			LeaseDuration:  leaseDuration,
-			RenewDeadline:  renewDeadline,
-			RetryPeriod:    retryPeriod,
+		if opts.metricNamespace != defaultMetricNamespace || len(constLabels) > 0 {
+			collectorOpts = append(collectorOpts, WithMetricNamespace(opts.metricNamespace, constLabels))
+			logger.Info("metric naming", "namespace", opts.metricNamespace, "const_labels", constLabels)
 		}
 
-		go runLeaderElection(ctx, clientset, leConfig, isLeader, logger)
+		collector := NewBinpackingCollector(nodes, pods, logger, nil, nil, false, syncInfo, isLeader, collectorOpts...)
+		collector.Reconfigure(settings)
+		go collector.RunSnapshots(ctx)
+
+		registry.MustRegister(collector)
+
+		target = &clusterConn{nodes: nodes, synced: readyChecker, syncInfo: syncInfo, collector: collector}
+		currentSettings = func() (string, CollectorSettings) { return nodes.Selector(), collector.Settings() }
+
+		check := readinessCheck{synced: readyChecker, syncInfo: syncInfo, staleThreshold: staleAfter}
+		if opts.readinessRequireLeader {
+			check.isLeader = isLeader
+		}
+		readiness = check
+		syncz = syncHandler(syncInfo)
+		api = singleCollectorSource(collector)
 	}
 
-	collector := NewBinpackingCollector(nodeLister, podLister, logger, resources, labelGroups, !disableNodeMetrics, syncInfo, isLeader)
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(collector)
+	if opts.configFile != "" && reloadEvery > 0 {
+		reloader := &configReloader{
+			args:     os.Args[1:],
+			interval: reloadEvery,
+			startup:  opts,
+			target:   target,
+			logger:   logger,
+		}
+		go reloader.Run(ctx)
+		logger.Info("config file reload enabled", "path", opts.configFile, "interval", reloadEvery)
+	}
+
+	var otlpPusher *OTLPPusher
+	if opts.otlpEndpoint != "" {
+		otlpPusher, err = NewOTLPPusher(ctx, OTLPConfig{
+			Endpoint:    opts.otlpEndpoint,
+			Protocol:    opts.otlpProtocol,
+			Insecure:    opts.otlpInsecure,
+			Interval:    otlpEvery,
+			ClusterName: opts.otlpClusterName,
+			InstanceID:  pushInstance,
+		}, registry, logger)
+		if err != nil {
+			logger.Error("failed to setup OTLP exporter", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("OTLP metrics push enabled", "endpoint", redactedValue("otlp-endpoint", opts.otlpEndpoint), "protocol", opts.otlpProtocol, "interval", otlpEvery)
+	}
+
+	if opts.remoteWriteURL != "" {
+		writer := NewRemoteWriter(RemoteWriteConfig{
+			URL:         opts.remoteWriteURL,
+			Interval:    remoteWriteEvery,
+			QueueSize:   opts.remoteWriteQueueSize,
+			Username:    opts.remoteWriteUsername,
+			Password:    opts.remoteWritePassword,
+			BearerToken: opts.remoteWriteBearerToken,
+			Instance:    pushInstance,
+		}, registry, &http.Client{Timeout: 30 * time.Second}, exporterMetrics, logger)
+		go writer.Run(ctx)
+		logger.Info("remote write enabled", "url", redactedValue("remote-write-url", opts.remoteWriteURL), "interval", remoteWriteEvery, "queue_size", opts.remoteWriteQueueSize, "instance", pushInstance)
+	}
+
+	if opts.dogstatsdAddr != "" {
+		emitter, err := NewDogStatsDEmitter(opts.dogstatsdAddr, registry, dogstatsdEvery, opts.metricNamespace, pushInstance, logger)
+		if err != nil {
+			logger.Error("failed to setup DogStatsD emitter", "error", err)
+			os.Exit(1)
+		}
+		go emitter.Run(ctx)
+		logger.Info("DogStatsD emitter enabled", "addr", opts.dogstatsdAddr, "interval", dogstatsdEvery, "instance", pushInstance)
+	}
 
 	mux := http.NewServeMux()
 
@@ -179,17 +510,22 @@ func main() {
 		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
+		selector, current := currentSettings()
 		labelGroupsHTML := ""
-		if len(labelGroups) > 0 {
+		if groups := current.LabelGroups; len(groups) > 0 {
 			labelGroupsHTML = "<h3>Label Groups</h3><ul>"
-			for _, g := range labelGroups {
-				labelGroupsHTML += "<li>" + strings.Join(g, ", ") + "</li>"
+			for _, g := range groups {
+				keys := strings.Join(g.Keys, ", ")
+				if g.Name != strings.Join(g.Keys, ",") {
+					keys = g.Name + ": " + keys
+				}
+				labelGroupsHTML += "<li>" + keys + "</li>"
 			}
 			labelGroupsHTML += "</ul>"
 		}
 		nodeSelectorHTML := ""
-		if nodeSelector != "" {
-			nodeSelectorHTML = "<h3>Node Selector</h3><p><code>" + nodeSelector + "</code></p>"
+		if selector != "" {
+			nodeSelectorHTML = "<h3>Node Selector</h3><p><code>" + selector + "</code></p>"
 		}
 		_, _ = fmt.Fprintf(w, `<!DOCTYPE html>
 <html>
@@ -199,16 +535,23 @@ func main() {
 <p>Version: %s</p>
 <ul>
 <li><a href="%s">%s</a> - Prometheus metrics</li>
+<li><a href="%s">%s</a> - Exporter self-metrics</li>
 <li><a href="/sync">/sync</a> - Cache sync status (JSON)</li>
+<li><a href="/api/v1/cluster">/api/v1/cluster</a> - Binpacking API (JSON)</li>
 <li><a href="/healthz">/healthz</a> - Liveness probe</li>
 <li><a href="/readyz">/readyz</a> - Readiness probe</li>
 </ul>
 %s%s
 </body>
-</html>`, version, metricsPath, metricsPath, nodeSelectorHTML, labelGroupsHTML)
+</html>`, version, opts.metricsPath, opts.metricsPath, opts.exporterMetricsPath, opts.exporterMetricsPath, nodeSelectorHTML, labelGroupsHTML)
 	})
 
-	mux.Handle(metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	var metricsHandler http.Handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	if resolver != nil {
+		metricsHandler = standbyProxyHandler(metricsHandler, isLeader, resolver, &http.Client{Timeout: 30 * time.Second}, logger)
+	}
+	mux.Handle(opts.metricsPath, metricsHandler)
+	mux.Handle(opts.exporterMetricsPath, promhttp.HandlerFor(exporterRegistry, promhttp.HandlerOpts{}))
 
 	// Liveness probe - checks if process is alive
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
@@ -216,43 +559,32 @@ func main() {
 		_, _ = fmt.Fprintln(w, "ok")
 	})
 
-	// Readiness probe - checks if informer cache is synced
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
-		if readyChecker() {
-			w.WriteHeader(http.StatusOK)
-			_, _ = fmt.Fprintln(w, "ready")
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			_, _ = fmt.Fprintln(w, "not ready: informer cache not synced")
-		}
-	})
-
-	// Sync status endpoint - shows cache sync information
-	mux.HandleFunc("/sync", func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = fmt.Fprintf(w, `{
-  "last_sync": "%s",
-  "sync_age_seconds": %.0f,
-  "resync_period": "%s",
-  "node_synced": %t,
-  "pod_synced": %t
-}`,
-			syncInfo.LastSyncTime.Format(time.RFC3339),
-			time.Since(syncInfo.LastSyncTime).Seconds(),
-			syncInfo.ResyncPeriod,
-			syncInfo.NodeSynced(),
-			syncInfo.PodSynced())
-	})
+	// Readiness probe - checks if informer cache is synced (and fresh, and
+	// leadership is held, when configured); in multi-cluster mode, for any
+	// one cluster
+	mux.HandleFunc("/readyz", readyHandler(readiness))
+
+	// Sync status endpoint - shows cache sync information, per cluster in
+	// multi-cluster mode
+	mux.HandleFunc("/sync", syncz)
+
+	// Binpacking JSON API - cluster, node and group values from the same
+	// snapshot as /metrics; ?cluster= selects the cluster in multi-cluster
+	// mode. Standbys answer 503, or forward to the leader with --standby-proxy.
+	apiV1 := apiHandler(api)
+	if resolver != nil {
+		apiV1 = standbyProxyHandler(apiV1, isLeader, resolver, &http.Client{Timeout: 30 * time.Second}, logger)
+	}
+	mux.Handle("/api/v1/", apiV1)
 
 	srv := &http.Server{
-		Addr:              metricsAddr,
+		Addr:              opts.metricsAddr,
 		Handler:           mux,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
 	go func() {
-		logger.Info("serving metrics", "addr", metricsAddr, "path", metricsPath)
+		logger.Info("serving metrics", "addr", opts.metricsAddr, "path", opts.metricsPath)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("http server error", "error", err)
 			os.Exit(1)
@@ -267,6 +599,11 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("http server shutdown error", "error", err)
 	}
+	if otlpPusher != nil {
+		if err := otlpPusher.Shutdown(shutdownCtx); err != nil {
+			logger.Error("OTLP exporter shutdown error", "error", err)
+		}
+	}
 }
 
 func parseLogLevel(level string) slog.Level {
@@ -327,3 +664,196 @@ func parseLabelGroups(flags []string) [][]string {
 	}
 	return groups
 }
+
+// metricNameRE and labelNameRE are the Prometheus metric and label name
+// syntax.
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// parseConstLabels parses --const-label flags of the form <name>=<value>.
+// Names must be valid, not reserved (__ prefix) and not clash with a label
+// the binpacking metrics already use.
+func parseConstLabels(flags []string) (prometheus.Labels, error) {
+	used := newDescriptors(defaultMetricNamespace, nil).variableLabels
+	constLabels := make(prometheus.Labels, len(flags))
+	for _, f := range flags {
+		name, value, ok := strings.Cut(f, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("%q: expected <name>=<value>", f)
+		}
+		if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("%q: invalid label name %q", f, name)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("%q: label %q is already used by the binpacking metrics", f, name)
+		}
+		if _, dup := constLabels[name]; dup {
+			return nil, fmt.Errorf("%q: duplicate label %q", f, name)
+		}
+		constLabels[name] = value
+	}
+	return constLabels, nil
+}
+
+// parseSelectorGroups parses --group-selector flags of the form
+// <name>=<selector>. The selector is split off at the first "=", so it may
+// itself contain equality requirements.
+func parseSelectorGroups(flags []string) ([]SelectorGroup, error) {
+	var groups []SelectorGroup
+	names := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		name, selector, ok := strings.Cut(f, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q: expected <name>=<selector>", f)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("%q: duplicate group name %q", f, name)
+		}
+		names[name] = true
+
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid selector: %w", f, err)
+		}
+		groups = append(groups, SelectorGroup{Name: name, Selector: sel})
+	}
+	return groups, nil
+}
+
+// parseHeadroomTargets parses --headroom-target flags of the form
+// <label-keys>:<resource>=<quantity>[,<resource>=<quantity>...]. The label
+// keys must match a configured --label-group exactly.
+func parseHeadroomTargets(flags []string, labelGroups [][]string) (HeadroomTargets, error) {
+	known := make(map[string]bool, len(labelGroups))
+	for _, g := range labelGroups {
+		known[strings.Join(g, ",")] = true
+	}
+
+	targets := make(HeadroomTargets)
+	for _, f := range flags {
+		keysPart, resourcesPart, ok := strings.Cut(f, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q: expected <label-keys>:<resource>=<quantity>", f)
+		}
+		keys := parseLabelGroups([]string{keysPart})
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%q: missing label keys", f)
+		}
+		groupKey := strings.Join(keys[0], ",")
+		if !known[groupKey] {
+			return nil, fmt.Errorf("%q: label group %q is not configured via --label-group", f, groupKey)
+		}
+
+		if targets[groupKey] == nil {
+			targets[groupKey] = make(map[corev1.ResourceName]float64)
+		}
+		for _, pair := range strings.Split(resourcesPart, ",") {
+			res, qtyStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || res == "" {
+				return nil, fmt.Errorf("%q: expected <resource>=<quantity>, got %q", f, pair)
+			}
+			qty, err := resource.ParseQuantity(qtyStr)
+			if err != nil {
+				return nil, fmt.Errorf("%q: invalid quantity for %s: %w", f, res, err)
+			}
+			targets[groupKey][corev1.ResourceName(res)] = qty.AsApproximateFloat64()
+		}
+	}
+	return targets, nil
+}
+
+// informerStatus is the /sync representation of one informer's freshness.
+type informerStatus struct {
+	LastEvent            *time.Time `json:"last_event"`
+	LastEventAgeSeconds  *float64   `json:"last_event_age_seconds"`
+	LastResync           *time.Time `json:"last_resync"`
+	LastResyncAgeSeconds *float64   `json:"last_resync_age_seconds"`
+	WatchReconnects      int64      `json:"watch_reconnects"`
+}
+
+// syncStatus is the /sync response body.
+type syncStatus struct {
+	LastSync       time.Time                 `json:"last_sync"`
+	SyncAgeSeconds float64                   `json:"sync_age_seconds"`
+	ResyncPeriod   string                    `json:"resync_period"`
+	NodeSynced     bool                      `json:"node_synced"`
+	PodSynced      bool                      `json:"pod_synced"`
+	Informers      map[string]informerStatus `json:"informers,omitempty"`
+}
+
+// syncHandler serves informer sync and freshness state as JSON.
+// sync_age_seconds is the cache age (see SyncInfo.CacheAge); last_sync is the
+// initial sync time. Timestamps an informer has not seen yet are null.
+func syncHandler(syncInfo *SyncInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		status := newSyncStatus(syncInfo, time.Now())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(status)
+	}
+}
+
+// newSyncStatus builds the /sync response body for syncInfo at now.
+func newSyncStatus(syncInfo *SyncInfo, now time.Time) syncStatus {
+	status := syncStatus{
+		LastSync:       syncInfo.LastSyncTime.Truncate(time.Second),
+		SyncAgeSeconds: math.Round(syncInfo.CacheAge(now).Seconds()),
+		ResyncPeriod:   syncInfo.ResyncPeriod.String(),
+		NodeSynced:     syncInfo.NodeSynced(),
+		PodSynced:      syncInfo.PodSynced(),
+	}
+	for kind, f := range syncInfo.Informers() {
+		if status.Informers == nil {
+			status.Informers = make(map[string]informerStatus)
+		}
+		status.Informers[kind] = informerStatus{
+			LastEvent:            optionalTime(f.LastEvent()),
+			LastEventAgeSeconds:  optionalAge(now, f.LastEvent()),
+			LastResync:           optionalTime(f.LastResync()),
+			LastResyncAgeSeconds: optionalAge(now, f.LastResync()),
+			WatchReconnects:      f.WatchReconnects(),
+		}
+	}
+	return status
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.Truncate(time.Second)
+	return &t
+}
+
+func optionalAge(now, t time.Time) *float64 {
+	if t.IsZero() {
+		return nil
+	}
+	age := math.Round(now.Sub(t).Seconds())
+	return &age
+}
+
+// readinessChecker reports why the exporter is not ready, or "" if it is.
+type readinessChecker interface {
+	notReadyReason(now time.Time) string
+}
+
+// readyHandler serves the readiness probe, reporting the reason when not ready.
+func readyHandler(check readinessChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if reason := check.notReadyReason(time.Now()); reason != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintln(w, "not ready: "+reason)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "ready")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -190,23 +191,53 @@ func TestHealthEndpoint(t *testing.T) {
 
 // TestReadyEndpoint tests the /readyz readiness probe.
 func TestReadyEndpoint(t *testing.T) {
+	leader, standby := new(atomic.Bool), new(atomic.Bool)
+	leader.Store(true)
+
+	freshSync := &SyncInfo{LastSyncTime: time.Now()}
+	staleSync := &SyncInfo{LastSyncTime: time.Now().Add(-10 * time.Minute)}
+
 	tests := []struct {
 		name             string
-		ready            bool
+		check            readinessCheck
 		wantStatus       int
 		wantBodyContains string
 	}{
 		{
 			name:             "ready",
-			ready:            true,
+			check:            readinessCheck{synced: func() bool { return true }, syncInfo: freshSync},
 			wantStatus:       http.StatusOK,
 			wantBodyContains: "ready",
 		},
 		{
 			name:             "not ready",
-			ready:            false,
+			check:            readinessCheck{synced: func() bool { return false }, syncInfo: freshSync},
+			wantStatus:       http.StatusServiceUnavailable,
+			wantBodyContains: "not ready: informer cache not synced",
+		},
+		{
+			name:             "stale cache",
+			check:            readinessCheck{synced: func() bool { return true }, syncInfo: staleSync, staleThreshold: 5 * time.Minute},
+			wantStatus:       http.StatusServiceUnavailable,
+			wantBodyContains: "not ready: informer cache stale",
+		},
+		{
+			name:             "stale cache without threshold",
+			check:            readinessCheck{synced: func() bool { return true }, syncInfo: staleSync},
+			wantStatus:       http.StatusOK,
+			wantBodyContains: "ready",
+		},
+		{
+			name:             "leadership required and held",
+			check:            readinessCheck{synced: func() bool { return true }, syncInfo: freshSync, isLeader: leader},
+			wantStatus:       http.StatusOK,
+			wantBodyContains: "ready",
+		},
+		{
+			name:             "leadership required but not held",
+			check:            readinessCheck{synced: func() bool { return true }, syncInfo: freshSync, isLeader: standby},
 			wantStatus:       http.StatusServiceUnavailable,
-			wantBodyContains: "not ready",
+			wantBodyContains: "not ready: not the leader",
 		},
 	}
 
@@ -215,19 +246,7 @@ func TestReadyEndpoint(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 			w := httptest.NewRecorder()
 
-			// Create handler with readyChecker
-			readyChecker := func() bool { return tt.ready }
-			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-				if readyChecker() {
-					w.WriteHeader(http.StatusOK)
-					_, _ = io.WriteString(w, "ready\n")
-				} else {
-					w.WriteHeader(http.StatusServiceUnavailable)
-					_, _ = io.WriteString(w, "not ready: informer cache not synced\n")
-				}
-			})
-
-			handler.ServeHTTP(w, req)
+			readyHandler(tt.check).ServeHTTP(w, req)
 
 			resp := w.Result()
 			defer func() { _ = resp.Body.Close() }()
@@ -255,21 +274,15 @@ func TestSyncEndpoint(t *testing.T) {
 		PodSynced:    func() bool { return true },
 	}
 
+	podFreshness := &InformerFreshness{}
+	podFreshness.lastEvent.Store(time.Now().Add(-10 * time.Second).UnixNano())
+	podFreshness.watchStarts.Store(3)
+	syncInfo.NodeFreshness = &InformerFreshness{}
+	syncInfo.PodFreshness = podFreshness
+
 	req := httptest.NewRequest(http.MethodGet, "/sync", nil)
 	w := httptest.NewRecorder()
-
-	// Create handler like in main.go
-	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = io.WriteString(w, "{\n")
-		_, _ = io.WriteString(w, `  "last_sync": "`+syncInfo.LastSyncTime.Format(time.RFC3339)+`",`+"\n")
-		_, _ = io.WriteString(w, "  \"sync_age_seconds\": "+strings.TrimSpace(strings.Split(time.Since(syncInfo.LastSyncTime).String(), ".")[0])+",\n")
-		_, _ = io.WriteString(w, `  "resync_period": "`+syncInfo.ResyncPeriod.String()+`",`+"\n")
-		_, _ = io.WriteString(w, "  \"node_synced\": true,\n")
-		_, _ = io.WriteString(w, "  \"pod_synced\": true\n")
-		_, _ = io.WriteString(w, "}")
-	})
+	handler := syncHandler(syncInfo)
 
 	handler.ServeHTTP(w, req)
 
@@ -308,6 +321,34 @@ func TestSyncEndpoint(t *testing.T) {
 	if podSynced, ok := syncResp["pod_synced"].(bool); !ok || !podSynced {
 		t.Errorf("/sync pod_synced = %v, want true", syncResp["pod_synced"])
 	}
+
+	// The node informer has seen nothing since the initial sync 30s ago, so
+	// it determines the cache age.
+	if age, ok := syncResp["sync_age_seconds"].(float64); !ok || age != 30 {
+		t.Errorf("/sync sync_age_seconds = %v, want 30", syncResp["sync_age_seconds"])
+	}
+
+	informers, ok := syncResp["informers"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("/sync informers = %v, want object", syncResp["informers"])
+	}
+	pod, ok := informers["pod"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("/sync informers.pod = %v, want object", informers["pod"])
+	}
+	if age, ok := pod["last_event_age_seconds"].(float64); !ok || age != 10 {
+		t.Errorf("/sync informers.pod.last_event_age_seconds = %v, want 10", pod["last_event_age_seconds"])
+	}
+	if reconnects, ok := pod["watch_reconnects"].(float64); !ok || reconnects != 2 {
+		t.Errorf("/sync informers.pod.watch_reconnects = %v, want 2", pod["watch_reconnects"])
+	}
+	node, ok := informers["node"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("/sync informers.node = %v, want object", informers["node"])
+	}
+	if node["last_event"] != nil || node["last_resync"] != nil {
+		t.Errorf("/sync informers.node timestamps = %v, %v, want null", node["last_event"], node["last_resync"])
+	}
 }
 
 // TestNodeSelectorValidation tests that labels.Parse() accepts valid selectors
@@ -340,3 +381,127 @@ func TestNodeSelectorValidation(t *testing.T) {
 		})
 	}
 }
+
+// TestParseSelectorGroups tests parsing of --group-selector flags.
+func TestParseSelectorGroups(t *testing.T) {
+	groups, err := parseSelectorGroups([]string{"general=pool in (a,b),!gpu", " batch = workload=batch"})
+	if err != nil {
+		t.Fatalf("parseSelectorGroups() error = %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("parseSelectorGroups() = %d groups, want 2", len(groups))
+	}
+	if groups[0].Name != "general" || !groups[0].Selector.Matches(labels.Set{"pool": "a"}) || groups[0].Selector.Matches(labels.Set{"pool": "a", "gpu": "true"}) {
+		t.Errorf("general group = %v %v, want pool in (a,b),!gpu", groups[0].Name, groups[0].Selector)
+	}
+	if groups[1].Name != "batch" || !groups[1].Selector.Matches(labels.Set{"workload": "batch"}) {
+		t.Errorf("batch group = %v %v, want workload=batch", groups[1].Name, groups[1].Selector)
+	}
+
+	for _, bad := range [][]string{
+		{"general"},
+		{"=pool=a"},
+		{"general=pool in ("},
+		{"general=pool=a", "general=pool=b"},
+	} {
+		if _, err := parseSelectorGroups(bad); err == nil {
+			t.Errorf("parseSelectorGroups(%q) should fail", bad)
+		}
+	}
+}
+
+// TestParseConstLabels tests parsing of --const-label flags.
+func TestParseConstLabels(t *testing.T) {
+	got, err := parseConstLabels([]string{"cluster=prod-eu1", "env=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("parseConstLabels() error = %v", err)
+	}
+	want := map[string]string{"cluster": "prod-eu1", "env": "a=b", "empty": ""}
+	if len(got) != len(want) {
+		t.Fatalf("parseConstLabels() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("label %q = %q, want %q", k, got[k], v)
+		}
+	}
+
+	for _, bad := range [][]string{
+		{"cluster"},
+		{"1cluster=a"},
+		{"__name__=a"},
+		{"resource=a"},
+		{"node=a"},
+		{"cluster=a", "cluster=b"},
+	} {
+		if _, err := parseConstLabels(bad); err == nil {
+			t.Errorf("parseConstLabels(%q) should fail", bad)
+		}
+	}
+}
+
+// TestParseHeadroomTargets tests parsing of --headroom-target flags.
+func TestParseHeadroomTargets(t *testing.T) {
+	labelGroups := [][]string{
+		{"topology.kubernetes.io/zone"},
+		{"topology.kubernetes.io/zone", "node.kubernetes.io/instance-type"},
+	}
+
+	tests := []struct {
+		name    string
+		input   []string
+		want    HeadroomTargets
+		wantErr bool
+	}{
+		{
+			name:  "single resource",
+			input: []string{"topology.kubernetes.io/zone:cpu=8"},
+			want: HeadroomTargets{
+				"topology.kubernetes.io/zone": {corev1.ResourceCPU: 8},
+			},
+		},
+		{
+			name:  "multiple resources and composite group",
+			input: []string{"topology.kubernetes.io/zone, node.kubernetes.io/instance-type:cpu=500m,memory=1Gi,nvidia.com/gpu=1"},
+			want: HeadroomTargets{
+				"topology.kubernetes.io/zone,node.kubernetes.io/instance-type": {
+					corev1.ResourceCPU:    0.5,
+					corev1.ResourceMemory: 1024 * 1024 * 1024,
+					"nvidia.com/gpu":      1,
+				},
+			},
+		},
+		{
+			name:  "none",
+			input: nil,
+			want:  HeadroomTargets{},
+		},
+		{name: "unknown label group", input: []string{"zone:cpu=1"}, wantErr: true},
+		{name: "missing separator", input: []string{"topology.kubernetes.io/zone"}, wantErr: true},
+		{name: "missing keys", input: []string{" :cpu=1"}, wantErr: true},
+		{name: "invalid quantity", input: []string{"topology.kubernetes.io/zone:cpu=lots"}, wantErr: true},
+		{name: "missing quantity", input: []string{"topology.kubernetes.io/zone:cpu"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHeadroomTargets(tt.input, labelGroups)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHeadroomTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseHeadroomTargets() = %v, want %v", got, tt.want)
+			}
+			for group, resources := range tt.want {
+				for res, want := range resources {
+					if !floatEquals(got[group][res], want) {
+						t.Errorf("target[%q][%q] = %v, want %v", group, res, got[group][res], want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// clusterLabel is the constant label naming each cluster's binpacking metrics
+// in multi-cluster mode.
+const clusterLabel = "cluster"
+
+// defaultClusterRetryInterval is how long to wait before reconnecting to a
+// cluster whose setup failed.
+const defaultClusterRetryInterval = 30 * time.Second
+
+// ClusterConfig is one cluster watched in multi-cluster mode.
+type ClusterConfig struct {
+	Name       string // cluster label value
+	Kubeconfig string // empty = --kubeconfig or the default loading rules
+	Context    string // empty = the kubeconfig's current context
+}
+
+// parseClusters parses --cluster flags of the form
+// <name>=[<kubeconfig>][#<context>]. A cluster without a kubeconfig uses
+// defaultKubeconfig (--kubeconfig).
+func parseClusters(flags []string, defaultKubeconfig string) ([]ClusterConfig, error) {
+	var clusters []ClusterConfig
+	names := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		name, source, ok := strings.Cut(f, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q: expected <name>=[<kubeconfig>][#<context>]", f)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("%q: duplicate cluster name %q", f, name)
+		}
+		names[name] = true
+
+		kubeconfig, kubeContext, _ := strings.Cut(source, "#")
+		kubeconfig = strings.TrimSpace(kubeconfig)
+		if kubeconfig == "" {
+			kubeconfig = defaultKubeconfig
+		}
+		clusters = append(clusters, ClusterConfig{Name: name, Kubeconfig: kubeconfig, Context: strings.TrimSpace(kubeContext)})
+	}
+	return clusters, nil
+}
+
+// clusterConn is a connected cluster: its synced informers and the
+// collector reading them.
+type clusterConn struct {
+	nodes     *NodeSource
+	synced    ReadyChecker
+	syncInfo  *SyncInfo
+	collector *BinpackingCollector
+}
+
+// Apply swaps in new collector settings, restarting the node informer first
+// if the node selector or the node fields the label groups need changed.
+func (c *clusterConn) Apply(ctx context.Context, selector string, settings CollectorSettings) error {
+	fields := nodeFieldsFor(settings.LabelGroups)
+	if selector != c.nodes.Selector() || !fields.Equal(c.nodes.Fields()) {
+		if err := c.nodes.Restart(ctx, selector, fields); err != nil {
+			return err
+		}
+	}
+	c.collector.Reconfigure(settings)
+	return nil
+}
+
+// clusterConnectFunc sets up the informers and collector for one cluster.
+// Everything it starts must stop when ctx is cancelled, which happens when it
+// returns an error.
+type clusterConnectFunc func(ctx context.Context, cluster ClusterConfig, selector string, settings CollectorSettings) (*clusterConn, error)
+
+// ClusterSet watches several clusters from one exporter. Each cluster
+// connects, and reconnects after a failure, independently, so an unreachable
+// cluster never blocks the others; its collector is registered once its
+// informers have synced.
+type ClusterSet struct {
+	connect       clusterConnectFunc
+	registry      prometheus.Registerer
+	retryInterval time.Duration
+	logger        *slog.Logger
+
+	// mu guards the desired selector and settings. It is never held while
+	// settings are applied, since an informer restart can take minutes;
+	// instead generation counts changes, so a cluster that applied settings
+	// while they changed applies them again before registering.
+	mu         sync.Mutex
+	selector   string
+	settings   CollectorSettings
+	generation uint64
+
+	applyMu sync.Mutex // serializes Apply calls
+
+	clusters []*clusterState
+}
+
+// clusterState is one cluster's connection progress.
+type clusterState struct {
+	config ClusterConfig
+
+	mu       sync.RWMutex
+	conn     *clusterConn
+	attempts int
+	lastErr  error
+}
+
+// NewClusterSet returns a ClusterSet for clusters, registering each cluster's
+// collector on registry once connected. Run starts connecting.
+func NewClusterSet(clusters []ClusterConfig, connect clusterConnectFunc, registry prometheus.Registerer, selector string, settings CollectorSettings, logger *slog.Logger) *ClusterSet {
+	s := &ClusterSet{
+		connect:       connect,
+		registry:      registry,
+		retryInterval: defaultClusterRetryInterval,
+		logger:        logger,
+		selector:      selector,
+		settings:      settings,
+	}
+	for _, c := range clusters {
+		s.clusters = append(s.clusters, &clusterState{config: c})
+	}
+	return s
+}
+
+// Run connects to every cluster concurrently, retrying failed clusters every
+// retry interval, and returns once ctx is done and every cluster's informers
+// are stopping.
+func (s *ClusterSet) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range s.clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runCluster(ctx, c)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *ClusterSet) runCluster(ctx context.Context, c *clusterState) {
+	logger := s.logger.With("cluster", c.config.Name)
+	for {
+		s.mu.Lock()
+		selector, settings := s.selector, s.settings
+		s.mu.Unlock()
+
+		// Cancelling connCtx stops the informers of a failed attempt, or of
+		// the connected cluster on shutdown.
+		connCtx, cancel := context.WithCancel(ctx)
+		err := s.connectOnce(connCtx, c, selector, settings)
+		if err == nil {
+			logger.Info("cluster connected")
+			<-ctx.Done()
+			cancel()
+			return
+		}
+		cancel()
+
+		c.mu.Lock()
+		c.attempts++
+		c.lastErr = err
+		c.mu.Unlock()
+		logger.Error("cluster connection failed, retrying", "error", err, "retry_in", s.retryInterval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.retryInterval):
+		}
+	}
+}
+
+// connectOnce connects to the cluster and registers it.
+func (s *ClusterSet) connectOnce(ctx context.Context, c *clusterState, selector string, settings CollectorSettings) error {
+	conn, err := s.connect(ctx, c.config, selector, settings)
+	if err != nil {
+		return err
+	}
+	return s.register(ctx, c, conn)
+}
+
+// register applies settings changed while the cluster was connecting, or
+// while they were being applied, and registers its collector.
+func (s *ClusterSet) register(ctx context.Context, c *clusterState, conn *clusterConn) error {
+	for {
+		s.mu.Lock()
+		selector, settings, generation := s.selector, s.settings, s.generation
+		s.mu.Unlock()
+
+		if err := conn.Apply(ctx, selector, settings); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		if s.generation != generation {
+			s.mu.Unlock()
+			continue
+		}
+		// Still holding s.mu: a concurrent Apply either sees the
+		// connection or has not yet changed the settings just applied.
+		if err := s.registry.Register(conn.collector); err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("registering collector: %w", err)
+		}
+		c.mu.Lock()
+		c.conn = conn
+		c.attempts++
+		c.lastErr = nil
+		c.mu.Unlock()
+		s.mu.Unlock()
+		return nil
+	}
+}
+
+// Apply changes the node selector and collector settings of every connected
+// cluster, and of those that connect later. Errors are joined per cluster; a
+// failing cluster does not stop the others from being updated.
+func (s *ClusterSet) Apply(ctx context.Context, selector string, settings CollectorSettings) error {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	s.mu.Lock()
+	s.selector, s.settings = selector, settings
+	s.generation++
+	var connected []*clusterState
+	for _, c := range s.clusters {
+		if c.connection() != nil {
+			connected = append(connected, c)
+		}
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, c := range connected {
+		if err := c.connection().Apply(ctx, selector, settings); err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", c.config.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Settings returns the desired node selector and collector settings.
+func (s *ClusterSet) Settings() (string, CollectorSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selector, s.settings
+}
+
+// Names returns the configured cluster names in order.
+func (s *ClusterSet) Names() []string {
+	names := make([]string, len(s.clusters))
+	for i, c := range s.clusters {
+		names[i] = c.config.Name
+	}
+	return names
+}
+
+func (c *clusterState) connection() *clusterConn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+func (c *clusterState) attemptCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.attempts
+}
+
+// clusterReadiness is the /readyz check in multi-cluster mode: ready while at
+// least one cluster is connected and passes the single-cluster check.
+type clusterReadiness struct {
+	set            *ClusterSet
+	staleThreshold time.Duration
+}
+
+// notReadyReason returns why no cluster is ready, listing each cluster's
+// reason, or "" if one is.
+func (r clusterReadiness) notReadyReason(now time.Time) string {
+	reasons := make([]string, 0, len(r.set.clusters))
+	for _, c := range r.set.clusters {
+		reason := "not connected"
+		if conn := c.connection(); conn != nil {
+			check := readinessCheck{synced: conn.synced, syncInfo: conn.syncInfo, staleThreshold: r.staleThreshold}
+			if reason = check.notReadyReason(now); reason == "" {
+				return ""
+			}
+		}
+		reasons = append(reasons, c.config.Name+": "+reason)
+	}
+	return "no cluster ready (" + strings.Join(reasons, "; ") + ")"
+}
+
+// clusterStatus is one cluster's entry in the multi-cluster /sync response.
+type clusterStatus struct {
+	Connected bool        `json:"connected"`
+	Ready     bool        `json:"ready"`
+	Reason    string      `json:"reason,omitempty"`
+	Attempts  int         `json:"connect_attempts"`
+	LastError string      `json:"last_error,omitempty"`
+	Sync      *syncStatus `json:"sync,omitempty"`
+}
+
+// clusterSyncHandler serves each cluster's connection, readiness and, once
+// connected, sync state (as served by syncHandler) as JSON keyed by cluster
+// name.
+func clusterSyncHandler(set *ClusterSet, staleThreshold time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		now := time.Now()
+		clusters := make(map[string]clusterStatus, len(set.clusters))
+		for _, c := range set.clusters {
+			c.mu.RLock()
+			conn, attempts, lastErr := c.conn, c.attempts, c.lastErr
+			c.mu.RUnlock()
+
+			status := clusterStatus{Attempts: attempts, Reason: "not connected"}
+			if lastErr != nil {
+				status.LastError = lastErr.Error()
+			}
+			if conn != nil {
+				syncStatus := newSyncStatus(conn.syncInfo, now)
+				status.Connected = true
+				status.Sync = &syncStatus
+				status.Reason = readinessCheck{synced: conn.synced, syncInfo: conn.syncInfo, staleThreshold: staleThreshold}.notReadyReason(now)
+			}
+			status.Ready = status.Reason == ""
+			clusters[c.config.Name] = status
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(map[string]map[string]clusterStatus{"clusters": clusters})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestParseClusters(t *testing.T) {
+	got, err := parseClusters([]string{
+		"prod=#prod-admin",
+		"dev=/etc/kube/dev.yaml",
+		"staging=/etc/kube/all.yaml#kubernetes-admin@staging",
+		"local=",
+	}, "/etc/kube/default.yaml")
+	if err != nil {
+		t.Fatalf("parseClusters() error = %v", err)
+	}
+	want := []ClusterConfig{
+		{Name: "prod", Kubeconfig: "/etc/kube/default.yaml", Context: "prod-admin"},
+		{Name: "dev", Kubeconfig: "/etc/kube/dev.yaml"},
+		{Name: "staging", Kubeconfig: "/etc/kube/all.yaml", Context: "kubernetes-admin@staging"},
+		{Name: "local", Kubeconfig: "/etc/kube/default.yaml"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseClusters() = %+v, want %+v", got, want)
+	}
+
+	for _, flags := range [][]string{{"prod"}, {"=#ctx"}, {"a=#x", "a=#y"}} {
+		if _, err := parseClusters(flags, ""); err == nil {
+			t.Errorf("parseClusters(%q) should fail", flags)
+		}
+	}
+}
+
+// newTestClusterConn connects a fake cluster with one node labelled with the
+// cluster name.
+func newTestClusterConn(ctx context.Context, cluster ClusterConfig, selector string, settings CollectorSettings) (*clusterConn, error) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	node := makeNode(cluster.Name+"-node", "4", "8Gi")
+	node.Labels = map[string]string{"cluster-name": cluster.Name}
+	nodes, err := newNodeSource(ctx, fake.NewClientset(node), 0, 0, selector, nodeFieldsFor(settings.LabelGroups), &InformerFreshness{}, nil, logger)
+	if err != nil {
+		return nil, err
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), nodes.HasSynced) {
+		return nil, errors.New("node informer did not sync")
+	}
+	syncInfo := &SyncInfo{
+		LastSyncTime: time.Now(),
+		NodeSynced:   nodes.HasSynced,
+		PodSynced:    func() bool { return true },
+	}
+	collector := NewBinpackingCollector(nodes, &fakePodLister{}, logger, nil, nil, false, syncInfo, nil,
+		WithMetricNamespace(defaultMetricNamespace, prometheus.Labels{clusterLabel: cluster.Name}))
+	collector.Reconfigure(settings)
+	return &clusterConn{nodes: nodes, synced: nodes.HasSynced, syncInfo: syncInfo, collector: collector}, nil
+}
+
+// TestClusterSet verifies an unreachable cluster does not block the others:
+// connected clusters are collected with their cluster label, readiness holds
+// while one cluster is ready, and /sync reports each cluster separately.
+func TestClusterSet(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	connect := func(ctx context.Context, cluster ClusterConfig, selector string, settings CollectorSettings) (*clusterConn, error) {
+		if cluster.Name == "down" {
+			return nil, errors.New("connection refused")
+		}
+		return newTestClusterConn(ctx, cluster, selector, settings)
+	}
+	registry := prometheus.NewRegistry()
+	settings := CollectorSettings{Resources: []corev1.ResourceName{corev1.ResourceCPU}}
+	set := NewClusterSet([]ClusterConfig{{Name: "up"}, {Name: "down"}}, connect, registry, "", settings, logger)
+	set.retryInterval = 10 * time.Millisecond
+
+	readiness := clusterReadiness{set: set}
+	if reason := readiness.notReadyReason(time.Now()); !strings.Contains(reason, "up: not connected") {
+		t.Errorf("notReadyReason() before connecting = %q, want up: not connected", reason)
+	}
+
+	go set.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for readiness.notReadyReason(time.Now()) != "" || set.clusters[1].attemptCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("cluster up did not become ready: %s", readiness.notReadyReason(time.Now()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	found := false
+	for _, mf := range families {
+		if mf.GetName() != "kube_binpacking_cluster_node_count" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == clusterLabel {
+					if lp.GetValue() != "up" {
+						t.Errorf("cluster label = %q, want up", lp.GetValue())
+					}
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("cluster_node_count with a cluster label should be gathered for the connected cluster")
+	}
+
+	// A reload reaches connected clusters.
+	group := newLabelGroup("cluster-name")
+	if err := set.Apply(ctx, "cluster-name=up", CollectorSettings{Resources: settings.Resources, LabelGroups: []LabelGroup{group}}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if selector, current := set.Settings(); selector != "cluster-name=up" || len(current.LabelGroups) != 1 {
+		t.Errorf("Settings() = %q, %+v, want the applied settings", selector, current)
+	}
+	conn := set.clusters[0].connection()
+	if conn.nodes.Selector() != "cluster-name=up" || len(conn.collector.Settings().LabelGroups) != 1 {
+		t.Error("Apply() should reconfigure the connected cluster")
+	}
+
+	w := httptest.NewRecorder()
+	clusterSyncHandler(set, 0).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sync", nil))
+	var body struct {
+		Clusters map[string]clusterStatus `json:"clusters"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding /sync: %v", err)
+	}
+	up, down := body.Clusters["up"], body.Clusters["down"]
+	if !up.Connected || !up.Ready || up.Sync == nil || !up.Sync.NodeSynced {
+		t.Errorf("/sync up = %+v, want connected, ready and synced", up)
+	}
+	if down.Connected || down.Ready || down.Sync != nil || down.LastError != "connection refused" || down.Attempts == 0 {
+		t.Errorf("/sync down = %+v, want disconnected with the last error", down)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Label group keys starting with pseudoKeyPrefix refer to node fields rather
+// than labels, e.g. @kubeletVersion or @annotation:example.com/owner.
+const (
+	pseudoKeyPrefix     = "@"
+	annotationKeyPrefix = "@annotation:"
+)
+
+// nodeInfoKeys are the pseudo-keys read from status.nodeInfo.
+var nodeInfoKeys = map[string]func(corev1.NodeSystemInfo) string{
+	"@kubeletVersion":   func(i corev1.NodeSystemInfo) string { return i.KubeletVersion },
+	"@containerRuntime": func(i corev1.NodeSystemInfo) string { return i.ContainerRuntimeVersion },
+	"@osImage":          func(i corev1.NodeSystemInfo) string { return i.OSImage },
+	"@kernelVersion":    func(i corev1.NodeSystemInfo) string { return i.KernelVersion },
+	"@architecture":     func(i corev1.NodeSystemInfo) string { return i.Architecture },
+}
+
+// Pseudo-keys read from other node fields.
+const (
+	providerIDKey       = "@providerID"
+	providerIDPrefixKey = "@providerIDPrefix"
+	ageBucketKey        = "@ageBucket"
+)
+
+// ageBuckets are the @ageBucket values, by the node age they end at.
+var ageBuckets = []struct {
+	below time.Duration
+	name  string
+}{
+	{time.Hour, "0-1h"},
+	{24 * time.Hour, "1h-1d"},
+	{7 * 24 * time.Hour, "1d-7d"},
+	{30 * 24 * time.Hour, "7d-30d"},
+}
+
+// ageBucket returns the @ageBucket value for a node of the given age.
+func ageBucket(age time.Duration) string {
+	for _, b := range ageBuckets {
+		if age < b.below {
+			return b.name
+		}
+	}
+	return "30d+"
+}
+
+// validateGroupKey rejects unknown pseudo-keys. Any other key is a label.
+func validateGroupKey(key string) error {
+	if !strings.HasPrefix(key, pseudoKeyPrefix) {
+		return nil
+	}
+	if _, ok := nodeInfoKeys[key]; ok {
+		return nil
+	}
+	switch key {
+	case providerIDKey, providerIDPrefixKey, ageBucketKey:
+		return nil
+	}
+	if name, ok := strings.CutPrefix(key, annotationKeyPrefix); ok && name != "" {
+		return nil
+	}
+	return fmt.Errorf("unknown node field %q", key)
+}
+
+// nodeKeyValue returns a node's value for a label group key: the label value,
+// or the node field for a pseudo-key. ok is false if the value is missing.
+func nodeKeyValue(node *corev1.Node, key string, now time.Time) (value string, ok bool) {
+	if !strings.HasPrefix(key, pseudoKeyPrefix) {
+		value, ok = node.Labels[key]
+		return value, ok
+	}
+	if field, isInfo := nodeInfoKeys[key]; isInfo {
+		value = field(node.Status.NodeInfo)
+		return value, value != ""
+	}
+	switch key {
+	case providerIDKey:
+		value = node.Spec.ProviderID
+	case providerIDPrefixKey:
+		value, _, _ = strings.Cut(node.Spec.ProviderID, "://")
+	case ageBucketKey:
+		if !node.CreationTimestamp.IsZero() {
+			value = ageBucket(now.Sub(node.CreationTimestamp.Time))
+		}
+	default:
+		if name, isAnnotation := strings.CutPrefix(key, annotationKeyPrefix); isAnnotation {
+			value, ok = node.Annotations[name]
+			return value, ok
+		}
+	}
+	return value, value != ""
+}
+
+// NodeFields are the node fields the informer cache keeps, beyond the name,
+// labels and allocatable, because a label group references them.
+type NodeFields struct {
+	NodeInfo          bool
+	ProviderID        bool
+	CreationTimestamp bool
+	Annotations       []string // sorted
+}
+
+// nodeFieldsFor returns the node fields referenced by groups' keys.
+func nodeFieldsFor(groups []LabelGroup) NodeFields {
+	var f NodeFields
+	for _, group := range groups {
+		for _, key := range group.Keys {
+			if _, ok := nodeInfoKeys[key]; ok {
+				f.NodeInfo = true
+				continue
+			}
+			switch key {
+			case providerIDKey, providerIDPrefixKey:
+				f.ProviderID = true
+			case ageBucketKey:
+				f.CreationTimestamp = true
+			default:
+				if name, ok := strings.CutPrefix(key, annotationKeyPrefix); ok && !slices.Contains(f.Annotations, name) {
+					f.Annotations = append(f.Annotations, name)
+				}
+			}
+		}
+	}
+	sort.Strings(f.Annotations)
+	return f
+}
+
+// Equal reports whether f and o keep the same fields.
+func (f NodeFields) Equal(o NodeFields) bool {
+	return f.NodeInfo == o.NodeInfo &&
+		f.ProviderID == o.ProviderID &&
+		f.CreationTimestamp == o.CreationTimestamp &&
+		slices.Equal(f.Annotations, o.Annotations)
+}
+
+// transform is a cache.TransformFunc like stripUnusedFields that also keeps
+// the node fields in f.
+func (f NodeFields) transform(obj interface{}) (interface{}, error) {
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return stripUnusedFields(obj)
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:            node.Name,
+		ResourceVersion: node.ResourceVersion,
+		Labels:          node.Labels,
+	}
+	if f.CreationTimestamp {
+		meta.CreationTimestamp = node.CreationTimestamp
+	}
+	for _, name := range f.Annotations {
+		if v, ok := node.Annotations[name]; ok {
+			if meta.Annotations == nil {
+				meta.Annotations = make(map[string]string, len(f.Annotations))
+			}
+			meta.Annotations[name] = v
+		}
+	}
+	node.ObjectMeta = meta
+
+	status := corev1.NodeStatus{Allocatable: node.Status.Allocatable}
+	if f.NodeInfo {
+		status.NodeInfo = node.Status.NodeInfo
+	}
+	node.Status = status
+
+	spec := corev1.NodeSpec{}
+	if f.ProviderID {
+		spec.ProviderID = node.Spec.ProviderID
+	}
+	node.Spec = spec
+	return node, nil
+}
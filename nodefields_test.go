@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func makeNodeWithFields(created time.Time) *corev1.Node {
+	node := makeNode("node-1", "4", "8Gi")
+	node.Labels = map[string]string{"zone": "a"}
+	node.Annotations = map[string]string{"example.com/owner": "team-a", "example.com/other": "x"}
+	node.CreationTimestamp = metav1.NewTime(created)
+	node.Spec.ProviderID = "aws:///us-east-1a/i-0123456789abcdef0"
+	node.Status.NodeInfo = corev1.NodeSystemInfo{
+		KubeletVersion:          "v1.31.2",
+		ContainerRuntimeVersion: "containerd://1.7.22",
+		OSImage:                 "Bottlerocket OS 1.26.1",
+		KernelVersion:           "6.1.112",
+		Architecture:            "arm64",
+	}
+	return node
+}
+
+// TestNodeKeyValue tests label and pseudo-key lookups.
+func TestNodeKeyValue(t *testing.T) {
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	node := makeNodeWithFields(now.Add(-3 * 24 * time.Hour))
+
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{key: "zone", want: "a", wantOK: true},
+		{key: "missing", wantOK: false},
+		{key: "@kubeletVersion", want: "v1.31.2", wantOK: true},
+		{key: "@containerRuntime", want: "containerd://1.7.22", wantOK: true},
+		{key: "@osImage", want: "Bottlerocket OS 1.26.1", wantOK: true},
+		{key: "@kernelVersion", want: "6.1.112", wantOK: true},
+		{key: "@architecture", want: "arm64", wantOK: true},
+		{key: "@providerID", want: "aws:///us-east-1a/i-0123456789abcdef0", wantOK: true},
+		{key: "@providerIDPrefix", want: "aws", wantOK: true},
+		{key: "@ageBucket", want: "1d-7d", wantOK: true},
+		{key: "@annotation:example.com/owner", want: "team-a", wantOK: true},
+		{key: "@annotation:example.com/missing", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := nodeKeyValue(node, tt.key, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("nodeKeyValue(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := nodeKeyValue(makeNode("bare", "1", "1Gi"), "@ageBucket", now); ok {
+		t.Error("@ageBucket without a creation timestamp should be missing")
+	}
+}
+
+func TestAgeBucket(t *testing.T) {
+	tests := map[time.Duration]string{
+		10 * time.Minute:     "0-1h",
+		5 * time.Hour:        "1h-1d",
+		24 * time.Hour:       "1d-7d",
+		10 * 24 * time.Hour:  "7d-30d",
+		400 * 24 * time.Hour: "30d+",
+	}
+	for age, want := range tests {
+		if got := ageBucket(age); got != want {
+			t.Errorf("ageBucket(%v) = %q, want %q", age, got, want)
+		}
+	}
+}
+
+func TestValidateGroupKey(t *testing.T) {
+	for _, key := range []string{"zone", "@kubeletVersion", "@providerIDPrefix", "@ageBucket", "@annotation:example.com/owner"} {
+		if err := validateGroupKey(key); err != nil {
+			t.Errorf("validateGroupKey(%q) error = %v", key, err)
+		}
+	}
+	for _, key := range []string{"@unknown", "@annotation:"} {
+		if err := validateGroupKey(key); err == nil {
+			t.Errorf("validateGroupKey(%q) should fail", key)
+		}
+	}
+}
+
+// TestNodeFields verifies only referenced node fields survive the informer
+// transform.
+func TestNodeFields(t *testing.T) {
+	groups := []LabelGroup{
+		newLabelGroup("zone", "@kubeletVersion"),
+		newLabelGroup("@annotation:example.com/owner", "@ageBucket"),
+		newLabelGroup("@annotation:example.com/owner"),
+	}
+	fields := nodeFieldsFor(groups)
+	want := NodeFields{NodeInfo: true, CreationTimestamp: true, Annotations: []string{"example.com/owner"}}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("nodeFieldsFor() = %+v, want %+v", fields, want)
+	}
+	if !fields.Equal(want) || fields.Equal(NodeFields{}) {
+		t.Error("Equal() mismatch")
+	}
+
+	created := time.Now().Add(-time.Hour)
+	result, err := fields.transform(makeNodeWithFields(created))
+	if err != nil {
+		t.Fatalf("transform() error = %v", err)
+	}
+	node := result.(*corev1.Node)
+	if node.Status.NodeInfo.KubeletVersion != "v1.31.2" {
+		t.Error("NodeInfo should be kept")
+	}
+	if !node.CreationTimestamp.Time.Equal(metav1.NewTime(created).Time) {
+		t.Error("CreationTimestamp should be kept")
+	}
+	if !reflect.DeepEqual(node.Annotations, map[string]string{"example.com/owner": "team-a"}) {
+		t.Errorf("Annotations = %v, want only example.com/owner", node.Annotations)
+	}
+	if node.Spec.ProviderID != "" {
+		t.Error("ProviderID should be stripped")
+	}
+	if node.Labels["zone"] != "a" || node.Status.Allocatable.Cpu().IsZero() {
+		t.Error("labels and allocatable should always be kept")
+	}
+
+	result, err = NodeFields{}.transform(makeNodeWithFields(created))
+	if err != nil {
+		t.Fatalf("transform() error = %v", err)
+	}
+	node = result.(*corev1.Node)
+	if node.Annotations != nil || !node.CreationTimestamp.IsZero() || node.Status.NodeInfo.KubeletVersion != "" {
+		t.Errorf("empty NodeFields should strip like stripUnusedFields, got %+v", node)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+// offlineObject is the part of a Kubernetes object or list needed to decide
+// how to decode it.
+type offlineObject struct {
+	Kind  string            `json:"kind"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// newFileListers returns node and pod listers backed by kubectl output
+// instead of informers, for computing binpacking without cluster access.
+// Nodes not matching nodeSelector are left out, as the node informer would.
+func newFileListers(paths []string, nodeSelector string) (listerscorev1.NodeLister, listerscorev1.PodLister, error) {
+	selector, err := labels.Parse(nodeSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid node selector: %w", err)
+	}
+
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	nodes, pods, err := loadObjectFiles(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, node := range nodes {
+		if selector.Matches(labels.Set(node.Labels)) {
+			_ = nodeIndexer.Add(node)
+		}
+	}
+	for _, pod := range pods {
+		_ = podIndexer.Add(pod)
+	}
+	return listerscorev1.NewNodeLister(nodeIndexer), listerscorev1.NewPodLister(podIndexer), nil
+}
+
+// loadObjectFiles reads nodes and pods from `kubectl get -o json` or `-o
+// yaml` output: a List (kubectl get nodes,pods), a NodeList or PodList, or a
+// single Node or Pod per file. A directory is read file by file (*.json,
+// *.yaml, *.yml, not recursively). Objects of other kinds are ignored.
+func loadObjectFiles(paths []string) ([]*corev1.Node, []*corev1.Pod, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".json", ".yaml", ".yml":
+				if !e.IsDir() {
+					files = append(files, filepath.Join(path, e.Name()))
+				}
+			}
+		}
+	}
+
+	var nodes []*corev1.Node
+	var pods []*corev1.Pod
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		// YAMLToJSON passes JSON through unchanged.
+		data, err = yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+		n, p, err := decodeObjects(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+		nodes = append(nodes, n...)
+		pods = append(pods, p...)
+	}
+	return nodes, pods, nil
+}
+
+// decodeObjects decodes one JSON object or list. Items of a NodeList or
+// PodList may omit their kind.
+func decodeObjects(data []byte) ([]*corev1.Node, []*corev1.Pod, error) {
+	var obj offlineObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, nil, err
+	}
+
+	var nodes []*corev1.Node
+	var pods []*corev1.Pod
+	decode := func(kind string, raw []byte) error {
+		switch kind {
+		case "Node":
+			node := &corev1.Node{}
+			if err := json.Unmarshal(raw, node); err != nil {
+				return err
+			}
+			nodes = append(nodes, node)
+		case "Pod":
+			pod := &corev1.Pod{}
+			if err := json.Unmarshal(raw, pod); err != nil {
+				return err
+			}
+			pods = append(pods, pod)
+		}
+		return nil
+	}
+
+	if !strings.HasSuffix(obj.Kind, "List") {
+		return nodes, pods, decode(obj.Kind, data)
+	}
+	for i, raw := range obj.Items {
+		var item offlineObject
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		kind := item.Kind
+		if kind == "" {
+			kind = strings.TrimSuffix(obj.Kind, "List")
+		}
+		if err := decode(kind, raw); err != nil {
+			return nil, nil, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	return nodes, pods, nil
+}
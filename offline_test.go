@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// writeOfflineDump writes a kubectl-style dump to dir: a mixed List as JSON
+// (kubectl get nodes,pods -o json), a NodeList as YAML whose items omit their
+// kind, and a file that is not a dump.
+func writeOfflineDump(t *testing.T, dir string) {
+	t.Helper()
+	nodeA := makeNode("node-a", "4", "8Gi")
+	nodeA.Kind = "Node"
+	nodeA.Labels = map[string]string{"pool": "general"}
+	pod := makePodWithResources("default", "app", "node-a", corev1.PodRunning,
+		[]corev1.Container{makeContainer("app", "1", "1Gi")},
+		[]corev1.Container{makeContainer("init", "2", "")})
+	pod.Kind = "Pod"
+	mixed, err := json.Marshal(map[string]any{"apiVersion": "v1", "kind": "List", "items": []any{nodeA, pod}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeB := makeNode("node-b", "8", "16Gi")
+	nodeB.Labels = map[string]string{"pool": "batch"}
+	nodeList, err := yaml.Marshal(map[string]any{"apiVersion": "v1", "kind": "NodeList", "items": []any{nodeB}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"nodes-pods.json": mixed,
+		"more-nodes.yaml": nodeList,
+		"README.txt":      []byte("not a dump"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewFileListers(t *testing.T) {
+	dir := t.TempDir()
+	writeOfflineDump(t, dir)
+
+	tests := []struct {
+		name      string
+		paths     []string
+		selector  string
+		wantNodes int
+		wantPods  int
+	}{
+		{name: "directory", paths: []string{dir}, wantNodes: 2, wantPods: 1},
+		{name: "single file", paths: []string{filepath.Join(dir, "more-nodes.yaml")}, wantNodes: 1, wantPods: 0},
+		{name: "node selector", paths: []string{dir}, selector: "pool=general", wantNodes: 1, wantPods: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeLister, podLister, err := newFileListers(tt.paths, tt.selector)
+			if err != nil {
+				t.Fatalf("newFileListers() error = %v", err)
+			}
+			nodes, _ := nodeLister.List(labels.Everything())
+			pods, _ := podLister.List(labels.Everything())
+			if len(nodes) != tt.wantNodes || len(pods) != tt.wantPods {
+				t.Errorf("got %d nodes and %d pods, want %d and %d", len(nodes), len(pods), tt.wantNodes, tt.wantPods)
+			}
+		})
+	}
+
+	if _, _, err := newFileListers([]string{filepath.Join(dir, "missing.json")}, ""); err == nil {
+		t.Error("newFileListers() with a missing file should fail")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	_ = os.WriteFile(bad, []byte(`{"kind": "List", "items": [{"kind": "Pod", "spec": 1}]}`), 0o644)
+	if _, _, err := newFileListers([]string{bad}, ""); err == nil || !strings.Contains(err.Error(), "item 0") {
+		t.Errorf("newFileListers() with a malformed pod error = %v, want an item 0 error", err)
+	}
+}
+
+// TestRunSnapshot_FromFile runs the snapshot subcommand offline and checks
+// both the report and the metrics go through the pod request calculation
+// (the init container's 2 CPU outweigh the app's 1).
+func TestRunSnapshot_FromFile(t *testing.T) {
+	dir := t.TempDir()
+	writeOfflineDump(t, dir)
+
+	var out bytes.Buffer
+	if code := runSnapshot([]string{"--from-file=" + dir, "--output=json"}, &out, io.Discard); code != 0 {
+		t.Fatalf("runSnapshot() = %d, want 0", code)
+	}
+	var report snapshotReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("decoding report: %v", err)
+	}
+	if cpu := report.Cluster.Resources["cpu"]; report.Cluster.NodeCount != 2 || cpu.Allocated != 2 || cpu.Allocatable != 12 {
+		t.Errorf("cluster = %+v, cpu = %+v, want 2 nodes, 2 of 12 CPU allocated", report.Cluster, cpu)
+	}
+
+	out.Reset()
+	if code := runSnapshot([]string{"--from-file=" + dir, "--output=prometheus"}, &out, io.Discard); code != 0 {
+		t.Fatalf("runSnapshot(--output=prometheus) = %d, want 0", code)
+	}
+	if want := `kube_binpacking_node_allocated{node="node-a",resource="cpu"} 2`; !strings.Contains(out.String(), want) {
+		t.Errorf("metrics do not contain %q:\n%s", want, out.String())
+	}
+
+	if code := runSnapshot([]string{"--from-file=" + dir, "--context=prod"}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("runSnapshot(--from-file, --context) = %d, want 2", code)
+	}
+}
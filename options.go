@@ -0,0 +1,399 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// options holds the exporter configuration: command-line flags, filled in
+// from KBE_* environment variables and the --config file for flags not given
+// on the command line.
+type options struct {
+	kubeconfig         string
+	clusterFlags       stringSliceFlag
+	metricsAddr        string
+	metricsPath        string
+	resourceCSV        string
+	labelGroupFlags    stringSliceFlag
+	groupSelectorFlags stringSliceFlag
+	logLevel           string
+	logFormat          string
+	resyncPeriod       string
+	listPageSize       int
+	nodeSelector       string
+	disableNodeMetrics bool
+
+	usageMetrics         bool
+	usageMetricsEndpoint string
+	usageMetricsInterval string
+
+	pricingFile string
+
+	headroomTargetFlags stringSliceFlag
+
+	snapshotInterval string
+
+	otlpEndpoint    string
+	otlpProtocol    string
+	otlpInterval    string
+	otlpInsecure    bool
+	otlpClusterName string
+
+	remoteWriteURL         string
+	remoteWriteInterval    string
+	remoteWriteQueueSize   int
+	remoteWriteUsername    string
+	remoteWritePassword    string
+	remoteWriteBearerToken string
+
+	dogstatsdAddr     string
+	dogstatsdInterval string
+
+	pushInstance string
+
+	exporterMetricsPath string
+
+	staleThreshold         string
+	staleMetrics           string
+	readinessRequireLeader bool
+	standbyProxy           bool
+
+	leaderElect              bool
+	leaderElectLeaseName     string
+	leaderElectNamespace     string
+	leaderElectID            string
+	leaderElectLeaseDuration string
+	leaderElectRenewDeadline string
+	leaderElectRetryPeriod   string
+
+	sharding              bool
+	shardingGroup         string
+	shardingNamespace     string
+	shardingID            string
+	shardingLeaseDuration string
+
+	metricNamespace string
+	constLabelFlags stringSliceFlag
+
+	configFile           string
+	configReloadInterval string
+
+	// labelGroupConfigs are the named label groups from the config file.
+	labelGroupConfigs []labelGroupConfig
+
+	// values holds every flag's effective value by name, for detecting which
+	// options changed on reload.
+	values map[string]string
+	// sources records where each flag's value came from: flag, env, config
+	// or default.
+	sources map[string]string
+}
+
+// register defines the exporter flags on fs, bound to o.
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "path to kubeconfig (uses in-cluster config if empty)")
+	fs.Var(&o.clusterFlags, "cluster", "watch a cluster in multi-cluster mode, as <name>=[<kubeconfig>][#<context>]; metrics get a cluster label (repeatable, e.g., --cluster=prod=#prod-admin --cluster=dev=/etc/kube/dev.yaml)")
+	fs.StringVar(&o.metricsAddr, "metrics-addr", ":9101", "address to serve metrics on")
+	fs.StringVar(&o.metricsPath, "metrics-path", "/metrics", "HTTP path for metrics endpoint")
+	fs.StringVar(&o.resourceCSV, "resources", "cpu,memory", "comma-separated list of resources to track")
+	fs.Var(&o.labelGroupFlags, "label-group", "comma-separated label keys defining one combination group (repeatable, e.g., --label-group=zone,instance-type --label-group=zone)")
+	fs.Var(&o.groupSelectorFlags, "group-selector", "named node group defined by a label selector, as <name>=<selector>; a node can be in several groups (repeatable, e.g., --group-selector='general=pool in (a,b),!gpu')")
+	fs.BoolVar(&o.disableNodeMetrics, "disable-node-metrics", false, "disable per-node metrics to reduce cardinality (only emit cluster-wide and group metrics)")
+	fs.StringVar(&o.logLevel, "log-level", "info", "log level: debug, info, warn, error")
+	fs.StringVar(&o.logFormat, "log-format", "json", "log format: json, text")
+	fs.StringVar(&o.resyncPeriod, "resync-period", "30m", "informer cache resync period (e.g., 1m, 30s, 1h30m)")
+	fs.IntVar(&o.listPageSize, "list-page-size", 500, "number of resources to fetch per page during initial sync (0 = no pagination)")
+	fs.StringVar(&o.nodeSelector, "node-selector", "", "Kubernetes label selector to filter which nodes are tracked (e.g., 'environment=production,!node-role.kubernetes.io/control-plane')")
+	fs.BoolVar(&o.leaderElect, "leader-election", false, "enable leader election for HA (only the leader publishes binpacking metrics)")
+	fs.StringVar(&o.leaderElectLeaseName, "leader-election-lease-name", "kube-binpacking-exporter", "name of the Lease object used for leader election")
+	fs.StringVar(&o.leaderElectNamespace, "leader-election-namespace", "", "namespace for the leader election Lease (auto-detected from service account if empty)")
+	fs.StringVar(&o.leaderElectID, "leader-election-id", "", "unique identity for this participant in leader election (defaults to hostname)")
+	fs.StringVar(&o.leaderElectLeaseDuration, "leader-election-lease-duration", "15s", "duration that non-leader candidates will wait before attempting to acquire leadership")
+	fs.StringVar(&o.leaderElectRenewDeadline, "leader-election-renew-deadline", "10s", "duration that the leader will retry refreshing leadership before giving up")
+	fs.StringVar(&o.leaderElectRetryPeriod, "leader-election-retry-period", "2s", "duration between leader election retries")
+	fs.BoolVar(&o.sharding, "sharding", false, "split nodes across replicas; each replica emits per-node metrics for its own nodes and partial cluster/group sums (mutually exclusive with --leader-election)")
+	fs.StringVar(&o.shardingGroup, "sharding-group", "kube-binpacking-exporter", "name shared by all replicas sharding the same nodes; prefixes each replica's membership Lease")
+	fs.StringVar(&o.shardingNamespace, "sharding-namespace", "", "namespace for the sharding membership Leases (auto-detected from service account if empty)")
+	fs.StringVar(&o.shardingID, "sharding-id", "", "unique identity for this replica in the sharding group (defaults to hostname)")
+	fs.StringVar(&o.shardingLeaseDuration, "sharding-lease-duration", "15s", "duration after which a replica that stopped renewing its Lease is dropped and its nodes reassigned")
+	fs.BoolVar(&o.usageMetrics, "usage-metrics", false, "poll the metrics.k8s.io API and export usage and usage/request efficiency metrics")
+	fs.StringVar(&o.usageMetricsEndpoint, "usage-metrics-endpoint", "", "base URL of a metrics.k8s.io compatible endpoint (queried through the API server if empty)")
+	fs.StringVar(&o.usageMetricsInterval, "usage-metrics-interval", "30s", "interval between metrics.k8s.io API polls")
+	fs.Var(&o.headroomTargetFlags, "headroom-target", "free capacity required in each value of a label group, as <label-keys>:<resource>=<quantity>[,...] (repeatable, e.g., --headroom-target=topology.kubernetes.io/zone:cpu=8,memory=32Gi)")
+	fs.StringVar(&o.pricingFile, "pricing-file", "", "path to a YAML or CSV pricing table of hourly node prices keyed by node label values (enables cost metrics)")
+	fs.StringVar(&o.snapshotInterval, "snapshot-interval", "0", "compute binpacking metrics in the background at this interval and serve the latest snapshot on every scrape (0 = compute on each scrape)")
+	fs.StringVar(&o.otlpEndpoint, "otlp-endpoint", "", "OTLP receiver to push binpacking metrics to, as host:port or URL (empty = disabled)")
+	fs.StringVar(&o.otlpProtocol, "otlp-protocol", "grpc", "OTLP protocol: grpc, http")
+	fs.StringVar(&o.otlpInterval, "otlp-interval", "60s", "interval between OTLP metric pushes")
+	fs.BoolVar(&o.otlpInsecure, "otlp-insecure", false, "push OTLP metrics without TLS")
+	fs.StringVar(&o.otlpClusterName, "otlp-cluster-name", "", "k8s.cluster.name resource attribute of pushed OTLP metrics")
+	fs.StringVar(&o.remoteWriteURL, "remote-write-url", "", "Prometheus remote-write endpoint to push binpacking metrics to (empty = disabled)")
+	fs.StringVar(&o.remoteWriteInterval, "remote-write-interval", "30s", "interval between remote-write pushes")
+	fs.IntVar(&o.remoteWriteQueueSize, "remote-write-queue-size", 20, "max pushes queued while the remote-write endpoint is unreachable; the oldest is dropped when full")
+	fs.StringVar(&o.remoteWriteUsername, "remote-write-username", "", "basic auth username for remote-write")
+	fs.StringVar(&o.remoteWritePassword, "remote-write-password", "", "basic auth password for remote-write (prefer KBE_REMOTE_WRITE_PASSWORD)")
+	fs.StringVar(&o.remoteWriteBearerToken, "remote-write-bearer-token", "", "bearer token for remote-write (prefer KBE_REMOTE_WRITE_BEARER_TOKEN)")
+	fs.StringVar(&o.dogstatsdAddr, "dogstatsd-addr", "", "DogStatsD agent to send binpacking gauges to, as host:port, udp://host:port or unix:///path (empty = disabled)")
+	fs.StringVar(&o.dogstatsdInterval, "dogstatsd-interval", "30s", "interval between DogStatsD emissions")
+	fs.StringVar(&o.pushInstance, "push-instance", "", "identifies this replica in pushed metrics, as the instance label of remote-write series, the service.instance.id OTLP resource attribute and the instance DogStatsD tag, so replicas pushing to one receiver do not overwrite each other (default: hostname, the pod name in Kubernetes)")
+	fs.StringVar(&o.exporterMetricsPath, "exporter-metrics-path", "/exporter-metrics", "HTTP path for the exporter's own self-observability metrics (separate from binpacking metrics)")
+	fs.StringVar(&o.staleThreshold, "stale-threshold", "0", "consider the informer cache stale when no watch event or resync was received for this long; fails readiness (0 = disabled)")
+	fs.StringVar(&o.staleMetrics, "stale-metrics", "keep", "what to do with binpacking metrics while the cache is stale: keep, drop")
+	fs.BoolVar(&o.readinessRequireLeader, "readiness-require-leader", false, "fail readiness while this instance is not the leader (requires --leader-election)")
+	fs.BoolVar(&o.standbyProxy, "standby-proxy", false, "on standby replicas, serve the leader's metrics and /api/v1 responses by proxying requests to the Lease holder's pod (requires --leader-election)")
+	fs.StringVar(&o.metricNamespace, "metric-namespace", defaultMetricNamespace, "prefix of every binpacking metric name (exporter self-metrics keep their names)")
+	fs.Var(&o.constLabelFlags, "const-label", "constant label added to every binpacking metric, as <name>=<value> (repeatable, e.g., --const-label=cluster=prod-eu1)")
+	fs.StringVar(&o.configFile, "config", "", "path to a YAML config file setting any flag by name plus named label groups; watched for changes (command-line flags and KBE_* environment variables take precedence)")
+	fs.StringVar(&o.configReloadInterval, "config-reload-interval", "10s", "how often to check the --config file and its pricing table for changes (0 = never reload)")
+}
+
+// envPrefix is prepended to a flag's upper-cased name, with dashes replaced
+// by underscores, to form its environment variable (e.g. KBE_LABEL_GROUP).
+const envPrefix = "KBE_"
+
+// envListSeparator separates the values of a repeatable flag in its
+// environment variable. Commas cannot be used since a single --label-group
+// or --headroom-target value already contains them.
+const envListSeparator = ";"
+
+// envName returns the environment variable that sets the named flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// parseOptions parses command-line args, then fills every flag not given on
+// the command line from its KBE_* environment variable and, when --config is
+// set, every flag still unset from the config file. Precedence is therefore
+// command line, environment, config file, default.
+func parseOptions(args []string) (*options, error) {
+	return parseCommandOptions("kube-binpacking-exporter", args, nil)
+}
+
+// parseCommandOptions is parseOptions for the subcommand name, with extra
+// registering the subcommand's own flags next to the exporter's.
+func parseCommandOptions(name string, args []string, extra func(fs *flag.FlagSet)) (*options, error) {
+	o := &options{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	o.register(fs)
+	if extra != nil {
+		extra(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	o.sources = make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { o.sources[f.Name] = "flag" })
+	if err := applyEnv(fs, o.sources); err != nil {
+		return nil, err
+	}
+
+	if o.configFile != "" {
+		explicit := make(map[string]bool, len(o.sources))
+		for name := range o.sources {
+			explicit[name] = true
+		}
+		groups, err := applyConfigFile(fs, o.configFile, explicit)
+		if err != nil {
+			return nil, err
+		}
+		o.labelGroupConfigs = groups
+		fs.Visit(func(f *flag.Flag) {
+			if !explicit[f.Name] {
+				o.sources[f.Name] = "config"
+			}
+		})
+	}
+
+	o.values = make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		o.values[f.Name] = f.Value.String()
+		if _, ok := o.sources[f.Name]; !ok {
+			o.sources[f.Name] = "default"
+		}
+	})
+	return o, nil
+}
+
+// applyEnv sets each flag not already in sources from its environment
+// variable and records it as set from env. Repeatable flags are split on
+// envListSeparator.
+func applyEnv(fs *flag.FlagSet, sources map[string]string) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] != "" {
+			return
+		}
+		env := envName(f.Name)
+		raw, ok := os.LookupEnv(env)
+		if !ok {
+			return
+		}
+
+		values := []string{raw}
+		if _, repeatable := f.Value.(*stringSliceFlag); repeatable {
+			values = values[:0]
+			for _, v := range strings.Split(raw, envListSeparator) {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		for _, v := range values {
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("environment variable %s: %w", env, setErr)
+				return
+			}
+		}
+		sources[f.Name] = "env"
+	})
+	return err
+}
+
+// secretOptionWords mark flags whose values are credentials.
+var secretOptionWords = []string{"password", "token", "secret", "api-key"}
+
+// redactedValue returns value as safe to log: secret flags are masked, as is
+// any user info embedded in a URL.
+func redactedValue(name, value string) string {
+	if value == "" {
+		return value
+	}
+	for _, word := range secretOptionWords {
+		if strings.Contains(name, word) {
+			return "REDACTED"
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = url.User("REDACTED")
+		return u.String()
+	}
+	return value
+}
+
+// logAttrs returns every option's effective value, redacted, and the source
+// it was set from, sorted by name for logging.
+func (o *options) logAttrs() []any {
+	names := make([]string, 0, len(o.values))
+	for name := range o.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]any, 0, len(names))
+	for _, name := range names {
+		attrs = append(attrs, slog.Group(name,
+			"value", redactedValue(name, o.values[name]),
+			"source", o.sources[name]))
+	}
+	return attrs
+}
+
+// reloadableOptions are the flags a config reload applies without a restart.
+var reloadableOptions = map[string]bool{
+	"resources":            true,
+	"label-group":          true,
+	"group-selector":       true,
+	"headroom-target":      true,
+	"disable-node-metrics": true,
+	"node-selector":        true,
+	"pricing-file":         true,
+}
+
+// restartRequired returns the names of options that differ between o and
+// next but only take effect on restart.
+func (o *options) restartRequired(next *options) []string {
+	var changed []string
+	for name, value := range next.values {
+		if !reloadableOptions[name] && o.values[name] != value {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// collectorSettings builds the reloadable collector settings: tracked
+// resources, label groups from --label-group and the config file, selector
+// groups, headroom targets and the pricing table.
+func (o *options) collectorSettings() (CollectorSettings, error) {
+	flagGroups := parseLabelGroups(o.labelGroupFlags)
+	headroomTargets, err := parseHeadroomTargets(o.headroomTargetFlags, flagGroups)
+	if err != nil {
+		return CollectorSettings{}, fmt.Errorf("invalid headroom target: %w", err)
+	}
+
+	groups := make([]LabelGroup, 0, len(flagGroups)+len(o.labelGroupConfigs))
+	names := make(map[string]bool)
+	for _, keys := range flagGroups {
+		group := newLabelGroup(keys...)
+		groups = append(groups, group)
+		names[group.Name] = true
+	}
+	for _, cfg := range o.labelGroupConfigs {
+		group, err := cfg.labelGroup()
+		if err != nil {
+			return CollectorSettings{}, err
+		}
+		if names[group.Name] {
+			return CollectorSettings{}, fmt.Errorf("duplicate label group name %q", group.Name)
+		}
+		names[group.Name] = true
+		groups = append(groups, group)
+		if len(cfg.Headroom) > 0 {
+			headroomTargets[group.Name] = cfg.headroomTarget()
+		}
+	}
+
+	for _, group := range groups {
+		for _, key := range group.Keys {
+			if err := validateGroupKey(key); err != nil {
+				return CollectorSettings{}, fmt.Errorf("label group %q: %w", group.Name, err)
+			}
+		}
+	}
+
+	selectorGroups, err := parseSelectorGroups(o.groupSelectorFlags)
+	if err != nil {
+		return CollectorSettings{}, fmt.Errorf("invalid group selector: %w", err)
+	}
+
+	var pricing *PricingTable
+	if o.pricingFile != "" {
+		pricing, err = LoadPricingTable(o.pricingFile)
+		if err != nil {
+			return CollectorSettings{}, fmt.Errorf("failed to load pricing table %s: %w", o.pricingFile, err)
+		}
+	}
+
+	return CollectorSettings{
+		Resources:         parseResources(o.resourceCSV),
+		LabelGroups:       groups,
+		SelectorGroups:    selectorGroups,
+		EnableNodeMetrics: !o.disableNodeMetrics,
+		HeadroomTargets:   headroomTargets,
+		Pricing:           pricing,
+	}, nil
+}
+
+// validateReloadable checks the reloadable options that collectorSettings
+// does not already validate.
+func (o *options) validateReloadable(settings CollectorSettings) error {
+	if o.nodeSelector != "" {
+		if _, err := labels.Parse(o.nodeSelector); err != nil {
+			return fmt.Errorf("invalid node selector %q: %w", o.nodeSelector, err)
+		}
+	}
+	if o.sharding && len(settings.HeadroomTargets) > 0 {
+		// Headroom is judged per group value, which needs every node of the
+		// group; a shard only sees part of it.
+		return fmt.Errorf("headroom targets are not supported with --sharding")
+	}
+	return nil
+}
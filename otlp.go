@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promotel "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLPConfig configures pushing binpacking metrics to an OTLP receiver.
+type OTLPConfig struct {
+	Endpoint    string // host:port, or a URL (http:// implies insecure)
+	Protocol    string // grpc or http
+	Insecure    bool
+	Interval    time.Duration
+	ClusterName string // k8s.cluster.name resource attribute; empty = unset
+	InstanceID  string // service.instance.id resource attribute; empty = unset
+}
+
+// OTLPPusher periodically gathers the binpacking registry and pushes every
+// metric family as OTel data points (gauges stay gauges) to an OTLP receiver.
+// It reuses the registry's collectors, so it pushes exactly what /metrics
+// serves. The standard OTEL_EXPORTER_OTLP_* and OTEL_RESOURCE_ATTRIBUTES
+// environment variables are honored.
+type OTLPPusher struct {
+	provider *sdkmetric.MeterProvider
+}
+
+// NewOTLPPusher creates the exporter and starts the periodic reader; the
+// first push happens after one interval.
+func NewOTLPPusher(ctx context.Context, cfg OTLPConfig, gatherer prometheus.Gatherer, logger *slog.Logger) (*OTLPPusher, error) {
+	exporter, err := newOTLPExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", "kube-binpacking-exporter"),
+		attribute.String("service.version", version),
+	}
+	if cfg.ClusterName != "" {
+		attrs = append(attrs, attribute.String("k8s.cluster.name", cfg.ClusterName))
+	}
+	// Every replica pushes, so the instance keeps standby and shard series apart.
+	if cfg.InstanceID != "" {
+		attrs = append(attrs, attribute.String("service.instance.id", cfg.InstanceID))
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(attrs...), resource.WithFromEnv())
+	if err != nil {
+		return nil, fmt.Errorf("building OTLP resource: %w", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(cfg.Interval),
+		sdkmetric.WithProducer(promotel.NewMetricProducer(promotel.WithGatherer(gatherer))))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+
+	// Export failures are reported through the global OTel error handler.
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("OTLP metrics push failed", "error", err)
+	}))
+	return &OTLPPusher{provider: provider}, nil
+}
+
+// newOTLPExporter returns the gRPC or HTTP OTLP metric exporter for cfg.
+func newOTLPExporter(ctx context.Context, cfg OTLPConfig) (sdkmetric.Exporter, error) {
+	isURL := strings.Contains(cfg.Endpoint, "://")
+	switch cfg.Protocol {
+	case "grpc":
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(cfg.Endpoint)}
+		if isURL {
+			opts = []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpointURL(cfg.Endpoint)}
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	case "http":
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(cfg.Endpoint)}
+		if isURL {
+			opts = []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(cfg.Endpoint)}
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q, must be grpc or http", cfg.Protocol)
+	}
+}
+
+// ForceFlush pushes the current metrics immediately.
+func (p *OTLPPusher) ForceFlush(ctx context.Context) error {
+	return p.provider.ForceFlush(ctx)
+}
+
+// Shutdown pushes a final time and stops the exporter.
+func (p *OTLPPusher) Shutdown(ctx context.Context) error {
+	return p.provider.Shutdown(ctx)
+}
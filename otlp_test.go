@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// otlpReceiver is an in-process OTLP metrics receiver for both protocols.
+type otlpReceiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+}
+
+func (r *otlpReceiver) Export(_ context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var export collectormetrics.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(body, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, _ = r.Export(req.Context(), &export)
+	out, _ := proto.Marshal(&collectormetrics.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(out)
+}
+
+// resourceMetrics returns every received ResourceMetrics.
+func (r *otlpReceiver) resourceMetrics() []*metricspb.ResourceMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var all []*metricspb.ResourceMetrics
+	for _, req := range r.requests {
+		all = append(all, req.GetResourceMetrics()...)
+	}
+	return all
+}
+
+// TestOTLPPusher pushes the binpacking registry over gRPC and HTTP and checks
+// the receiver gets the families as gauges with the resource attributes.
+func TestOTLPPusher(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	nodeLister := &fakeNodeLister{nodes: []*corev1.Node{makeNode("node-1", "4", "8Gi")}}
+	collector := NewBinpackingCollector(nodeLister, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	grpcReceiver := &otlpReceiver{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(server, grpcReceiver)
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	httpReceiver := &otlpReceiver{}
+	httpServer := httptest.NewServer(httpReceiver)
+	defer httpServer.Close()
+
+	tests := []struct {
+		name     string
+		cfg      OTLPConfig
+		receiver *otlpReceiver
+	}{
+		{
+			name:     "grpc",
+			cfg:      OTLPConfig{Endpoint: lis.Addr().String(), Protocol: "grpc", Insecure: true},
+			receiver: grpcReceiver,
+		},
+		{
+			name:     "http",
+			cfg:      OTLPConfig{Endpoint: httpServer.URL, Protocol: "http"},
+			receiver: httpReceiver,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tt.cfg.Interval = time.Hour
+			tt.cfg.ClusterName = "prod-eu1"
+			tt.cfg.InstanceID = "replica-a"
+			pusher, err := NewOTLPPusher(ctx, tt.cfg, registry, logger)
+			if err != nil {
+				t.Fatalf("NewOTLPPusher() error = %v", err)
+			}
+			if err := pusher.ForceFlush(ctx); err != nil {
+				t.Fatalf("ForceFlush() error = %v", err)
+			}
+			if err := pusher.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+
+			all := tt.receiver.resourceMetrics()
+			if len(all) == 0 {
+				t.Fatal("receiver got no metrics")
+			}
+			attrs := map[string]string{}
+			for _, kv := range all[0].GetResource().GetAttributes() {
+				attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+			}
+			if attrs["k8s.cluster.name"] != "prod-eu1" || attrs["service.version"] != version || attrs["service.name"] != "kube-binpacking-exporter" || attrs["service.instance.id"] != "replica-a" {
+				t.Errorf("resource attributes = %v, want cluster, instance and exporter version", attrs)
+			}
+
+			var gauge *metricspb.Gauge
+			for _, sm := range all[0].GetScopeMetrics() {
+				for _, m := range sm.GetMetrics() {
+					if m.GetName() == "kube_binpacking_cluster_node_count" {
+						gauge = m.GetGauge()
+					}
+				}
+			}
+			if gauge == nil || len(gauge.GetDataPoints()) != 1 || gauge.GetDataPoints()[0].GetAsDouble() != 1 {
+				t.Errorf("kube_binpacking_cluster_node_count = %v, want a gauge with value 1", gauge)
+			}
+		})
+	}
+
+	if _, err := NewOTLPPusher(context.Background(), OTLPConfig{Endpoint: "localhost:4317", Protocol: "udp", Interval: time.Minute}, registry, logger); err == nil {
+		t.Error("NewOTLPPusher() with an unknown protocol should fail")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// csvPriceColumn is the name of the CSV column holding the hourly price.
+// All other columns are node label keys.
+const csvPriceColumn = "hourly_price"
+
+// pricingFile is the YAML representation of a pricing table.
+//
+//	labelKeys: [node.kubernetes.io/instance-type, karpenter.sh/capacity-type]
+//	defaultHourlyPrice: 0.1
+//	prices:
+//	  - labels: {node.kubernetes.io/instance-type: m5.large, karpenter.sh/capacity-type: spot}
+//	    hourlyPrice: 0.035
+type pricingFile struct {
+	LabelKeys          []string       `json:"labelKeys"`
+	DefaultHourlyPrice *float64       `json:"defaultHourlyPrice,omitempty"`
+	Prices             []pricingEntry `json:"prices"`
+}
+
+type pricingEntry struct {
+	Labels      map[string]string `json:"labels"`
+	HourlyPrice float64           `json:"hourlyPrice"`
+}
+
+// PricingTable maps node label values (e.g. instance type × capacity type)
+// to an hourly node price.
+type PricingTable struct {
+	labelKeys    []string
+	prices       map[string]float64 // keyed by label values joined with pricingKeySep
+	defaultPrice *float64
+}
+
+// pricingKeySep separates label values in a pricing key. Label values cannot
+// contain it, so keys are unambiguous.
+const pricingKeySep = "\x00"
+
+// LoadPricingTable reads a pricing table from a YAML or CSV file. The format
+// is chosen by file extension: ".csv" is CSV, anything else is YAML.
+func LoadPricingTable(path string) (*PricingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pricing file: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return parsePricingCSV(data)
+	}
+	return parsePricingYAML(data)
+}
+
+func parsePricingYAML(data []byte) (*PricingTable, error) {
+	var f pricingFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing pricing YAML: %w", err)
+	}
+	if len(f.LabelKeys) == 0 {
+		return nil, fmt.Errorf("pricing YAML: labelKeys must not be empty")
+	}
+
+	table := &PricingTable{
+		labelKeys:    f.LabelKeys,
+		prices:       make(map[string]float64, len(f.Prices)),
+		defaultPrice: f.DefaultHourlyPrice,
+	}
+	for i, entry := range f.Prices {
+		values := make([]string, len(f.LabelKeys))
+		for j, key := range f.LabelKeys {
+			v, ok := entry.Labels[key]
+			if !ok {
+				return nil, fmt.Errorf("pricing YAML: prices[%d] is missing label %q", i, key)
+			}
+			values[j] = v
+		}
+		if len(entry.Labels) != len(f.LabelKeys) {
+			return nil, fmt.Errorf("pricing YAML: prices[%d] has labels not listed in labelKeys", i)
+		}
+		if err := table.add(values, entry.HourlyPrice); err != nil {
+			return nil, fmt.Errorf("pricing YAML: prices[%d]: %w", i, err)
+		}
+	}
+	return table, nil
+}
+
+func parsePricingCSV(data []byte) (*PricingTable, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parsing pricing CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("pricing CSV: missing header row")
+	}
+
+	header := records[0]
+	if len(header) < 2 || strings.TrimSpace(header[len(header)-1]) != csvPriceColumn {
+		return nil, fmt.Errorf("pricing CSV: header must be label keys followed by %q", csvPriceColumn)
+	}
+	labelKeys := make([]string, len(header)-1)
+	for i, key := range header[:len(header)-1] {
+		labelKeys[i] = strings.TrimSpace(key)
+	}
+
+	table := &PricingTable{
+		labelKeys: labelKeys,
+		prices:    make(map[string]float64, len(records)-1),
+	}
+	for i, record := range records[1:] {
+		line := i + 2
+		price, err := strconv.ParseFloat(strings.TrimSpace(record[len(record)-1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("pricing CSV line %d: invalid price: %w", line, err)
+		}
+		values := make([]string, len(labelKeys))
+		for j := range labelKeys {
+			values[j] = strings.TrimSpace(record[j])
+		}
+		if err := table.add(values, price); err != nil {
+			return nil, fmt.Errorf("pricing CSV line %d: %w", line, err)
+		}
+	}
+	return table, nil
+}
+
+func (p *PricingTable) add(values []string, price float64) error {
+	if price < 0 {
+		return fmt.Errorf("negative price %v", price)
+	}
+	key := strings.Join(values, pricingKeySep)
+	if _, exists := p.prices[key]; exists {
+		return fmt.Errorf("duplicate price for %s", strings.Join(values, ","))
+	}
+	p.prices[key] = price
+	return nil
+}
+
+// LabelKeys returns the node label keys that identify a price.
+func (p *PricingTable) LabelKeys() []string {
+	return p.labelKeys
+}
+
+// Len returns the number of prices in the table.
+func (p *PricingTable) Len() int {
+	return len(p.prices)
+}
+
+// NodePrice returns the hourly price of a node. The second return value is
+// false when no price matches the node's labels and no default is set.
+func (p *PricingTable) NodePrice(node *corev1.Node) (float64, bool) {
+	values := make([]string, len(p.labelKeys))
+	for i, key := range p.labelKeys {
+		values[i] = node.Labels[key]
+	}
+	if price, ok := p.prices[strings.Join(values, pricingKeySep)]; ok {
+		return price, true
+	}
+	if p.defaultPrice != nil {
+		return *p.defaultPrice, true
+	}
+	return 0, false
+}
+
+// costShare attributes part of a node's hourly price to an amount of one
+// resource, proportional to its share of the node's allocatable. Each resource
+// is attributed the full node price independently.
+func costShare(price, amount, allocatable float64) float64 {
+	if allocatable <= 0 || amount <= 0 {
+		return 0
+	}
+	return price * amount / allocatable
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	instanceTypeLabel = "node.kubernetes.io/instance-type"
+	capacityTypeLabel = "karpenter.sh/capacity-type"
+)
+
+func makePricedNode(name, cpu, memory, instanceType, capacityType string) *corev1.Node {
+	node := makeNode(name, cpu, memory)
+	node.Labels = map[string]string{
+		instanceTypeLabel: instanceType,
+		capacityTypeLabel: capacityType,
+	}
+	return node
+}
+
+func writePricingFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing pricing file: %v", err)
+	}
+	return path
+}
+
+// TestLoadPricingTable tests YAML and CSV parsing and validation.
+func TestLoadPricingTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		wantErr  bool
+		wantLen  int
+		wantKeys []string
+	}{
+		{
+			name: "yaml",
+			file: "prices.yaml",
+			content: `labelKeys: [node.kubernetes.io/instance-type, karpenter.sh/capacity-type]
+prices:
+  - labels: {node.kubernetes.io/instance-type: m5.large, karpenter.sh/capacity-type: on-demand}
+    hourlyPrice: 0.096
+  - labels: {node.kubernetes.io/instance-type: m5.large, karpenter.sh/capacity-type: spot}
+    hourlyPrice: 0.035
+`,
+			wantLen:  2,
+			wantKeys: []string{instanceTypeLabel, capacityTypeLabel},
+		},
+		{
+			name: "csv",
+			file: "prices.csv",
+			content: `node.kubernetes.io/instance-type,karpenter.sh/capacity-type,hourly_price
+m5.large,on-demand,0.096
+m5.large,spot,0.035
+m5.xlarge,on-demand,0.192
+`,
+			wantLen:  3,
+			wantKeys: []string{instanceTypeLabel, capacityTypeLabel},
+		},
+		{
+			name:    "yaml missing labelKeys",
+			file:    "prices.yaml",
+			content: "prices: []\n",
+			wantErr: true,
+		},
+		{
+			name: "yaml entry missing a key",
+			file: "prices.yaml",
+			content: `labelKeys: [a, b]
+prices:
+  - labels: {a: x}
+    hourlyPrice: 1
+`,
+			wantErr: true,
+		},
+		{
+			name: "yaml unknown field",
+			file: "prices.yaml",
+			content: `labelKeys: [a]
+price: []
+`,
+			wantErr: true,
+		},
+		{
+			name:    "csv missing price column",
+			file:    "prices.csv",
+			content: "a,b\nx,y\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv invalid price",
+			file:    "prices.csv",
+			content: "a,hourly_price\nx,cheap\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv negative price",
+			file:    "prices.csv",
+			content: "a,hourly_price\nx,-1\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv duplicate entry",
+			file:    "prices.csv",
+			content: "a,hourly_price\nx,1\nx,2\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv wrong column count",
+			file:    "prices.csv",
+			content: "a,hourly_price\nx,y,1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := LoadPricingTable(writePricingFile(t, tt.file, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPricingTable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if table.Len() != tt.wantLen {
+				t.Errorf("Len() = %d, want %d", table.Len(), tt.wantLen)
+			}
+			if len(table.LabelKeys()) != len(tt.wantKeys) {
+				t.Fatalf("LabelKeys() = %v, want %v", table.LabelKeys(), tt.wantKeys)
+			}
+			for i := range tt.wantKeys {
+				if table.LabelKeys()[i] != tt.wantKeys[i] {
+					t.Errorf("LabelKeys()[%d] = %q, want %q", i, table.LabelKeys()[i], tt.wantKeys[i])
+				}
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := LoadPricingTable(filepath.Join(t.TempDir(), "nope.yaml")); err == nil {
+			t.Error("expected error for missing file")
+		}
+	})
+}
+
+// TestPricingTable_NodePrice tests price lookup and the default price fallback.
+func TestPricingTable_NodePrice(t *testing.T) {
+	table, err := parsePricingYAML([]byte(`labelKeys: [node.kubernetes.io/instance-type, karpenter.sh/capacity-type]
+prices:
+  - labels: {node.kubernetes.io/instance-type: m5.large, karpenter.sh/capacity-type: spot}
+    hourlyPrice: 0.035
+`))
+	if err != nil {
+		t.Fatalf("parsePricingYAML() error = %v", err)
+	}
+
+	if price, ok := table.NodePrice(makePricedNode("n1", "2", "8Gi", "m5.large", "spot")); !ok || !floatEquals(price, 0.035) {
+		t.Errorf("NodePrice(matching) = %v, %v, want 0.035, true", price, ok)
+	}
+	if _, ok := table.NodePrice(makePricedNode("n2", "2", "8Gi", "m5.large", "on-demand")); ok {
+		t.Error("NodePrice(unmatched) should report no price when no default is set")
+	}
+	if _, ok := table.NodePrice(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}}); ok {
+		t.Error("NodePrice(unlabeled) should report no price when no default is set")
+	}
+
+	defaultPrice := 0.5
+	table.defaultPrice = &defaultPrice
+	if price, ok := table.NodePrice(makePricedNode("n2", "2", "8Gi", "m5.large", "on-demand")); !ok || price != 0.5 {
+		t.Errorf("NodePrice(unmatched with default) = %v, %v, want 0.5, true", price, ok)
+	}
+}
+
+// TestBinpackingCollector_CostMetrics verifies cluster and group cost metrics.
+func TestBinpackingCollector_CostMetrics(t *testing.T) {
+	table, err := parsePricingCSV([]byte("node.kubernetes.io/instance-type,karpenter.sh/capacity-type,hourly_price\n" +
+		"m5.large,on-demand,0.1\n" +
+		"m5.xlarge,spot,0.2\n"))
+	if err != nil {
+		t.Fatalf("parsePricingCSV() error = %v", err)
+	}
+
+	nodes := []*corev1.Node{
+		makePricedNode("node-1", "4", "8Gi", "m5.large", "on-demand"),
+		makePricedNode("node-2", "8", "16Gi", "m5.xlarge", "spot"),
+		makePricedNode("node-3", "4", "8Gi", "c5.large", "spot"), // unpriced
+	}
+	pods := []*corev1.Pod{
+		// node-1: 1 CPU app + 1 CPU DaemonSet = 2/4 allocated
+		makePodWithResources("default", "app-1", "node-1", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "1", "2Gi")}, nil),
+		makeDaemonSetPod("kube-system", "ds-1", "node-1", "1", "1Gi"),
+		// node-2: 6 CPU app = 6/8 allocated
+		makePodWithResources("default", "app-2", "node-2", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "6", "8Gi")}, nil),
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{pods: pods},
+		logger, []corev1.ResourceName{corev1.ResourceCPU}, []LabelGroup{newLabelGroup(capacityTypeLabel)}, true, nil, nil)
+	s := collector.Settings()
+	s.Pricing = table
+	collector.Reconfigure(s)
+	metrics := collectMetrics(collector)
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"kube_binpacking_cluster_hourly_cost", nil, 0.3},
+		// node-1: 0.1 × 2/4 + node-2: 0.2 × 2/8 + node-3 unpriced
+		{"kube_binpacking_cluster_unallocated_hourly_cost", map[string]string{"resource": "cpu"}, 0.1},
+		// node-1: 0.1 × 1/4
+		{"kube_binpacking_cluster_daemonset_overhead_hourly_cost", map[string]string{"resource": "cpu"}, 0.025},
+		{"kube_binpacking_cluster_unpriced_node_count", nil, 1},
+		{"kube_binpacking_group_hourly_cost", map[string]string{"label_group_value": "spot"}, 0.2},
+		{"kube_binpacking_group_unallocated_hourly_cost", map[string]string{"label_group_value": "spot", "resource": "cpu"}, 0.05},
+		{"kube_binpacking_group_unallocated_hourly_cost", map[string]string{"label_group_value": "on-demand", "resource": "cpu"}, 0.05},
+		{"kube_binpacking_group_daemonset_overhead_hourly_cost", map[string]string{"label_group_value": "on-demand", "resource": "cpu"}, 0.025},
+	}
+	for _, tt := range tests {
+		got, ok := findMetricValue(t, metrics, tt.name, tt.labels)
+		if !ok {
+			t.Errorf("%s%v not emitted", tt.name, tt.labels)
+			continue
+		}
+		if !floatEquals(got, tt.want) {
+			t.Errorf("%s%v = %v, want %v", tt.name, tt.labels, got, tt.want)
+		}
+	}
+
+	t.Run("disabled without pricing table", func(t *testing.T) {
+		collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{pods: pods},
+			logger, []corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil)
+		if _, ok := findMetricValue(t, collectMetrics(collector), "kube_binpacking_cluster_hourly_cost", nil); ok {
+			t.Error("cost metrics should not be emitted without a pricing table")
+		}
+	})
+}
+
+// TestCostShare tests cost attribution edge cases.
+func TestCostShare(t *testing.T) {
+	tests := []struct {
+		name                       string
+		price, amount, allocatable float64
+		want                       float64
+	}{
+		{name: "half", price: 1, amount: 2, allocatable: 4, want: 0.5},
+		{name: "zero allocatable", price: 1, amount: 2, allocatable: 0, want: 0},
+		{name: "overcommitted has no unallocated cost", price: 1, amount: -1, allocatable: 4, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := costShare(tt.price, tt.amount, tt.allocatable); !floatEquals(got, tt.want) {
+				t.Errorf("costShare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Remote-write retry backoff bounds. The delay doubles after each failed
+// attempt.
+const (
+	remoteWriteMinBackoff = time.Second
+	remoteWriteMaxBackoff = time.Minute
+)
+
+// RemoteWriteConfig configures pushing binpacking metrics over Prometheus
+// remote-write.
+type RemoteWriteConfig struct {
+	URL       string
+	Interval  time.Duration
+	QueueSize int // max batches held while the endpoint is unreachable
+
+	// Username and Password enable basic auth; BearerToken sets an
+	// Authorization: Bearer header. At most one of the two is used.
+	Username    string
+	Password    string
+	BearerToken string
+
+	// Instance is added as the instance label of every series that does not
+	// already have one, so replicas pushing to one receiver stay distinct.
+	Instance string
+}
+
+// RemoteWriter gathers the binpacking registry every interval and pushes the
+// samples to a remote-write endpoint (protocol 1.0). Batches that fail with a
+// retryable error (network, 5xx, 429) stay queued and are retried with
+// exponential backoff, oldest first; when the queue is full the oldest batch
+// is dropped. Other 4xx responses drop the batch, since resending it cannot
+// succeed.
+type RemoteWriter struct {
+	cfg      RemoteWriteConfig
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	metrics  *ExporterMetrics
+	logger   *slog.Logger
+
+	queue   []remoteWriteBatch // oldest first
+	backoff time.Duration
+}
+
+// remoteWriteBatch is one gather's snappy-compressed WriteRequest.
+type remoteWriteBatch struct {
+	body    []byte
+	samples int
+}
+
+// NewRemoteWriter returns a RemoteWriter pushing what gatherer collects.
+func NewRemoteWriter(cfg RemoteWriteConfig, gatherer prometheus.Gatherer, client *http.Client, metrics *ExporterMetrics, logger *slog.Logger) *RemoteWriter {
+	return &RemoteWriter{cfg: cfg, gatherer: gatherer, client: client, metrics: metrics, logger: logger}
+}
+
+// Run pushes a batch every interval and retries queued batches with backoff
+// until the context is cancelled. While a retry is pending, ticks only queue a
+// batch so the backoff can grow past the interval.
+func (w *RemoteWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.enqueue(time.Now())
+			if retry != nil {
+				// Wait for the backoff; flushing here would cap it at the interval.
+				continue
+			}
+		case <-retry:
+		}
+
+		if err := w.flush(ctx); err != nil {
+			w.backoff = min(max(2*w.backoff, remoteWriteMinBackoff), remoteWriteMaxBackoff)
+			retry = time.After(w.backoff)
+			w.logger.Warn("remote write failed, retrying", "error", err, "queued_batches", len(w.queue), "retry_in", w.backoff)
+			continue
+		}
+		w.backoff = 0
+		retry = nil
+	}
+}
+
+// enqueue gathers the registry and queues the samples as one batch, dropping
+// the oldest batch if the queue is full.
+func (w *RemoteWriter) enqueue(now time.Time) {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		w.logger.Warn("gathering metrics for remote write", "error", err)
+	}
+	series := timeSeriesFromFamilies(families, w.cfg.Instance, now)
+	if len(series) == 0 {
+		return
+	}
+
+	if len(w.queue) >= w.cfg.QueueSize {
+		w.queue = w.queue[1:]
+		w.metrics.observeRemoteWrite(remoteWriteDropped, 0)
+		w.logger.Warn("remote write queue full, dropping oldest batch", "queue_size", w.cfg.QueueSize)
+	}
+	w.queue = append(w.queue, remoteWriteBatch{body: snappy.Encode(nil, encodeWriteRequest(series)), samples: len(series)})
+	w.metrics.setRemoteWriteQueue(len(w.queue))
+}
+
+// flush sends queued batches oldest first, stopping at the first retryable
+// failure.
+func (w *RemoteWriter) flush(ctx context.Context) error {
+	for len(w.queue) > 0 {
+		batch := w.queue[0]
+		retryable, err := w.send(ctx, batch.body)
+		if err != nil && retryable {
+			w.metrics.observeRemoteWrite(remoteWriteFailed, 0)
+			return err
+		}
+		if err != nil {
+			w.metrics.observeRemoteWrite(remoteWriteDropped, 0)
+			w.logger.Error("remote write rejected, dropping batch", "error", err)
+		} else {
+			w.metrics.observeRemoteWrite(remoteWriteSent, batch.samples)
+		}
+		w.queue = w.queue[1:]
+		w.metrics.setRemoteWriteQueue(len(w.queue))
+	}
+	return nil
+}
+
+// send posts one compressed WriteRequest and reports whether a failure is
+// worth retrying.
+func (w *RemoteWriter) send(ctx context.Context, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "kube-binpacking-exporter/"+version)
+	switch {
+	case w.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+w.cfg.BearerToken)
+	case w.cfg.Username != "":
+		req.SetBasicAuth(w.cfg.Username, w.cfg.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write endpoint returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// prompbLabel and prompbTimeSeries mirror the remote-write protobuf messages.
+type prompbLabel struct {
+	Name, Value string
+}
+
+type prompbTimeSeries struct {
+	Labels      []prompbLabel // sorted by name
+	Value       float64
+	TimestampMs int64
+}
+
+// timeSeriesFromFamilies converts gathered gauge, counter and untyped
+// families (the binpacking registry only has gauges) to one sample per
+// series, timestamped now unless the metric carries its own timestamp.
+// Series without an instance label are labelled with instance if non-empty.
+func timeSeriesFromFamilies(families []*dto.MetricFamily, instance string, now time.Time) []prompbTimeSeries {
+	var series []prompbTimeSeries
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			var value float64
+			switch mf.GetType() {
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+
+			labels := []prompbLabel{{Name: "__name__", Value: mf.GetName()}}
+			hasInstance := false
+			for _, lp := range m.GetLabel() {
+				if lp.GetValue() != "" {
+					labels = append(labels, prompbLabel{Name: lp.GetName(), Value: lp.GetValue()})
+					hasInstance = hasInstance || lp.GetName() == "instance"
+				}
+			}
+			if instance != "" && !hasInstance {
+				labels = append(labels, prompbLabel{Name: "instance", Value: instance})
+			}
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+			ts := now.UnixMilli()
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			series = append(series, prompbTimeSeries{Labels: labels, Value: value, TimestampMs: ts})
+		}
+	}
+	return series
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []prompbTimeSeries) []byte {
+	var out, ts, msg []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.Labels {
+			msg = protowire.AppendTag(msg[:0], 1, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.Name)
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.Value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+		msg = protowire.AppendTag(msg[:0], 1, protowire.Fixed64Type)
+		msg = protowire.AppendFixed64(msg, math.Float64bits(s.Value))
+		msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(s.TimestampMs))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, msg)
+
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, ts)
+	}
+	return out
+}
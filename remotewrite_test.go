@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// decodeWriteRequest decodes what encodeWriteRequest produces.
+func decodeWriteRequest(t *testing.T, data []byte) []prompbTimeSeries {
+	t.Helper()
+	var series []prompbTimeSeries
+	forEachField(t, data, func(_ protowire.Number, ts []byte, _ uint64) {
+		var s prompbTimeSeries
+		forEachField(t, ts, func(num protowire.Number, msg []byte, _ uint64) {
+			switch num {
+			case 1:
+				var l prompbLabel
+				forEachField(t, msg, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						l.Name = string(v)
+					} else {
+						l.Value = string(v)
+					}
+				})
+				s.Labels = append(s.Labels, l)
+			case 2:
+				forEachField(t, msg, func(num protowire.Number, _ []byte, v uint64) {
+					if num == 1 {
+						s.Value = math.Float64frombits(v)
+					} else {
+						s.TimestampMs = int64(v)
+					}
+				})
+			}
+		})
+		series = append(series, s)
+	})
+	return series
+}
+
+// forEachField calls fn with each field's bytes (length-delimited) or
+// integer value (varint, fixed64).
+func forEachField(t *testing.T, data []byte, fn func(num protowire.Number, b []byte, v uint64)) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		data = data[n:]
+		switch typ {
+		case protowire.BytesType:
+			b, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				t.Fatalf("bad bytes: %v", protowire.ParseError(n))
+			}
+			fn(num, b, 0)
+			data = data[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			fn(num, nil, v)
+			data = data[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			fn(num, nil, v)
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+	}
+}
+
+func TestTimeSeriesFromFamilies(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	nodeLister := &fakeNodeLister{nodes: []*corev1.Node{makeNode("node-1", "4", "8Gi")}}
+	collector := NewBinpackingCollector(nodeLister, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	now := time.UnixMilli(1700000000000)
+	series := timeSeriesFromFamilies(families, "replica-a", now)
+	decoded := decodeWriteRequest(t, encodeWriteRequest(series))
+	if !reflect.DeepEqual(decoded, series) {
+		t.Fatalf("decoded WriteRequest differs from the encoded series")
+	}
+
+	want := prompbTimeSeries{
+		Labels: []prompbLabel{
+			{Name: "__name__", Value: "kube_binpacking_node_allocatable"},
+			{Name: "instance", Value: "replica-a"},
+			{Name: "node", Value: "node-1"},
+			{Name: "resource", Value: "cpu"},
+		},
+		Value:       4,
+		TimestampMs: now.UnixMilli(),
+	}
+	found := false
+	for _, s := range series {
+		if reflect.DeepEqual(s, want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("series %+v not found in %d series", want, len(series))
+	}
+
+	// A series that already has an instance label, e.g. from --const-label, keeps it.
+	name, labelName, labelValue, value := "up", "instance", "edge-eu1", 1.0
+	own := []*dto.MetricFamily{{
+		Name:   &name,
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Label: []*dto.LabelPair{{Name: &labelName, Value: &labelValue}}, Gauge: &dto.Gauge{Value: &value}}},
+	}}
+	got := timeSeriesFromFamilies(own, "replica-a", now)
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Labels, []prompbLabel{{Name: "__name__", Value: "up"}, {Name: "instance", Value: "edge-eu1"}}) {
+		t.Errorf("series with an instance label = %+v, want it kept", got)
+	}
+}
+
+// TestRemoteWriter verifies auth headers, snappy-compressed payloads, retry
+// of queued batches after a 5xx, the bounded queue, and dropping batches the
+// endpoint rejects with a 4xx.
+func TestRemoteWriter(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	nodeLister := &fakeNodeLister{nodes: []*corev1.Node{makeNode("node-1", "4", "8Gi")}}
+	collector := NewBinpackingCollector(nodeLister, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	var (
+		mu       sync.Mutex
+		status   = http.StatusServiceUnavailable
+		received [][]prompbTimeSeries
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if user, pass, ok := r.BasicAuth(); !ok || user != "edge" || pass != "s3cret" {
+			t.Errorf("basic auth = %q, %q, %v", user, pass, ok)
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("snappy.Decode() error = %v", err)
+		}
+		received = append(received, decodeWriteRequest(t, data))
+	}))
+	defer server.Close()
+
+	metrics := NewExporterMetrics(prometheus.NewRegistry(), false)
+	writer := NewRemoteWriter(RemoteWriteConfig{
+		URL:       server.URL,
+		Interval:  time.Minute,
+		QueueSize: 2,
+		Username:  "edge",
+		Password:  "s3cret",
+	}, registry, server.Client(), metrics, logger)
+	ctx := t.Context()
+
+	// Endpoint down: batches queue up, the oldest is dropped beyond 2.
+	for i := range 3 {
+		writer.enqueue(time.UnixMilli(int64(i+1) * 1000))
+		if err := writer.flush(ctx); err == nil {
+			t.Fatal("flush() should fail while the endpoint returns 503")
+		}
+	}
+	if len(writer.queue) != 2 {
+		t.Fatalf("queue length = %d, want 2", len(writer.queue))
+	}
+	if got := testutil.ToFloat64(metrics.remoteWriteBatches.WithLabelValues(remoteWriteDropped)); got != 1 {
+		t.Errorf("dropped batches = %v, want 1", got)
+	}
+
+	// Endpoint back: the queued batches are sent oldest first.
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	if err := writer.flush(ctx); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if len(writer.queue) != 0 || len(received) != 2 {
+		t.Fatalf("queue = %d, received = %d, want 0 and 2", len(writer.queue), len(received))
+	}
+	if received[0][0].TimestampMs != 2000 || received[1][0].TimestampMs != 3000 {
+		t.Errorf("batch timestamps = %d, %d, want 2000, 3000", received[0][0].TimestampMs, received[1][0].TimestampMs)
+	}
+	if got := testutil.ToFloat64(metrics.remoteWriteSamples); got != float64(len(received[0])+len(received[1])) {
+		t.Errorf("samples sent = %v, want %d", got, len(received[0])+len(received[1]))
+	}
+
+	// A 4xx is not retryable: the batch is dropped.
+	mu.Lock()
+	status = http.StatusBadRequest
+	mu.Unlock()
+	writer.enqueue(time.Now())
+	if err := writer.flush(ctx); err != nil {
+		t.Errorf("flush() with a 400 should drop the batch, got error %v", err)
+	}
+	if len(writer.queue) != 0 {
+		t.Errorf("queue length after 400 = %d, want 0", len(writer.queue))
+	}
+}
+
+func TestRemoteWriter_BearerToken(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	writer := NewRemoteWriter(RemoteWriteConfig{URL: server.URL, QueueSize: 1, BearerToken: "abc"}, nil, server.Client(), nil, logger)
+	if _, err := writer.send(t.Context(), snappy.Encode(nil, encodeWriteRequest(nil))); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if auth != "Bearer abc" {
+		t.Errorf("Authorization = %q, want Bearer abc", auth)
+	}
+}
+
+// TestRemoteWriter_RunBackoff verifies ticks during a backoff queue batches
+// without sending them, so a failing endpoint is not hit every interval.
+func TestRemoteWriter_RunBackoff(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	nodeLister := &fakeNodeLister{nodes: []*corev1.Node{makeNode("node-1", "4", "8Gi")}}
+	collector := NewBinpackingCollector(nodeLister, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	writer := NewRemoteWriter(RemoteWriteConfig{URL: server.URL, Interval: 20 * time.Millisecond, QueueSize: 100},
+		registry, server.Client(), nil, logger)
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+	writer.Run(ctx)
+
+	// The first failure starts a backoff of remoteWriteMinBackoff, longer
+	// than the test runs.
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1 within the first backoff", got)
+	}
+	if len(writer.queue) < 2 {
+		t.Errorf("queue length = %d, want batches queued during the backoff", len(writer.queue))
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// shardGroupLabel marks the membership Leases of a sharding group. Its value
+// is the group name, so several independent deployments can share a namespace.
+const shardGroupLabel = "kube-binpacking-exporter.io/shard-group"
+
+// ShardConfig holds the configuration for node sharding.
+type ShardConfig struct {
+	Group         string // shared by all replicas of one deployment
+	Namespace     string
+	Identity      string
+	LeaseDuration time.Duration
+}
+
+// ShardMembership maintains this replica's membership Lease and discovers the
+// other live members of its group. Nodes are assigned to members by
+// rendezvous hashing, so every member computes the same assignment from the
+// same member list, and a membership change only moves the nodes of the
+// member that joined or left.
+type ShardMembership struct {
+	client kubernetes.Interface
+	config ShardConfig
+	logger *slog.Logger
+
+	mu            sync.RWMutex
+	members       []string // sorted identities of live members, including this one
+	lastHeartbeat time.Time
+
+	changes chan struct{} // signalled when the member list changes after Join
+}
+
+// NewShardMembership creates a membership for config. It owns no nodes until
+// the first successful heartbeat.
+func NewShardMembership(client kubernetes.Interface, config ShardConfig, logger *slog.Logger) *ShardMembership {
+	return &ShardMembership{client: client, config: config, logger: logger, changes: make(chan struct{}, 1)}
+}
+
+// Join performs the first heartbeat, so the node assignment is known before
+// the pod informer starts caching only this replica's pods.
+func (s *ShardMembership) Join(ctx context.Context) error {
+	return s.heartbeat(ctx)
+}
+
+// Changes is signalled whenever the member list, and so the node assignment,
+// changes. Signals are coalesced; the first member list is not signalled.
+func (s *ShardMembership) Changes() <-chan struct{} {
+	return s.changes
+}
+
+// Run heartbeats every third of the lease duration until the context is
+// cancelled, then deletes this replica's Lease so its nodes are reassigned
+// immediately rather than after the lease expires.
+func (s *ShardMembership) Run(ctx context.Context) {
+	s.logger.Info("starting node sharding",
+		"group", s.config.Group,
+		"namespace", s.config.Namespace,
+		"identity", s.config.Identity,
+		"lease_duration", s.config.LeaseDuration)
+
+	ticker := time.NewTicker(s.config.LeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		if err := s.heartbeat(ctx); err != nil {
+			s.logger.Warn("shard heartbeat failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			s.leave()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ShardMembership) leaseName() string {
+	return s.config.Group + "-" + s.config.Identity
+}
+
+// heartbeat renews this replica's Lease and refreshes the member list.
+func (s *ShardMembership) heartbeat(ctx context.Context) error {
+	now := time.Now()
+	if err := s.renew(ctx, now); err != nil {
+		return fmt.Errorf("renewing shard lease: %w", err)
+	}
+
+	leases, err := s.client.CoordinationV1().Leases(s.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: shardGroupLabel + "=" + s.config.Group,
+	})
+	if err != nil {
+		return fmt.Errorf("listing shard leases: %w", err)
+	}
+
+	members := []string{s.config.Identity}
+	for _, lease := range leases.Items {
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == s.config.Identity {
+			continue
+		}
+		if leaseLive(&lease, now) {
+			members = append(members, *lease.Spec.HolderIdentity)
+		}
+	}
+	sort.Strings(members)
+
+	s.mu.Lock()
+	joined := s.members != nil
+	changed := !slices.Equal(s.members, members)
+	s.members = members
+	s.lastHeartbeat = now
+	s.mu.Unlock()
+
+	if changed {
+		s.logger.Info("shard membership changed", "members", members)
+		if joined {
+			select {
+			case s.changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// renew creates or updates this replica's membership Lease.
+func (s *ShardMembership) renew(ctx context.Context, now time.Time) error {
+	leases := s.client.CoordinationV1().Leases(s.config.Namespace)
+	renewTime := metav1.NewMicroTime(now)
+	durationSeconds := int32(s.config.LeaseDuration.Seconds())
+	identity := s.config.Identity
+
+	lease, err := leases.Get(ctx, s.leaseName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.leaseName(),
+				Namespace: s.config.Namespace,
+				Labels:    map[string]string{shardGroupLabel: s.config.Group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &renewTime,
+				RenewTime:            &renewTime,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &renewTime
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// leave deletes this replica's Lease on shutdown (best effort).
+func (s *ShardMembership) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.client.CoordinationV1().Leases(s.config.Namespace).Delete(ctx, s.leaseName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		s.logger.Warn("failed to delete shard lease", "error", err)
+	}
+}
+
+// Members returns the live members of the group. It returns nil when this
+// replica has not heartbeated within the lease duration: the others will
+// have dropped it by then, so it must stop claiming nodes to avoid double
+// counting.
+func (s *ShardMembership) Members() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if time.Since(s.lastHeartbeat) > s.config.LeaseDuration {
+		return nil
+	}
+	return s.members
+}
+
+// Owns reports whether this replica is responsible for a node.
+func (s *ShardMembership) Owns(nodeName string) bool {
+	return shardOwner(s.Members(), nodeName) == s.config.Identity
+}
+
+// Assignment returns the last member list, even if it is older than the
+// lease duration. It decides which pods are cached: unlike Members, it must
+// not drop every pod while heartbeats fail, since they would not come back
+// until the pod informer is rebuilt.
+func (s *ShardMembership) Assignment() shardAssignment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return shardAssignment{members: s.members, identity: s.config.Identity}
+}
+
+// shardAssignment is a member list as seen by one replica.
+type shardAssignment struct {
+	members  []string
+	identity string
+}
+
+// owns reports whether a node is assigned to the replica by the member list.
+func (a shardAssignment) owns(nodeName string) bool {
+	return shardOwner(a.members, nodeName) == a.identity
+}
+
+// shardOwner returns the member responsible for a node using rendezvous
+// (highest random weight) hashing, or "" if there are no members.
+func shardOwner(members []string, nodeName string) string {
+	var owner string
+	var best uint64
+	for _, member := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(member))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(nodeName))
+		if w := mix64(h.Sum64()); owner == "" || w > best {
+			owner, best = member, w
+		}
+	}
+	return owner
+}
+
+// mix64 is the MurmurHash3 finalizer. FNV alone barely changes its high
+// bits for inputs that differ only in a leading byte, which would give one
+// member nearly every node.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// leaseLive reports whether a Lease was renewed within its duration.
+func leaseLive(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.Before(expiry)
+}
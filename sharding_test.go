@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestShard(t *testing.T, clientset *fake.Clientset, identity string) *ShardMembership {
+	t.Helper()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewShardMembership(clientset, ShardConfig{
+		Group:         "kbe",
+		Namespace:     "default",
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+	}, logger)
+}
+
+// TestShardOwner verifies rendezvous hashing spreads nodes across members and
+// that adding a member only moves nodes to the new member.
+func TestShardOwner(t *testing.T) {
+	if got := shardOwner(nil, "node-1"); got != "" {
+		t.Errorf("shardOwner() with no members = %q, want empty", got)
+	}
+
+	nodes := make([]string, 300)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%d", i)
+	}
+
+	before := []string{"a", "b", "c"}
+	counts := map[string]int{}
+	for _, node := range nodes {
+		counts[shardOwner(before, node)]++
+	}
+	for _, member := range before {
+		if counts[member] < 50 {
+			t.Errorf("member %s owns %d of %d nodes, want a roughly even share", member, counts[member], len(nodes))
+		}
+	}
+
+	after := []string{"a", "b", "c", "d"}
+	for _, node := range nodes {
+		old, cur := shardOwner(before, node), shardOwner(after, node)
+		if old != cur && cur != "d" {
+			t.Errorf("node %s moved from %s to %s, want moves only to the new member", node, old, cur)
+		}
+	}
+}
+
+// TestShardMembership_Heartbeat verifies replicas discover each other through
+// their Leases and partition nodes between them without overlap.
+func TestShardMembership_Heartbeat(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	a, b := newTestShard(t, clientset, "replica-a"), newTestShard(t, clientset, "replica-b")
+
+	if a.Owns("node-1") {
+		t.Error("Owns() before the first heartbeat should be false")
+	}
+
+	for _, s := range []*ShardMembership{a, b, a} {
+		if err := s.heartbeat(ctx); err != nil {
+			t.Fatalf("heartbeat() error = %v", err)
+		}
+	}
+	if got := a.Members(); len(got) != 2 {
+		t.Fatalf("Members() = %v, want both replicas", got)
+	}
+
+	for i := 0; i < 50; i++ {
+		node := fmt.Sprintf("node-%d", i)
+		if a.Owns(node) == b.Owns(node) {
+			t.Errorf("node %s: owned by a=%v b=%v, want exactly one owner", node, a.Owns(node), b.Owns(node))
+		}
+	}
+
+	// A replica that leaves is dropped on the next heartbeat.
+	b.leave()
+	if err := a.heartbeat(ctx); err != nil {
+		t.Fatalf("heartbeat() error = %v", err)
+	}
+	if got := a.Members(); len(got) != 1 || got[0] != "replica-a" {
+		t.Errorf("Members() after leave = %v, want [replica-a]", got)
+	}
+}
+
+// TestShardMembership_ExpiredLease verifies Leases that were not renewed
+// within their duration, or belong to another group, are ignored.
+func TestShardMembership_ExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	fresh := metav1.NewMicroTime(time.Now())
+	duration := int32(15)
+	lease := func(name, group, holder string, renew metav1.MicroTime) *coordinationv1.Lease {
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{shardGroupLabel: group}},
+			Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder, RenewTime: &renew, LeaseDurationSeconds: &duration},
+		}
+	}
+	clientset := fake.NewClientset(
+		lease("kbe-dead", "kbe", "dead", expired),
+		lease("other-live", "other", "live", fresh),
+	)
+
+	s := newTestShard(t, clientset, "replica-a")
+	if err := s.heartbeat(ctx); err != nil {
+		t.Fatalf("heartbeat() error = %v", err)
+	}
+	if got := s.Members(); len(got) != 1 || got[0] != "replica-a" {
+		t.Errorf("Members() = %v, want [replica-a]", got)
+	}
+
+	// Without a recent heartbeat the replica must stop claiming nodes.
+	s.lastHeartbeat = time.Now().Add(-time.Minute)
+	if got := s.Members(); got != nil {
+		t.Errorf("Members() after missed heartbeats = %v, want nil", got)
+	}
+}
+
+// TestBinpackingCollector_Sharded verifies each replica emits per-node
+// metrics only for its nodes and cluster partial sums that add up to the
+// unsharded totals.
+func TestBinpackingCollector_Sharded(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	a, b := newTestShard(t, clientset, "replica-a"), newTestShard(t, clientset, "replica-b")
+	for _, s := range []*ShardMembership{a, b, a} {
+		if err := s.heartbeat(ctx); err != nil {
+			t.Fatalf("heartbeat() error = %v", err)
+		}
+	}
+
+	var nodes []*corev1.Node
+	var pods []*corev1.Pod
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("node-%d", i)
+		nodes = append(nodes, makeNode(name, "4", "8Gi"))
+		pods = append(pods, makePodWithResources("default", "pod-"+name, name, corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil))
+	}
+	resources := []corev1.ResourceName{corev1.ResourceCPU}
+	cpu := map[string]string{"resource": "cpu"}
+
+	var nodeCount, allocated float64
+	for _, s := range []*ShardMembership{a, b} {
+		collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{pods: pods},
+			logger, resources, nil, true, nil, nil, WithShard(s, nil))
+		metrics := collectMetrics(collector)
+
+		owned, _ := findMetricValue(t, metrics, "kube_binpacking_shard_owned_nodes", nil)
+		count, _ := findMetricValue(t, metrics, "kube_binpacking_cluster_node_count", nil)
+		if owned != count {
+			t.Errorf("%s: shard_owned_nodes = %v, cluster_node_count = %v, want equal", s.config.Identity, owned, count)
+		}
+		if members, _ := findMetricValue(t, metrics, "kube_binpacking_shard_members", nil); members != 2 {
+			t.Errorf("%s: shard_members = %v, want 2", s.config.Identity, members)
+		}
+		for _, node := range nodes {
+			_, emitted := findMetricValue(t, metrics, "kube_binpacking_node_allocated",
+				map[string]string{"node": node.Name, "resource": "cpu"})
+			if emitted != s.Owns(node.Name) {
+				t.Errorf("%s: node_allocated{node=%s} emitted = %v, want %v", s.config.Identity, node.Name, emitted, s.Owns(node.Name))
+			}
+		}
+
+		nodeCount += count
+		v, _ := findMetricValue(t, metrics, "kube_binpacking_cluster_allocated", cpu)
+		allocated += v
+	}
+
+	if nodeCount != 10 {
+		t.Errorf("summed cluster_node_count = %v, want 10", nodeCount)
+	}
+	if !floatEquals(allocated, 10) {
+		t.Errorf("summed cluster_allocated{cpu} = %v, want 10", allocated)
+	}
+}
+
+// TestBinpackingCollector_ShardCached verifies nodes are assigned by the
+// member list the pod cache was built with, not the latest membership, and
+// that a replica that missed its heartbeats claims no nodes.
+func TestBinpackingCollector_ShardCached(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	a, b := newTestShard(t, clientset, "replica-a"), newTestShard(t, clientset, "replica-b")
+	for _, s := range []*ShardMembership{a, b, a} {
+		if err := s.heartbeat(ctx); err != nil {
+			t.Fatalf("heartbeat() error = %v", err)
+		}
+	}
+
+	var nodes []*corev1.Node
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, makeNode(fmt.Sprintf("node-%d", i), "4", "8Gi"))
+	}
+	// The pod cache was built before replica-b joined.
+	cached := func() []string { return []string{"replica-a"} }
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{},
+		logger, []corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil, WithShard(a, cached))
+
+	metrics := collectMetrics(collector)
+	if owned, _ := findMetricValue(t, metrics, "kube_binpacking_shard_owned_nodes", nil); owned != 10 {
+		t.Errorf("shard_owned_nodes = %v, want all 10 nodes by the cached member list", owned)
+	}
+	if members, _ := findMetricValue(t, metrics, "kube_binpacking_shard_members", nil); members != 2 {
+		t.Errorf("shard_members = %v, want the 2 live members", members)
+	}
+
+	a.lastHeartbeat = time.Now().Add(-time.Minute)
+	metrics = collectMetrics(collector)
+	if owned, _ := findMetricValue(t, metrics, "kube_binpacking_shard_owned_nodes", nil); owned != 0 {
+		t.Errorf("shard_owned_nodes after missed heartbeats = %v, want 0", owned)
+	}
+}
+
+// TestShardMembership_Changes verifies a membership change after joining is
+// signalled, so the pod cache is rebuilt, and that Assignment keeps the last
+// member list while heartbeats fail.
+func TestShardMembership_Changes(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	a, b := newTestShard(t, clientset, "replica-a"), newTestShard(t, clientset, "replica-b")
+
+	if err := a.Join(ctx); err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	select {
+	case <-a.Changes():
+		t.Error("joining should not be signalled as a change")
+	default:
+	}
+	if !a.Assignment().owns("node-1") {
+		t.Error("a single member should be assigned every node")
+	}
+
+	if err := b.Join(ctx); err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	if err := a.heartbeat(ctx); err != nil {
+		t.Fatalf("heartbeat() error = %v", err)
+	}
+	select {
+	case <-a.Changes():
+	default:
+		t.Error("a new member should be signalled as a change")
+	}
+
+	a.lastHeartbeat = time.Now().Add(-time.Minute)
+	var assigned int
+	for i := range 50 {
+		if a.Assignment().owns(fmt.Sprintf("node-%d", i)) {
+			assigned++
+		}
+		if a.Owns(fmt.Sprintf("node-%d", i)) {
+			t.Fatal("Owns() should be false after missed heartbeats")
+		}
+	}
+	if assigned == 0 || assigned == 50 {
+		t.Errorf("Assignment() after missed heartbeats = %d of 50 nodes, want the last two-member share", assigned)
+	}
+}
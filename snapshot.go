@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// binpackingSnapshot is an immutable binpacking result computed at one point
+// in time, with its metrics rendered once. Every scrape and API request
+// served from it sees the same values.
+type binpackingSnapshot struct {
+	result     *binpackingResult
+	metrics    []prometheus.Metric
+	computedAt time.Time
+	duration   time.Duration
+}
+
+// WithSnapshotInterval enables snapshot mode: binpacking metrics are computed
+// in the background every interval by RunSnapshots, and Collect serves the
+// latest snapshot instead of computing on each scrape.
+func WithSnapshotInterval(interval time.Duration) CollectorOption {
+	return func(c *BinpackingCollector) {
+		c.snapshotInterval = interval
+	}
+}
+
+// snapshotPromotionPoll is how often a standby checks whether it has been
+// promoted, so a new leader serves a snapshot without waiting a full interval.
+const snapshotPromotionPoll = time.Second
+
+// RunSnapshots computes a snapshot immediately and then every snapshot
+// interval until the context is cancelled. It is a no-op when snapshot mode is
+// disabled. Standby replicas serve no snapshot, so they skip the refresh and
+// drop any snapshot from an earlier term; once promoted they compute one
+// within snapshotPromotionPoll.
+func (c *BinpackingCollector) RunSnapshots(ctx context.Context) {
+	if c.snapshotInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.snapshotInterval)
+	defer ticker.Stop()
+	var promotion <-chan time.Time
+	if c.isLeader != nil {
+		poll := time.NewTicker(snapshotPromotionPoll)
+		defer poll.Stop()
+		promotion = poll.C
+	}
+
+	c.refreshIfLeader()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refreshIfLeader()
+		case <-promotion:
+			if c.isLeader.Load() && c.snapshot.Load() == nil {
+				c.refreshIfLeader()
+			}
+		}
+	}
+}
+
+// refreshIfLeader refreshes the snapshot, or drops it on a standby replica.
+// Refreshes are serialized, so a snapshot computed with older settings is
+// never stored after one computed with newer settings.
+func (c *BinpackingCollector) refreshIfLeader() {
+	c.snapshotMu.Lock()
+	defer c.snapshotMu.Unlock()
+	if c.isLeader != nil && !c.isLeader.Load() {
+		c.snapshot.Store(nil)
+		return
+	}
+	c.refreshSnapshot()
+}
+
+// refreshSnapshot computes a new snapshot and publishes it atomically. If the
+// computation fails the previous snapshot is kept, and its age keeps growing.
+func (c *BinpackingCollector) refreshSnapshot() {
+	start := time.Now()
+	result := c.computeBinpacking()
+	if result == nil {
+		return
+	}
+	metrics := c.renderBinpacking(result)
+	snap := &binpackingSnapshot{
+		result:     result,
+		metrics:    metrics,
+		computedAt: time.Now(),
+		duration:   time.Since(start),
+	}
+	c.snapshot.Store(snap)
+	c.exporterMetrics.observeCollect(snap.duration, result.cluster.nodeCount, result.stats)
+	c.logger.Debug("computed binpacking snapshot", "metric_count", len(metrics), "duration", snap.duration)
+}
+
+// renderBinpacking returns the metrics emitBinpacking emits for result.
+func (c *BinpackingCollector) renderBinpacking(result *binpackingResult) []prometheus.Metric {
+	ch := make(chan prometheus.Metric, 256)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+	c.emitBinpacking(ch, result)
+	close(ch)
+	return <-done
+}
+
+// currentBinpacking returns the latest snapshot in snapshot mode, or a result
+// computed on demand otherwise, without rendered metrics. On-demand results
+// are not recorded in the collect self-metrics, which only track scrapes and
+// snapshot refreshes. It returns nil before the first snapshot or if the
+// computation fails.
+func (c *BinpackingCollector) currentBinpacking() *binpackingSnapshot {
+	if c.snapshotInterval > 0 {
+		return c.snapshot.Load()
+	}
+	start := time.Now()
+	result := c.computeBinpacking()
+	if result == nil {
+		return nil
+	}
+	return &binpackingSnapshot{result: result, computedAt: time.Now(), duration: time.Since(start)}
+}
+
+// collectSnapshot emits the latest snapshot. Until the first snapshot is
+// computed only the gate metrics (cache age, leader status) are emitted.
+func (c *BinpackingCollector) collectSnapshot(ch chan<- prometheus.Metric) {
+	snap := c.snapshot.Load()
+	if snap == nil {
+		c.logger.Debug("no binpacking snapshot computed yet")
+		return
+	}
+	for _, m := range snap.metrics {
+		ch <- m
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc.snapshotAge, prometheus.GaugeValue, time.Since(snap.computedAt).Seconds())
+	ch <- prometheus.MustNewConstMetric(c.desc.snapshotComputeDuration, prometheus.GaugeValue, snap.duration.Seconds())
+}
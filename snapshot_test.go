@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TestBinpackingCollector_SnapshotMode verifies that scrapes serve the latest
+// background snapshot rather than the current cache state.
+func TestBinpackingCollector_SnapshotMode(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	nodes := []*corev1.Node{makeNode("node-1", "4", "8Gi")}
+	podLister := &fakePodLister{pods: []*corev1.Pod{
+		makePodWithResources("default", "app", "node-1", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "1", "1Gi")}, nil),
+	}}
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, podLister, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil, WithSnapshotInterval(time.Minute))
+
+	clusterCPU := map[string]string{"resource": "cpu"}
+
+	// Before the first snapshot only gate metrics are emitted.
+	metrics := collectMetrics(collector)
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_cluster_allocated", clusterCPU); ok {
+		t.Error("binpacking metrics should not be emitted before the first snapshot")
+	}
+
+	collector.refreshSnapshot()
+	metrics = collectMetrics(collector)
+	if got, ok := findMetricValue(t, metrics, "kube_binpacking_cluster_allocated", clusterCPU); !ok || got != 1 {
+		t.Errorf("cluster_allocated = %v (emitted=%v), want 1", got, ok)
+	}
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_snapshot_age_seconds", nil); !ok {
+		t.Error("snapshot_age_seconds not emitted")
+	}
+	if _, ok := findMetricValue(t, metrics, "kube_binpacking_snapshot_compute_duration_seconds", nil); !ok {
+		t.Error("snapshot_compute_duration_seconds not emitted")
+	}
+
+	// Cache changes are not visible until the next snapshot.
+	podLister.pods = append(podLister.pods, makePodWithResources("default", "app-2", "node-1", corev1.PodRunning,
+		[]corev1.Container{makeContainer("app", "2", "1Gi")}, nil))
+	if got, _ := findMetricValue(t, collectMetrics(collector), "kube_binpacking_cluster_allocated", clusterCPU); got != 1 {
+		t.Errorf("cluster_allocated = %v before refresh, want snapshot value 1", got)
+	}
+	collector.refreshSnapshot()
+	if got, _ := findMetricValue(t, collectMetrics(collector), "kube_binpacking_cluster_allocated", clusterCPU); got != 3 {
+		t.Errorf("cluster_allocated = %v after refresh, want 3", got)
+	}
+
+	t.Run("standby serves no snapshot", func(t *testing.T) {
+		isLeader := new(atomic.Bool)
+		standby := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, podLister, logger,
+			[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, isLeader, WithSnapshotInterval(time.Minute))
+		standby.refreshSnapshot()
+		if _, ok := findMetricValue(t, collectMetrics(standby), "kube_binpacking_cluster_allocated", nil); ok {
+			t.Error("standby should not emit binpacking metrics")
+		}
+	})
+}
+
+// TestRunSnapshots verifies the first snapshot is computed immediately, and
+// that RunSnapshots and Reconfigure do not compute snapshots on standby
+// replicas, nor outside snapshot mode.
+func TestRunSnapshots(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	nodes := []*corev1.Node{makeNode("node-1", "4", "8Gi")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil, WithSnapshotInterval(time.Hour))
+	collector.RunSnapshots(ctx)
+	if collector.snapshot.Load() == nil {
+		t.Error("RunSnapshots should compute a snapshot before waiting for the first tick")
+	}
+
+	isLeader := new(atomic.Bool)
+	standby := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, isLeader, WithSnapshotInterval(time.Hour))
+	standby.refreshSnapshot() // left over from an earlier term
+	standby.RunSnapshots(ctx)
+	if standby.snapshot.Load() != nil {
+		t.Error("RunSnapshots should drop the snapshot and not compute one on a standby replica")
+	}
+
+	standby.Reconfigure(standby.Settings())
+	if standby.snapshot.Load() != nil {
+		t.Error("Reconfigure should not compute a snapshot on a standby replica")
+	}
+	isLeader.Store(true)
+	standby.Reconfigure(standby.Settings())
+	if standby.snapshot.Load() == nil {
+		t.Error("Reconfigure should recompute the snapshot on the leader")
+	}
+
+	disabled := NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, nil)
+	disabled.RunSnapshots(ctx)
+	if disabled.snapshot.Load() != nil {
+		t.Error("RunSnapshots should not compute snapshots when snapshot mode is disabled")
+	}
+}
+
+// TestRunSnapshots_Promotion verifies a standby promoted to leader computes a
+// snapshot without waiting for the next interval.
+func TestRunSnapshots_Promotion(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	isLeader := new(atomic.Bool)
+	collector := NewBinpackingCollector(&fakeNodeLister{nodes: []*corev1.Node{makeNode("node-1", "4", "8Gi")}}, &fakePodLister{}, logger,
+		[]corev1.ResourceName{corev1.ResourceCPU}, nil, true, nil, isLeader, WithSnapshotInterval(time.Hour))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		collector.RunSnapshots(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	isLeader.Store(true)
+	deadline := time.Now().Add(3 * snapshotPromotionPoll)
+	for collector.snapshot.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("promoted replica did not compute a snapshot")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
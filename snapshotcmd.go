@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// snapshotBarWidth is the number of cells in a utilization bar.
+const snapshotBarWidth = 20
+
+// snapshotOutputs are the formats the snapshot subcommand prints.
+var snapshotOutputs = []string{"table", "json", "yaml", "csv", "prometheus"}
+
+// snapshotOptions are the snapshot subcommand's own flags. Every exporter
+// flag that shapes the computation (--resources, --label-group,
+// --node-selector, --config, ...) applies as well.
+type snapshotOptions struct {
+	context   string
+	fromFiles stringSliceFlag
+	output    string
+	sortBy    string
+	filter    string
+}
+
+func (s *snapshotOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.context, "context", "", "kubeconfig context to connect with (default: the current context)")
+	fs.Var(&s.fromFiles, "from-file", "compute from kubectl get nodes,pods -o json|yaml output instead of a cluster: a file, or a directory of them (repeatable)")
+	fs.StringVar(&s.output, "output", "table", "output format: table, json, yaml, csv, or prometheus for every metric in the text format (unsorted and unfiltered)")
+	fs.StringVar(&s.sortBy, "sort", "name", "sort nodes and group values by name, or by a resource's utilization, highest first (e.g., cpu)")
+	fs.StringVar(&s.filter, "filter", "", "only show nodes, group values and selector groups whose name matches this regular expression")
+}
+
+// snapshotReport is what the snapshot subcommand prints.
+type snapshotReport struct {
+	Cluster *apiCluster `json:"cluster"`
+	Nodes   []*apiNode  `json:"nodes"`
+	Groups  []*apiGroup `json:"groups"`
+}
+
+// runSnapshot runs the snapshot subcommand: it connects like the exporter and
+// syncs the informer caches once, or reads --from-file dumps, computes
+// binpacking with the collector and prints the result. It returns the process
+// exit code.
+func runSnapshot(args []string, stdout, stderr io.Writer) int {
+	var snap snapshotOptions
+	opts, err := parseCommandOptions("kube-binpacking-exporter snapshot", args, snap.register)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	// Progress logs would drown the report, so only warnings are shown
+	// unless --log-level is set.
+	level := slog.LevelWarn
+	if opts.sources["log-level"] != "default" {
+		level = parseLogLevel(opts.logLevel)
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+
+	settings, err := opts.collectorSettings()
+	if err != nil {
+		fmt.Fprintln(stderr, "invalid configuration:", err)
+		return 2
+	}
+	filter, err := snap.validate(settings)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	var (
+		nodeLister listerscorev1.NodeLister
+		podLister  listerscorev1.PodLister
+	)
+	if len(snap.fromFiles) > 0 {
+		nodeLister, podLister, err = newFileListers(snap.fromFiles, opts.nodeSelector)
+		if err != nil {
+			fmt.Fprintln(stderr, "failed to load --from-file:", err)
+			return 1
+		}
+	} else {
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+		nodes, pods, _, _, _, err := setupKubernetes(ctx, logger, opts.kubeconfig, snap.context, 0, int64(opts.listPageSize), opts.nodeSelector, nodeFieldsFor(settings.LabelGroups), false, nil)
+		if err != nil {
+			fmt.Fprintln(stderr, "failed to sync from the cluster:", err)
+			return 1
+		}
+		nodeLister, podLister = nodes, pods
+	}
+
+	collector := NewBinpackingCollector(nodeLister, podLister, logger, nil, nil, false, nil, nil)
+	collector.Reconfigure(settings)
+	if snap.output == "prometheus" {
+		if err := writeMetricsText(stdout, collector); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	view, err := collector.currentView()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	report := newSnapshotReport(view, &settings, snap.sortBy, filter)
+	if err := writeSnapshotReport(stdout, report, settings.Resources, snap.output); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// validate checks the output format and sort key, and compiles the filter
+// (nil when unset).
+func (s *snapshotOptions) validate(settings CollectorSettings) (*regexp.Regexp, error) {
+	if len(s.fromFiles) > 0 && s.context != "" {
+		return nil, errors.New("--context cannot be combined with --from-file")
+	}
+	if !slices.Contains(snapshotOutputs, s.output) {
+		return nil, fmt.Errorf("invalid --output %q, must be one of %s", s.output, strings.Join(snapshotOutputs, ", "))
+	}
+	if s.sortBy != "name" && !slices.Contains(settings.Resources, corev1.ResourceName(s.sortBy)) {
+		return nil, fmt.Errorf("invalid --sort %q, must be name or a tracked resource", s.sortBy)
+	}
+	if s.filter == "" {
+		return nil, nil
+	}
+	filter, err := regexp.Compile(s.filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --filter: %w", err)
+	}
+	return filter, nil
+}
+
+// newSnapshotReport orders and filters view: label groups in configuration
+// order followed by selector groups, nodes and group values sorted by name or
+// by sortBy's utilization.
+func newSnapshotReport(view *binpackingView, s *CollectorSettings, sortBy string, filter *regexp.Regexp) *snapshotReport {
+	matches := func(name string) bool { return filter == nil || filter.MatchString(name) }
+	utilization := func(resources map[string]*apiResource) float64 {
+		if r := resources[sortBy]; r != nil {
+			return r.UtilizationRatio
+		}
+		return -1
+	}
+
+	report := &snapshotReport{Cluster: view.cluster, Nodes: []*apiNode{}, Groups: []*apiGroup{}}
+	for _, node := range view.nodes {
+		if matches(node.Name) {
+			report.Nodes = append(report.Nodes, node)
+		}
+	}
+	slices.SortFunc(report.Nodes, func(a, b *apiNode) int {
+		if sortBy != "name" {
+			if c := compareDesc(utilization(a.Resources), utilization(b.Resources)); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for _, g := range s.LabelGroups {
+		group := view.labelGroups[g.Name]
+		group.Values = slices.DeleteFunc(group.Values, func(v *apiGroupValue) bool { return !matches(v.Value) })
+		if sortBy != "name" {
+			slices.SortStableFunc(group.Values, func(a, b *apiGroupValue) int {
+				return compareDesc(utilization(a.Resources), utilization(b.Resources))
+			})
+		}
+		report.Groups = append(report.Groups, group)
+	}
+	for _, g := range s.SelectorGroups {
+		if group := view.selectorGroups[g.Name]; group != nil && matches(g.Name) {
+			report.Groups = append(report.Groups, group)
+		}
+	}
+	return report
+}
+
+func compareDesc(a, b float64) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return 0
+}
+
+// writeSnapshotReport prints report in format; resources are the table and
+// CSV columns, in order.
+func writeSnapshotReport(w io.Writer, report *snapshotReport, resources []corev1.ResourceName, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "yaml":
+		out, err := yaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case "csv":
+		return writeSnapshotCSV(w, report, resources)
+	default:
+		return writeSnapshotTable(w, report, resources)
+	}
+}
+
+// writeMetricsText prints what the collector emits on a scrape in the
+// Prometheus text format.
+func writeMetricsText(w io.Writer, collector prometheus.Collector) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		return err
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	enc := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSnapshotTable prints one section for the cluster, the nodes and each
+// group, with a utilization bar, percentage and allocated/allocatable per
+// resource:
+//
+//	NODE    CPU
+//	node-a  █████░░░░░░░░░░░░░░░   25.0%  1/4
+func writeSnapshotTable(w io.Writer, report *snapshotReport, resources []corev1.ResourceName) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	// Empty trailing cells would be padded into trailing spaces.
+	writeRow := func(cols []string) {
+		for len(cols) > 1 && cols[len(cols)-1] == "" {
+			cols = cols[:len(cols)-1]
+		}
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	header := func(first string, withNodes bool) {
+		cols := []string{first}
+		if withNodes {
+			cols = append(cols, "NODES")
+		}
+		for _, res := range resources {
+			cols = append(cols, strings.ToUpper(string(res)), "", "")
+		}
+		writeRow(cols)
+	}
+	row := func(name string, nodeCount *int, values map[string]*apiResource) {
+		cols := []string{name}
+		if nodeCount != nil {
+			cols = append(cols, strconv.Itoa(*nodeCount))
+		}
+		for _, res := range resources {
+			r := values[string(res)]
+			if r == nil {
+				cols = append(cols, "-", "", "")
+				continue
+			}
+			cols = append(cols,
+				utilizationBar(r.UtilizationRatio),
+				fmt.Sprintf("%5.1f%%", r.UtilizationRatio*100),
+				formatAmount(res, r.Allocated)+"/"+formatAmount(res, r.Allocatable))
+		}
+		writeRow(cols)
+	}
+
+	header("CLUSTER", true)
+	row("cluster", &report.Cluster.NodeCount, report.Cluster.Resources)
+	if len(report.Nodes) > 0 {
+		fmt.Fprintln(tw)
+		header("NODE", false)
+		for _, node := range report.Nodes {
+			row(node.Name, nil, node.Resources)
+		}
+	}
+	for _, g := range report.Groups {
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "%s GROUP %s\n", strings.ToUpper(g.Kind), g.Name)
+		header("VALUE", true)
+		for _, v := range g.Values {
+			name := v.Value
+			if g.Kind == "selector" {
+				name = g.Name
+			}
+			row(name, &v.NodeCount, v.Resources)
+		}
+	}
+	return tw.Flush()
+}
+
+// writeSnapshotCSV prints one row per resource of the cluster, every node
+// and every group value. Omitted optional values are left empty.
+func writeSnapshotCSV(w io.Writer, report *snapshotReport, resources []corev1.ResourceName) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"kind", "group", "name", "node_count", "resource", "allocated", "allocatable", "utilization_ratio", "daemonset_overhead", "daemonset_overhead_ratio"})
+	rows := func(kind, group, name, nodeCount string, values map[string]*apiResource) {
+		for _, res := range resources {
+			r := values[string(res)]
+			if r == nil {
+				continue
+			}
+			_ = cw.Write([]string{kind, group, name, nodeCount, string(res),
+				formatFloat(r.Allocated), formatFloat(r.Allocatable), formatFloat(r.UtilizationRatio),
+				formatOptional(r.DaemonsetOverhead), formatOptional(r.DaemonsetOverheadRatio)})
+		}
+	}
+
+	rows("cluster", "", "", strconv.Itoa(report.Cluster.NodeCount), report.Cluster.Resources)
+	for _, node := range report.Nodes {
+		rows("node", "", node.Name, "1", node.Resources)
+	}
+	for _, g := range report.Groups {
+		for _, v := range g.Values {
+			rows(g.Kind, g.Name, v.Value, strconv.Itoa(v.NodeCount), v.Resources)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// utilizationBar draws ratio as a bar of snapshotBarWidth cells, full at 1.0
+// and above.
+func utilizationBar(ratio float64) string {
+	filled := int(math.Round(min(max(ratio, 0), 1) * snapshotBarWidth))
+	return strings.Repeat("█", filled) + strings.Repeat("░", snapshotBarWidth-filled)
+}
+
+// formatAmount formats a resource amount for the table: byte resources with
+// binary suffixes (1.5Gi), others with up to two decimals.
+func formatAmount(res corev1.ResourceName, v float64) string {
+	if res != corev1.ResourceMemory && res != corev1.ResourceEphemeralStorage && !strings.HasPrefix(string(res), corev1.ResourceHugePagesPrefix) {
+		return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+	}
+	units := []string{"", "Ki", "Mi", "Gi", "Ti", "Pi"}
+	i := 0
+	for math.Abs(v) >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64) + units[i]
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatOptional(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// newTestSnapshotReport returns the report for newAPITestCollector. mutate,
+// if set, edits the view first.
+func newTestSnapshotReport(t *testing.T, sortBy string, filter *regexp.Regexp, mutate func(*binpackingView)) (*snapshotReport, []corev1.ResourceName) {
+	t.Helper()
+	collector := newAPITestCollector()
+	view, err := collector.currentView()
+	if err != nil {
+		t.Fatalf("currentView() error = %v", err)
+	}
+	if mutate != nil {
+		mutate(view)
+	}
+	s := collector.Settings()
+	return newSnapshotReport(view, &s, sortBy, filter), s.Resources
+}
+
+func TestNewSnapshotReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		sortBy     string
+		filter     *regexp.Regexp
+		mutate     func(*binpackingView)
+		wantNodes  []string
+		wantValues []string // zone label group values
+		wantGroups int
+	}{
+		{name: "by name", sortBy: "name", wantNodes: []string{"node-a", "node-b"}, wantValues: []string{"a", "b"}, wantGroups: 2},
+		{
+			name:   "by cpu",
+			sortBy: "cpu",
+			mutate: func(v *binpackingView) {
+				v.nodes["node-b"].Resources["cpu"].UtilizationRatio = 0.9
+				v.labelGroups["topology.kubernetes.io/zone"].Values[1].Resources["cpu"].UtilizationRatio = 0.9
+			},
+			wantNodes:  []string{"node-b", "node-a"},
+			wantValues: []string{"b", "a"},
+			wantGroups: 2,
+		},
+		{name: "filtered", sortBy: "name", filter: regexp.MustCompile("b$"), wantNodes: []string{"node-b"}, wantValues: []string{"b"}, wantGroups: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, _ := newTestSnapshotReport(t, tt.sortBy, tt.filter, tt.mutate)
+			var nodes []string
+			for _, n := range report.Nodes {
+				nodes = append(nodes, n.Name)
+			}
+			if strings.Join(nodes, ",") != strings.Join(tt.wantNodes, ",") {
+				t.Errorf("nodes = %v, want %v", nodes, tt.wantNodes)
+			}
+			if len(report.Groups) != tt.wantGroups {
+				t.Fatalf("groups = %d, want %d", len(report.Groups), tt.wantGroups)
+			}
+			var values []string
+			for _, v := range report.Groups[0].Values {
+				values = append(values, v.Value)
+			}
+			if strings.Join(values, ",") != strings.Join(tt.wantValues, ",") {
+				t.Errorf("zone values = %v, want %v", values, tt.wantValues)
+			}
+		})
+	}
+}
+
+// TestWriteSnapshotReport checks every output format carries the same
+// numbers.
+func TestWriteSnapshotReport(t *testing.T) {
+	report, resources := newTestSnapshotReport(t, "name", nil, nil)
+	render := func(format string) string {
+		var buf bytes.Buffer
+		if err := writeSnapshotReport(&buf, report, resources, format); err != nil {
+			t.Fatalf("writeSnapshotReport(%s) error = %v", format, err)
+		}
+		return buf.String()
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var got snapshotReport
+		if err := json.Unmarshal([]byte(render("json")), &got); err != nil {
+			t.Fatalf("decoding JSON: %v", err)
+		}
+		if got.Cluster.NodeCount != 2 || len(got.Nodes) != 2 || got.Nodes[0].Resources["cpu"].Allocated != 1 {
+			t.Errorf("JSON report = %+v, want 2 nodes with 1 CPU allocated on node-a", got)
+		}
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		var got snapshotReport
+		if err := yaml.Unmarshal([]byte(render("yaml")), &got); err != nil {
+			t.Fatalf("decoding YAML: %v", err)
+		}
+		if got.Cluster.Resources["cpu"].Allocatable != 12 || len(got.Groups) != 2 {
+			t.Errorf("YAML report = %+v, want 12 allocatable CPU and 2 groups", got)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		records, err := csv.NewReader(strings.NewReader(render("csv"))).ReadAll()
+		if err != nil {
+			t.Fatalf("reading CSV: %v", err)
+		}
+		want := []string{"node", "", "node-a", "1", "cpu", "1", "4", "0.25", "0", "0"}
+		found := false
+		for _, r := range records {
+			if strings.Join(r, ",") == strings.Join(want, ",") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("CSV row %v not found in %v", want, records)
+		}
+		// header, cluster, 2 nodes, 2 zone values, 1 selector group
+		if len(records) != 7 {
+			t.Errorf("CSV has %d records, want 7", len(records))
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		out := render("table")
+		for _, want := range []string{
+			"node-a  █████░░░░░░░░░░░░░░░   25.0%  1/4",
+			"LABEL GROUP topology.kubernetes.io/zone",
+			"SELECTOR GROUP zone-a",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("table does not contain %q:\n%s", want, out)
+			}
+		}
+	})
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		res  corev1.ResourceName
+		v    float64
+		want string
+	}{
+		{corev1.ResourceCPU, 1.5, "1.5"},
+		{corev1.ResourceCPU, 0.123, "0.12"},
+		{corev1.ResourceMemory, 8 * 1024 * 1024 * 1024, "8Gi"},
+		{corev1.ResourceMemory, 1536 * 1024 * 1024, "1.5Gi"},
+		{corev1.ResourceMemory, 512, "512"},
+		{"hugepages-2Mi", 4 * 1024 * 1024, "4Mi"},
+		{"nvidia.com/gpu", 2, "2"},
+	}
+	for _, tt := range tests {
+		if got := formatAmount(tt.res, tt.v); got != tt.want {
+			t.Errorf("formatAmount(%s, %v) = %q, want %q", tt.res, tt.v, got, tt.want)
+		}
+	}
+	if got := utilizationBar(1.7); got != strings.Repeat("█", snapshotBarWidth) {
+		t.Errorf("utilizationBar(1.7) = %q, want a full bar", got)
+	}
+}
+
+func TestRunSnapshot_InvalidFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--output=xml"},
+		{"--sort=gpu"},
+		{"--filter=("},
+		{"--no-such-flag"},
+	} {
+		if code := runSnapshot(args, io.Discard, io.Discard); code != 2 {
+			t.Errorf("runSnapshot(%v) = %d, want 2", args, code)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// proxiedHeader marks scrapes forwarded by a standby. A replica receiving it
+// always serves its own metrics, so two replicas that briefly both believe
+// the other is leader cannot forward a scrape back and forth.
+const proxiedHeader = "X-Kube-Binpacking-Exporter-Proxied"
+
+// leaderAddressTTL bounds how long a resolved leader address is reused. It
+// keeps proxied scrapes from costing two API requests each while still
+// following a failover within a few seconds.
+const leaderAddressTTL = 5 * time.Second
+
+// leaderResolver finds the current leader's metrics address from the
+// leader election Lease holder identity, which is the leader's pod name.
+type leaderResolver struct {
+	client    kubernetes.Interface
+	namespace string
+	leaseName string
+	self      string
+	port      string
+
+	mu      sync.Mutex
+	addr    string
+	expires time.Time
+}
+
+// newLeaderResolver creates a resolver for the leader of config whose
+// metrics are served on port.
+func newLeaderResolver(client kubernetes.Interface, config LeaderElectionConfig, port string) *leaderResolver {
+	return &leaderResolver{
+		client:    client,
+		namespace: config.LeaseNamespace,
+		leaseName: config.LeaseName,
+		self:      config.Identity,
+		port:      port,
+	}
+}
+
+// LeaderAddress returns the leader's host:port.
+func (r *leaderResolver) LeaderAddress(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.addr != "" && time.Now().Before(r.expires) {
+		return r.addr, nil
+	}
+
+	lease, err := r.client.CoordinationV1().Leases(r.namespace).Get(ctx, r.leaseName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("getting leader election lease: %w", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return "", fmt.Errorf("lease %s/%s has no holder", r.namespace, r.leaseName)
+	}
+	holder := *lease.Spec.HolderIdentity
+	if holder == r.self {
+		return "", fmt.Errorf("lease %s/%s is held by this instance", r.namespace, r.leaseName)
+	}
+
+	pod, err := r.client.CoreV1().Pods(r.namespace).Get(ctx, holder, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("getting leader pod %s: %w", holder, err)
+	}
+	if pod.Status.PodIP == "" {
+		return "", fmt.Errorf("leader pod %s has no IP", holder)
+	}
+
+	r.addr = net.JoinHostPort(pod.Status.PodIP, r.port)
+	r.expires = time.Now().Add(leaderAddressTTL)
+	return r.addr, nil
+}
+
+// Invalidate drops the cached leader address, e.g. after a failed proxy.
+func (r *leaderResolver) Invalidate() {
+	r.mu.Lock()
+	r.addr = ""
+	r.mu.Unlock()
+}
+
+// standbyProxyHandler serves local responses on the leader and forwards
+// requests to the same path on the leader on standbys, so every replica
+// behind a Service returns the same binpacking metrics and API values. If the
+// leader cannot be reached the standby falls back to its own response
+// (leader_status and cache_age only for metrics, a 503 for the API).
+func standbyProxyHandler(local http.Handler, isLeader *atomic.Bool, resolver *leaderResolver, client *http.Client, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isLeader.Load() || r.Header.Get(proxiedHeader) != "" {
+			local.ServeHTTP(w, r)
+			return
+		}
+
+		addr, err := resolver.LeaderAddress(r.Context())
+		if err != nil {
+			logger.Debug("cannot resolve leader, serving local metrics", "error", err)
+			local.ServeHTTP(w, r)
+			return
+		}
+
+		if err := proxyToLeader(w, r, client, "http://"+addr+r.URL.RequestURI()); err != nil {
+			resolver.Invalidate()
+			logger.Warn("failed to proxy to the leader, serving locally", "leader", addr, "path", r.URL.Path, "error", err)
+			local.ServeHTTP(w, r)
+		}
+	})
+}
+
+// proxyToLeader forwards a request to url and copies the response, including
+// client errors such as an API 404. It returns an error, without writing
+// anything, if the leader could not be reached or answered with a 5xx.
+func proxyToLeader(w http.ResponseWriter, r *http.Request, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(proxiedHeader, "1")
+	if accept := r.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("leader returned %s", resp.Status)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+	return nil
+}
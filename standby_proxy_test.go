@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func leaderLease(holder string) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "kbe", Namespace: "monitoring"},
+		Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder},
+	}
+}
+
+func podWithIP(name, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "monitoring"},
+		Status:     corev1.PodStatus{PodIP: ip},
+	}
+}
+
+// TestLeaderResolver verifies the leader address is derived from the Lease
+// holder's pod IP.
+func TestLeaderResolver(t *testing.T) {
+	config := LeaderElectionConfig{LeaseName: "kbe", LeaseNamespace: "monitoring", Identity: "pod-b"}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    string
+		wantErr bool
+	}{
+		{name: "leader pod", objects: []runtime.Object{leaderLease("pod-a"), podWithIP("pod-a", "10.0.0.1")}, want: "10.0.0.1:9101"},
+		{name: "no lease", objects: nil, wantErr: true},
+		{name: "held by self", objects: []runtime.Object{leaderLease("pod-b")}, wantErr: true},
+		{name: "leader pod missing", objects: []runtime.Object{leaderLease("pod-a")}, wantErr: true},
+		{name: "leader pod without IP", objects: []runtime.Object{leaderLease("pod-a"), podWithIP("pod-a", "")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLeaderResolver(fake.NewClientset(tt.objects...), config, "9101")
+			got, err := r.LeaderAddress(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LeaderAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LeaderAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("address is cached until invalidated", func(t *testing.T) {
+		clientset := fake.NewClientset(leaderLease("pod-a"), podWithIP("pod-a", "10.0.0.1"))
+		r := newLeaderResolver(clientset, config, "9101")
+		if _, err := r.LeaderAddress(context.Background()); err != nil {
+			t.Fatalf("LeaderAddress() error = %v", err)
+		}
+		if _, err := clientset.CoreV1().Pods("monitoring").Update(context.Background(), podWithIP("pod-a", "10.0.0.2"), metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("updating pod: %v", err)
+		}
+		if got, _ := r.LeaderAddress(context.Background()); got != "10.0.0.1:9101" {
+			t.Errorf("LeaderAddress() = %q, want cached 10.0.0.1:9101", got)
+		}
+		r.Invalidate()
+		if got, _ := r.LeaderAddress(context.Background()); got != "10.0.0.2:9101" {
+			t.Errorf("LeaderAddress() after Invalidate = %q, want 10.0.0.2:9101", got)
+		}
+	})
+}
+
+// TestStandbyProxyHandler verifies standbys forward scrapes and API requests
+// to the leader, relaying its client errors, never re-forward a proxied
+// request, and fall back to local responses when the leader is unreachable.
+func TestStandbyProxyHandler(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	local := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "local\n")
+	})
+
+	var leaderSawHeader atomic.Bool
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaderSawHeader.Store(r.Header.Get(proxiedHeader) != "")
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if r.URL.Path == "/api/v1/nodes/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = io.WriteString(w, "leader "+r.URL.RequestURI()+"\n")
+	}))
+	t.Cleanup(leader.Close)
+	leaderAddr := strings.TrimPrefix(leader.URL, "http://")
+
+	tests := []struct {
+		name       string
+		path       string
+		leader     bool
+		proxied    bool
+		leaderAddr string
+		wantCode   int
+		want       string
+	}{
+		{name: "leader serves local", leader: true, leaderAddr: leaderAddr, want: "local\n"},
+		{name: "standby proxies to leader", leaderAddr: leaderAddr, want: "leader /metrics\n"},
+		{name: "standby proxies API requests", path: "/api/v1/groups/zone?cluster=a", leaderAddr: leaderAddr, want: "leader /api/v1/groups/zone?cluster=a\n"},
+		{name: "leader client errors are relayed", path: "/api/v1/nodes/missing", leaderAddr: leaderAddr, wantCode: http.StatusNotFound, want: "leader /api/v1/nodes/missing\n"},
+		{name: "proxied scrape is served locally", proxied: true, leaderAddr: leaderAddr, want: "local\n"},
+		{name: "unreachable leader falls back to local", leaderAddr: "127.0.0.1:1", want: "local\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isLeader := new(atomic.Bool)
+			isLeader.Store(tt.leader)
+			resolver := &leaderResolver{addr: tt.leaderAddr, expires: time.Now().Add(time.Hour)}
+			handler := standbyProxyHandler(local, isLeader, resolver, &http.Client{Timeout: 5 * time.Second}, logger)
+
+			if tt.path == "" {
+				tt.path = "/metrics"
+			}
+			if tt.wantCode == 0 {
+				tt.wantCode = http.StatusOK
+			}
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.proxied {
+				req.Header.Set(proxiedHeader, "1")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if !leaderSawHeader.Load() {
+		t.Error("proxied request should carry the anti-loop header")
+	}
+}
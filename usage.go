@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// podMetricsPath is the metrics.k8s.io endpoint listing PodMetrics for all
+// namespaces. NodeMetrics are not polled: they include usage outside pods
+// (kubelet, container runtime, system daemons), which has no request to
+// compare against, so node usage is the sum of its pods' usage.
+const podMetricsPath = "/apis/metrics.k8s.io/v1beta1/pods"
+
+// usageResources are the resources reported by the metrics.k8s.io API.
+// Usage metrics are only emitted for tracked resources in this set.
+var usageResources = map[corev1.ResourceName]bool{
+	corev1.ResourceCPU:    true,
+	corev1.ResourceMemory: true,
+}
+
+// podMetricsList mirrors the subset of metrics.k8s.io/v1beta1 PodMetricsList
+// used by the exporter. Declared locally to avoid depending on k8s.io/metrics.
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Containers []struct {
+			Name  string              `json:"name"`
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// usageFetcher returns the raw response body for a metrics API path.
+type usageFetcher func(ctx context.Context, path string) ([]byte, error)
+
+// newAPIServerFetcher fetches metrics through the Kubernetes API server's
+// aggregation layer, reusing the exporter's credentials.
+func newAPIServerFetcher(client rest.Interface) usageFetcher {
+	return func(ctx context.Context, path string) ([]byte, error) {
+		return client.Get().AbsPath(path).DoRaw(ctx)
+	}
+}
+
+// newHTTPFetcher fetches metrics from any endpoint serving the metrics.k8s.io
+// paths (e.g. metrics-server accessed directly, or a compatible stand-in).
+func newHTTPFetcher(baseURL string, client *http.Client) usageFetcher {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return func(ctx context.Context, path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, baseURL+path)
+		}
+		return io.ReadAll(resp.Body)
+	}
+}
+
+// UsageTracker periodically polls the metrics.k8s.io API and caches the
+// latest per-pod usage. Collect reads the cache, so an unavailable metrics
+// API never blocks or fails a scrape — usage metrics are simply omitted.
+type UsageTracker struct {
+	fetch    usageFetcher
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu          sync.RWMutex
+	podUsage    map[string]corev1.ResourceList // keyed by namespace/name
+	lastSuccess time.Time
+}
+
+// NewUsageTracker creates a tracker polling with the given fetcher every interval.
+func NewUsageTracker(fetch usageFetcher, interval time.Duration, logger *slog.Logger) *UsageTracker {
+	return &UsageTracker{
+		fetch:    fetch,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run polls until the context is cancelled.
+func (u *UsageTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		if err := u.poll(ctx); err != nil {
+			u.logger.Warn("failed to poll usage metrics", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches PodMetrics once and replaces the cached usage on success.
+func (u *UsageTracker) poll(ctx context.Context) error {
+	timeout := u.interval
+	if timeout > 10*time.Second {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	raw, err := u.fetch(ctx, podMetricsPath)
+	if err != nil {
+		return fmt.Errorf("fetching pod metrics: %w", err)
+	}
+
+	var list podMetricsList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("decoding pod metrics: %w", err)
+	}
+
+	podUsage := make(map[string]corev1.ResourceList, len(list.Items))
+	for _, item := range list.Items {
+		total := corev1.ResourceList{}
+		for _, c := range item.Containers {
+			for res, qty := range c.Usage {
+				sum := total[res]
+				sum.Add(qty)
+				total[res] = sum
+			}
+		}
+		podUsage[item.Metadata.Namespace+"/"+item.Metadata.Name] = total
+	}
+
+	u.mu.Lock()
+	u.podUsage = podUsage
+	u.lastSuccess = time.Now()
+	u.mu.Unlock()
+
+	u.logger.Debug("polled usage metrics", "pod_count", len(podUsage))
+	return nil
+}
+
+// Snapshot returns the cached per-pod usage, or nil if no poll has succeeded
+// within the last three intervals. The returned map must not be modified.
+func (u *UsageTracker) Snapshot() map[string]corev1.ResourceList {
+	if u == nil {
+		return nil
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if u.podUsage == nil || time.Since(u.lastSuccess) > 3*u.interval {
+		return nil
+	}
+	return u.podUsage
+}
+
+// podUsageValue returns the usage of a resource for a pod (by namespace/name key) from a usage snapshot.
+func podUsageValue(usage map[string]corev1.ResourceList, key string, res corev1.ResourceName) float64 {
+	if qty, ok := usage[key][res]; ok {
+		return qty.AsApproximateFloat64()
+	}
+	return 0
+}
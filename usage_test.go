@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// podMetricsJSON is a PodMetricsList as served by metrics-server.
+const podMetricsJSON = `{
+  "kind": "PodMetricsList",
+  "apiVersion": "metrics.k8s.io/v1beta1",
+  "items": [
+    {
+      "metadata": {"name": "pod-1", "namespace": "default"},
+      "containers": [
+        {"name": "app", "usage": {"cpu": "250m", "memory": "1Gi"}},
+        {"name": "sidecar", "usage": {"cpu": "250m", "memory": "512Mi"}}
+      ]
+    },
+    {
+      "metadata": {"name": "pod-2", "namespace": "default"},
+      "containers": [
+        {"name": "app", "usage": {"cpu": "1", "memory": "2Gi"}}
+      ]
+    }
+  ]
+}`
+
+// newMetricsAPIStandIn starts a local server serving podMetricsJSON on the
+// metrics.k8s.io path. When fail is true it responds 503 like an unavailable
+// APIService.
+func newMetricsAPIStandIn(t *testing.T, fail bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail || r.URL.Path != podMetricsPath {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(podMetricsJSON))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newUsageTestCollector(tracker *UsageTracker, labelGroups []LabelGroup) *BinpackingCollector {
+	nodes := []*corev1.Node{makeNode("node-1", "4", "8Gi")}
+	nodes[0].Labels = map[string]string{"zone": "a"}
+	pods := []*corev1.Pod{
+		makePodWithResources("default", "pod-1", "node-1", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "1", "2Gi")}, nil),
+		makePodWithResources("default", "pod-2", "node-1", corev1.PodRunning,
+			[]corev1.Container{makeContainer("app", "1", "2Gi")}, nil),
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	resources := []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, "nvidia.com/gpu"}
+	return NewBinpackingCollector(&fakeNodeLister{nodes: nodes}, &fakePodLister{pods: pods},
+		logger, resources, labelGroups, true, nil, nil, WithUsageTracker(tracker))
+}
+
+func TestUsageTracker_Poll(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	t.Run("http endpoint", func(t *testing.T) {
+		srv := newMetricsAPIStandIn(t, false)
+		tracker := NewUsageTracker(newHTTPFetcher(srv.URL, srv.Client()), time.Minute, logger)
+		if err := tracker.poll(context.Background()); err != nil {
+			t.Fatalf("poll() error = %v", err)
+		}
+
+		usage := tracker.Snapshot()
+		cpu := usage["default/pod-1"][corev1.ResourceCPU]
+		if !floatEquals(cpu.AsApproximateFloat64(), 0.5) {
+			t.Errorf("pod-1 cpu usage = %v, want 0.5 (sum of containers)", cpu.AsApproximateFloat64())
+		}
+	})
+
+	t.Run("through api server client", func(t *testing.T) {
+		srv := newMetricsAPIStandIn(t, false)
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+		if err != nil {
+			t.Fatalf("creating clientset: %v", err)
+		}
+		tracker := NewUsageTracker(newAPIServerFetcher(clientset.Discovery().RESTClient()), time.Minute, logger)
+		if err := tracker.poll(context.Background()); err != nil {
+			t.Fatalf("poll() error = %v", err)
+		}
+		if len(tracker.Snapshot()) != 2 {
+			t.Errorf("Snapshot() pod count = %d, want 2", len(tracker.Snapshot()))
+		}
+	})
+
+	t.Run("unavailable endpoint", func(t *testing.T) {
+		srv := newMetricsAPIStandIn(t, true)
+		tracker := NewUsageTracker(newHTTPFetcher(srv.URL, srv.Client()), time.Minute, logger)
+		if err := tracker.poll(context.Background()); err == nil {
+			t.Error("poll() expected error for unavailable endpoint")
+		}
+		if tracker.Snapshot() != nil {
+			t.Error("Snapshot() should be nil before any successful poll")
+		}
+	})
+
+	t.Run("stale data is dropped", func(t *testing.T) {
+		srv := newMetricsAPIStandIn(t, false)
+		tracker := NewUsageTracker(newHTTPFetcher(srv.URL, srv.Client()), time.Minute, logger)
+		if err := tracker.poll(context.Background()); err != nil {
+			t.Fatalf("poll() error = %v", err)
+		}
+		tracker.lastSuccess = time.Now().Add(-4 * time.Minute)
+		if tracker.Snapshot() != nil {
+			t.Error("Snapshot() should be nil when data is older than three intervals")
+		}
+	})
+}
+
+func TestBinpackingCollector_UsageMetrics(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	t.Run("available", func(t *testing.T) {
+		srv := newMetricsAPIStandIn(t, false)
+		tracker := NewUsageTracker(newHTTPFetcher(srv.URL, srv.Client()), time.Minute, logger)
+		if err := tracker.poll(context.Background()); err != nil {
+			t.Fatalf("poll() error = %v", err)
+		}
+		metrics := collectMetrics(newUsageTestCollector(tracker, []LabelGroup{newLabelGroup("zone")}))
+
+		tests := []struct {
+			name   string
+			labels map[string]string
+			want   float64
+		}{
+			{"kube_binpacking_node_usage", map[string]string{"node": "node-1", "resource": "cpu"}, 1.5},
+			{"kube_binpacking_node_efficiency_ratio", map[string]string{"node": "node-1", "resource": "cpu"}, 0.75},
+			{"kube_binpacking_cluster_usage", map[string]string{"resource": "memory"}, 3.5 * 1024 * 1024 * 1024},
+			{"kube_binpacking_cluster_efficiency_ratio", map[string]string{"resource": "memory"}, 0.875},
+			{"kube_binpacking_group_usage", map[string]string{"label_group_value": "a", "resource": "cpu"}, 1.5},
+			{"kube_binpacking_group_efficiency_ratio", map[string]string{"label_group_value": "a", "resource": "cpu"}, 0.75},
+			{"kube_binpacking_usage_metrics_available", nil, 1},
+		}
+		for _, tt := range tests {
+			got, ok := findMetricValue(t, metrics, tt.name, tt.labels)
+			if !ok {
+				t.Errorf("%s%v not emitted", tt.name, tt.labels)
+				continue
+			}
+			if !floatEquals(got, tt.want) {
+				t.Errorf("%s%v = %v, want %v", tt.name, tt.labels, got, tt.want)
+			}
+		}
+
+		// metrics.k8s.io does not report extended resources.
+		if _, ok := findMetricValue(t, metrics, "kube_binpacking_cluster_usage", map[string]string{"resource": "nvidia.com/gpu"}); ok {
+			t.Error("usage should not be emitted for resources the metrics API does not report")
+		}
+	})
+
+	t.Run("unavailable does not fail scrape", func(t *testing.T) {
+		srv := newMetricsAPIStandIn(t, true)
+		tracker := NewUsageTracker(newHTTPFetcher(srv.URL, srv.Client()), time.Minute, logger)
+		_ = tracker.poll(context.Background())
+		metrics := collectMetrics(newUsageTestCollector(tracker, nil))
+
+		if _, ok := findMetricValue(t, metrics, "kube_binpacking_cluster_allocated", map[string]string{"resource": "cpu"}); !ok {
+			t.Error("binpacking metrics should still be emitted when usage is unavailable")
+		}
+		if _, ok := findMetricValue(t, metrics, "kube_binpacking_node_usage", nil); ok {
+			t.Error("usage metrics should be omitted when usage is unavailable")
+		}
+		if got, ok := findMetricValue(t, metrics, "kube_binpacking_usage_metrics_available", nil); !ok || got != 0 {
+			t.Errorf("usage_metrics_available = %v (emitted=%v), want 0", got, ok)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		metrics := collectMetrics(newUsageTestCollector(nil, nil))
+		if _, ok := findMetricValue(t, metrics, "kube_binpacking_usage_metrics_available", nil); ok {
+			t.Error("usage_metrics_available should not be emitted when usage metrics are disabled")
+		}
+	})
+}
+
+// TestPodUsageValue verifies lookups for pods missing from the usage snapshot.
+func TestPodUsageValue(t *testing.T) {
+	if got := podUsageValue(map[string]corev1.ResourceList{}, "default/missing", corev1.ResourceCPU); got != 0 {
+		t.Errorf("podUsageValue() = %v, want 0", got)
+	}
+}